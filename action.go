@@ -0,0 +1,365 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : action.go
+@Software: Goland2021.3.1
+@Description: 邮件操作：设置标志、移动、复制和删除
+所有的操作都使用UID，不会因为其他客户端删除邮件导致序号变化而操作到错误的邮件
+*/
+
+// mailboxUids 同一个邮箱中要操作的邮件
+type mailboxUids struct {
+	mailbox string
+	uids    []uint32
+	results []*Result
+}
+
+// groupByMailbox 将结果按所在的邮箱分组，Mailbox为空的结果属于Config.Mailbox
+func (i *Imap) groupByMailbox(results []*Result) ([]*mailboxUids, error) {
+	var groups []*mailboxUids
+	index := make(map[string]*mailboxUids)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if result.Uid == 0 {
+			return nil, fmt.Errorf("imap: message %q has no uid", result.Title)
+		}
+
+		mailbox := result.Mailbox
+		if mailbox == "" {
+			mailbox = i.Config.Mailbox
+		}
+		group, ok := index[mailbox]
+		if !ok {
+			group = &mailboxUids{mailbox: mailbox}
+			index[mailbox] = group
+			groups = append(groups, group)
+		}
+		group.uids = append(group.uids, result.Uid)
+		group.results = append(group.results, result)
+	}
+	return groups, nil
+}
+
+// uidSet 将UID压缩为sequence-set，连续的UID合并为一个范围
+func uidSet(uids []uint32) *imap.SeqSet {
+	set := new(imap.SeqSet)
+	set.AddNum(uids...)
+	return set
+}
+
+// resetCache 邮件被移动或者删除后，不再使用缓存的搜索结果
+func (i *Imap) resetCache() {
+	i.locker.Lock()
+	i.LastSearchTime = time.Time{}
+	i.locker.Unlock()
+}
+
+// AddFlags 给邮件添加标志，例如imap.SeenFlag、imap.FlaggedFlag
+func (i *Imap) AddFlags(ctx context.Context, results []*Result, flags ...string) error {
+	return i.storeResults(ctx, results, imap.AddFlags, flags)
+}
+
+// RemoveFlags 去掉邮件的标志
+func (i *Imap) RemoveFlags(ctx context.Context, results []*Result, flags ...string) error {
+	return i.storeResults(ctx, results, imap.RemoveFlags, flags)
+}
+
+// MarkRead 将邮件标记为已读
+func (i *Imap) MarkRead(ctx context.Context, results []*Result) error {
+	return i.AddFlags(ctx, results, imap.SeenFlag)
+}
+
+// MarkUnread 将邮件标记为未读
+func (i *Imap) MarkUnread(ctx context.Context, results []*Result) error {
+	return i.RemoveFlags(ctx, results, imap.SeenFlag)
+}
+
+// Flag 将邮件标记为星标邮件
+func (i *Imap) Flag(ctx context.Context, results []*Result) error {
+	return i.AddFlags(ctx, results, imap.FlaggedFlag)
+}
+
+// Unflag 取消邮件的星标
+func (i *Imap) Unflag(ctx context.Context, results []*Result) error {
+	return i.RemoveFlags(ctx, results, imap.FlaggedFlag)
+}
+
+// Move 将邮件移动到dest邮箱
+// 服务器支持MOVE时使用UID MOVE，否则使用UID COPY之后只删除这些邮件
+// 服务器支持UIDPLUS时，结果的UID会更新为邮件在dest邮箱中的UID
+func (i *Imap) Move(ctx context.Context, results []*Result, dest string) error {
+	groups, err := i.groupByMailbox(results)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		moved, err := i.moveByUid(ctx, group.mailbox, group.uids, dest)
+		if err != nil {
+			return err
+		}
+		for _, result := range group.results {
+			result.Mailbox = dest
+			if uid, ok := moved[result.Uid]; ok {
+				result.Uid = uid
+			}
+		}
+	}
+	return nil
+}
+
+// Copy 将邮件复制到dest邮箱
+func (i *Imap) Copy(ctx context.Context, results []*Result, dest string) error {
+	groups, err := i.groupByMailbox(results)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err = i.CopyByUid(ctx, group.mailbox, group.uids, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete 永久删除邮件，同一个邮箱中其他被标记为\Deleted的邮件不会被删除
+func (i *Imap) Delete(ctx context.Context, results []*Result) error {
+	groups, err := i.groupByMailbox(results)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err = i.DeleteByUid(ctx, group.mailbox, group.uids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeResults 修改邮件的标志，成功后同步修改结果中的Flags
+func (i *Imap) storeResults(ctx context.Context, results []*Result, op imap.FlagsOp, flags []string) error {
+	groups, err := i.groupByMailbox(results)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err = i.store(ctx, group.mailbox, group.uids, op, flags); err != nil {
+			return err
+		}
+		for _, result := range group.results {
+			result.Flags = applyFlags(result.Flags, op, flags)
+		}
+	}
+	return nil
+}
+
+// applyFlags 在本地对标志执行和STORE相同的修改
+func applyFlags(current []string, op imap.FlagsOp, flags []string) []string {
+	var result []string
+	if op == imap.AddFlags {
+		result = append(result, current...)
+	} else if op == imap.RemoveFlags {
+		for _, flag := range current {
+			if !hasAttr(flags, flag) {
+				result = append(result, flag)
+			}
+		}
+		return result
+	}
+	for _, flag := range flags {
+		if !hasAttr(result, flag) {
+			result = append(result, flag)
+		}
+	}
+	return result
+}
+
+// AddFlagsByUid 给mailbox中指定UID的邮件添加标志
+func (i *Imap) AddFlagsByUid(ctx context.Context, mailbox string, uids []uint32, flags ...string) error {
+	return i.store(ctx, mailbox, uids, imap.AddFlags, flags)
+}
+
+// RemoveFlagsByUid 去掉mailbox中指定UID的邮件的标志
+func (i *Imap) RemoveFlagsByUid(ctx context.Context, mailbox string, uids []uint32, flags ...string) error {
+	return i.store(ctx, mailbox, uids, imap.RemoveFlags, flags)
+}
+
+// MoveByUid 将mailbox中指定UID的邮件移动到dest邮箱
+func (i *Imap) MoveByUid(ctx context.Context, mailbox string, uids []uint32, dest string) error {
+	_, err := i.moveByUid(ctx, mailbox, uids, dest)
+	return err
+}
+
+// moveByUid 移动邮件，服务器支持UIDPLUS时返回原来的UID到dest邮箱中新UID的映射
+func (i *Imap) moveByUid(ctx context.Context, mailbox string, uids []uint32, dest string) (map[uint32]uint32, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	defer i.resetCache()
+
+	var data *imap.CopyData
+	err := i.withClient(ctx, func(c *client.Client) error {
+		if _, err := i.openMailbox(ctx, c, mailbox, false); err != nil {
+			return err
+		}
+		set := uidSet(uids)
+
+		ok, err := c.Support("MOVE")
+		if err != nil {
+			return commandError(c, "CAPABILITY", err)
+		}
+		if ok {
+			if data, err = c.UidMoveUid(ctx, set, dest); err != nil {
+				i.Log.Error("移动邮件失败", "error", err, "mailbox", mailbox, "dest", dest)
+				return commandError(c, "UID MOVE", err)
+			}
+			return nil
+		}
+
+		// 不支持MOVE时先复制，再只删除这些邮件
+		if data, err = c.UidCopyUid(ctx, set, dest); err != nil {
+			i.Log.Error("复制邮件失败", "error", err, "mailbox", mailbox, "dest", dest)
+			return commandError(c, "UID COPY", err)
+		}
+		return i.expungeUids(ctx, c, set)
+	})
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return data.Map(), nil
+}
+
+// CopyByUid 将mailbox中指定UID的邮件复制到dest邮箱
+func (i *Imap) CopyByUid(ctx context.Context, mailbox string, uids []uint32, dest string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	return i.withClient(ctx, func(c *client.Client) error {
+		if _, err := i.selectMailbox(ctx, c, mailbox); err != nil {
+			return err
+		}
+		if _, err := c.UidCopyUid(ctx, uidSet(uids), dest); err != nil {
+			i.Log.Error("复制邮件失败", "error", err, "mailbox", mailbox, "dest", dest)
+			return commandError(c, "UID COPY", err)
+		}
+		return nil
+	})
+}
+
+// DeleteByUid 永久删除mailbox中指定UID的邮件
+func (i *Imap) DeleteByUid(ctx context.Context, mailbox string, uids []uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	defer i.resetCache()
+
+	return i.withClient(ctx, func(c *client.Client) error {
+		if _, err := i.openMailbox(ctx, c, mailbox, false); err != nil {
+			return err
+		}
+		return i.expungeUids(ctx, c, uidSet(uids))
+	})
+}
+
+// store 使用UID STORE修改mailbox中邮件的标志
+func (i *Imap) store(ctx context.Context, mailbox string, uids []uint32, op imap.FlagsOp, flags []string) error {
+	if len(uids) == 0 || len(flags) == 0 {
+		return nil
+	}
+
+	item := imap.FormatFlagsOp(op, true)
+	value := make([]interface{}, len(flags))
+	for n, flag := range flags {
+		value[n] = flag
+	}
+
+	// 添加或去掉标志可以安全地重复执行
+	return i.withClientRetry(ctx, func(c *client.Client) error {
+		if _, err := i.openMailbox(ctx, c, mailbox, false); err != nil {
+			return err
+		}
+		if err := c.UidStoreContext(ctx, uidSet(uids), item, value, nil); err != nil {
+			i.Log.Error("修改邮件标志失败", "error", err, "mailbox", mailbox, "flags", flags)
+			return commandError(c, "UID STORE", err)
+		}
+		return nil
+	})
+}
+
+// expungeUids 给当前邮箱中set内的邮件添加\Deleted标志并只删除这些邮件
+// 服务器支持UIDPLUS时使用UID EXPUNGE，否则暂时去掉其他邮件的\Deleted标志，EXPUNGE之后再恢复
+func (i *Imap) expungeUids(ctx context.Context, c *client.Client, set *imap.SeqSet) error {
+	deletedItem := imap.FormatFlagsOp(imap.AddFlags, true)
+	deletedFlags := []interface{}{imap.DeletedFlag}
+	if err := c.UidStoreContext(ctx, set, deletedItem, deletedFlags, nil); err != nil {
+		i.Log.Error("标记删除邮件失败", "error", err)
+		return commandError(c, "UID STORE", err)
+	}
+
+	ok, err := c.Support("UIDPLUS")
+	if err != nil {
+		return commandError(c, "CAPABILITY", err)
+	}
+	if ok {
+		if err = c.UidExpunge(set, nil); err != nil {
+			i.Log.Error("删除邮件失败", "error", err)
+			return commandError(c, "UID EXPUNGE", err)
+		}
+		return nil
+	}
+
+	// 找出其他已经被标记为\Deleted的邮件
+	criteria := imap.NewSearchCriteria()
+	criteria.WithFlags = []string{imap.DeletedFlag}
+	deleted, err := c.UidSearchContext(ctx, criteria)
+	if err != nil {
+		return commandError(c, "UID SEARCH", err)
+	}
+	others := new(imap.SeqSet)
+	for _, uid := range deleted {
+		if !set.Contains(uid) {
+			others.AddNum(uid)
+		}
+	}
+
+	if others.Empty() {
+		if err = c.Expunge(nil); err != nil {
+			i.Log.Error("删除邮件失败", "error", err)
+			return commandError(c, "EXPUNGE", err)
+		}
+		return nil
+	}
+
+	// 修改了其他邮件的标志之后不再使用ctx，必须执行到恢复标志为止，否则中途取消会使这些邮件永久失去\Deleted标志
+	var expungeErr error
+	undeleteItem := imap.FormatFlagsOp(imap.RemoveFlags, true)
+	if err = c.UidStore(others, undeleteItem, deletedFlags, nil); err != nil {
+		i.Log.Error("暂时去掉邮件的删除标志失败", "error", err, "uids", others)
+		expungeErr = commandError(c, "UID STORE", err)
+	} else if err = c.Expunge(nil); err != nil {
+		i.Log.Error("删除邮件失败", "error", err)
+		expungeErr = commandError(c, "EXPUNGE", err)
+	}
+
+	// 恢复其他邮件的\Deleted标志，去掉标志失败时可能已经修改了一部分邮件，同样需要恢复
+	if err = c.UidStore(others, deletedItem, deletedFlags, nil); err != nil {
+		i.Log.Error("恢复邮件的删除标志失败", "error", err, "uids", others)
+		if expungeErr == nil {
+			expungeErr = commandError(c, "UID STORE", err)
+		}
+	}
+	return expungeErr
+}
@@ -0,0 +1,140 @@
+package zdpgo_imap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+@Time : 2022/5/24 20:46
+@Author : 张大鹏
+@File : attachment.go
+@Software: Goland2021.3.1
+@Description: 将附件流式保存到临时目录
+*/
+
+// 附件的处理模式
+const (
+	AttachmentModeMemory = "memory" // 附件内容保存在Result.Attachments中，默认的模式
+	AttachmentModeDisk   = "disk"   // 附件流式保存到Config.TmpDir，Result.Files中记录文件信息
+)
+
+// partHeader 附件和内嵌内容的头信息
+type partHeader interface {
+	Get(key string) string
+	ContentType() (t string, params map[string]string, err error)
+}
+
+// saveAttachment 将附件流式写入TmpDir下的文件，同时计算SHA-256
+func (i *Imap) saveAttachment(h partHeader, filename string, r io.Reader) (*AttachmentFile, error) {
+	if err := os.MkdirAll(i.Config.TmpDir, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := createUniqueFile(i.Config.TmpDir, sanitizeFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	file := &AttachmentFile{
+		Filename:  filename,
+		Path:      f.Name(),
+		Size:      size,
+		ContentID: strings.Trim(h.Get("Content-Id"), "<> "),
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+	}
+	file.ContentType, _, _ = h.ContentType()
+	return file, nil
+}
+
+// sanitizeFilename 去掉文件名中的路径和操作系统不允许的字符
+func sanitizeFilename(filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, filename)
+
+	filename = strings.Trim(filename, ". ")
+	if filename == "" {
+		filename = "attachment"
+	}
+	return filename
+}
+
+// createUniqueFile 在dir下创建名称不冲突的文件，文件已经存在时在名称后面加上序号
+func createUniqueFile(dir, filename string) (*os.File, error) {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	name := filename
+	for n := 1; ; n++ {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			return f, err
+		}
+		name = fmt.Sprintf("%s(%d)%s", base, n, ext)
+	}
+}
+
+// Remove 删除下载的附件文件
+func (f *AttachmentFile) Remove() error {
+	if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveAttachments 删除查询结果下载到临时目录的附件和内嵌内容文件
+func (i *Imap) RemoveAttachments(results ...*Result) error {
+	var firstErr error
+	for _, result := range results {
+		for _, file := range result.Files {
+			if err := file.Remove(); err != nil {
+				i.Log.Error("删除附件失败", "error", err, "path", file.Path)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		result.Files = nil
+
+		for _, part := range result.InlineParts {
+			if part.Path == "" {
+				continue
+			}
+			if err := os.Remove(part.Path); err != nil && !os.IsNotExist(err) {
+				i.Log.Error("删除内嵌内容失败", "error", err, "path", part.Path)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+			part.Path = ""
+		}
+	}
+	return firstErr
+}
+
+// CleanTmpDir 删除临时目录以及其中下载的所有附件
+func (i *Imap) CleanTmpDir() error {
+	return os.RemoveAll(i.Config.TmpDir)
+}
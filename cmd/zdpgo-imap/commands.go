@@ -0,0 +1,329 @@
+package main
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : commands.go
+@Software: Goland2021.3.1
+@Description: zdpgo-imap 的子命令
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// summary 输出的邮件概要
+type summary struct {
+	Mailbox   string    `json:"mailbox"`
+	Uid       uint32    `json:"uid"`
+	MessageID string    `json:"message_id,omitempty"`
+	From      string    `json:"from"`
+	FromName  string    `json:"from_name,omitempty"`
+	To        []string  `json:"to,omitempty"`
+	Subject   string    `json:"subject"`
+	Date      time.Time `json:"date"`
+	Flags     []string  `json:"flags"`
+	Size      uint32    `json:"size"`
+}
+
+func newSummary(r *zdpgo_imap.Result) *summary {
+	date := r.SentDate
+	if date.IsZero() {
+		date = r.DateTime
+	}
+	return &summary{
+		Mailbox:   r.Mailbox,
+		Uid:       r.Uid,
+		MessageID: r.MessageID,
+		From:      r.From,
+		FromName:  r.FromName,
+		To:        r.ToEmails,
+		Subject:   r.Title,
+		Date:      date,
+		Flags:     r.Flags,
+		Size:      r.Size,
+	}
+}
+
+// maxUids -uid最多可以包含的UID数量，避免"1:4294967295"这样的范围占用大量内存
+const maxUids = 100000
+
+// parseUids 解析"1,3,5:9"格式的UID列表
+func parseUids(s string) ([]uint32, error) {
+	if s == "" {
+		return nil, errors.New("缺少-uid参数")
+	}
+	set, err := imap.ParseSeqSet(s)
+	if err != nil {
+		return nil, err
+	}
+	if set.Dynamic() || set.IsSearchRes() {
+		return nil, errors.New("-uid不能包含*或者$")
+	}
+
+	var uids []uint32
+	for _, seq := range set.Set {
+		if uint64(seq.Stop-seq.Start)+1 > uint64(maxUids-len(uids)) {
+			return nil, fmt.Errorf("-uid最多包含%d个UID", maxUids)
+		}
+		// seq.Stop可能是最大的uint32，不能使用uid <= seq.Stop作为循环条件
+		for uid := seq.Start; ; uid++ {
+			uids = append(uids, uid)
+			if uid == seq.Stop {
+				break
+			}
+		}
+	}
+	return uids, nil
+}
+
+// mailbox 当前操作的邮箱
+func mailbox(i *zdpgo_imap.Imap) string {
+	return i.Config.Mailbox
+}
+
+func runList(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	pattern := "*"
+	if len(args) > 0 {
+		pattern = args[0]
+	}
+
+	names, err := i.ListMailboxes(ctx, pattern)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MAILBOX\tMESSAGES\tUNSEEN\tUIDNEXT")
+	for _, name := range names {
+		status, err := i.MailboxStatus(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(w, "%s\t-\t-\t-\n", name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", name, status.Messages, status.Unseen, status.UidNext)
+	}
+	return w.Flush()
+}
+
+// parseRawQuery 将IMAP SEARCH的搜索条件解析为SearchCriteria，例如"FROM bob UNSEEN SINCE 1-Jan-2022"
+func parseRawQuery(query string) (*imap.SearchCriteria, error) {
+	criteria := imap.NewSearchCriteria()
+	if strings.TrimSpace(query) == "" {
+		return criteria, nil
+	}
+
+	r := imap.NewReader(bufio.NewReader(strings.NewReader(query + "\r\n")))
+	fields, err := r.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	if err = criteria.ParseWithCharset(fields, nil); err != nil {
+		return nil, err
+	}
+	return criteria, nil
+}
+
+func runSearch(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "每行输出一个JSON")
+	raw := fs.Bool("raw", false, "使用IMAP SEARCH的语法，例如FROM bob UNSEEN")
+	fs.Parse(args)
+
+	query := strings.Join(fs.Args(), " ")
+	parse := zdpgo_imap.ParseQuery
+	if *raw {
+		parse = parseRawQuery
+	}
+	criteria, err := parse(query)
+	if err != nil {
+		return fmt.Errorf("搜索条件错误: %v", err)
+	}
+	results, err := i.SearchHeaders(ctx, mailbox(i), criteria)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range results {
+			if err = enc.Encode(newSummary(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "UID\tDATE\tFROM\tSUBJECT")
+	for _, r := range results {
+		s := newSummary(r)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Uid, s.Date.Format("2006-01-02 15:04"), s.From, s.Subject)
+	}
+	return w.Flush()
+}
+
+func runFetch(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	uid := fs.Uint("uid", 0, "邮件的UID")
+	output := fs.String("o", "", "保存为.eml文件，默认输出到标准输出")
+	fs.Parse(args)
+	if *uid == 0 {
+		return errors.New("缺少-uid参数")
+	}
+
+	// 邮件抓取成功之后才创建文件，避免留下空的文件
+	var buf bytes.Buffer
+	if err := i.FetchRawByUid(ctx, mailbox(i), uint32(*uid), &buf); err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err := buf.WriteTo(os.Stdout)
+		return err
+	}
+	return ioutil.WriteFile(*output, buf.Bytes(), 0644)
+}
+
+func runAttachments(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	fs := flag.NewFlagSet("attachments", flag.ExitOnError)
+	uidList := fs.String("uid", "", "邮件的UID，例如1,3,5:9")
+	dir := fs.String("dir", ".", "保存附件的目录")
+	fs.Parse(args)
+
+	uids, err := parseUids(*uidList)
+	if err != nil {
+		return err
+	}
+	results, err := i.FetchByUid(ctx, mailbox(i), uids)
+	if err != nil {
+		return err
+	}
+	defer i.RemoveAttachments(results...)
+
+	for _, r := range results {
+		paths, err := i.SaveAttachments(r, *dir)
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", zdpgo_imap.ExportFormatEML, "导出格式：eml、mbox或者maildir")
+	dest := fs.String("dest", "", "导出的目录(eml和maildir)或者文件(mbox)")
+	fs.Parse(args)
+	if *dest == "" {
+		return errors.New("缺少-dest参数")
+	}
+
+	result, err := i.ExportContext(ctx, mailbox(i), *format, *dest)
+	if result != nil {
+		fmt.Printf("导出%d封，跳过%d封，UIDVALIDITY=%d，最大UID=%d\n",
+			result.Exported, result.Skipped, result.UidValidity, result.LastUid)
+	}
+	return err
+}
+
+func runImport(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", zdpgo_imap.ExportFormatEML, "导入格式：eml、mbox或者maildir")
+	src := fs.String("src", "", "导入的目录、.eml文件或者mbox文件")
+	fs.Parse(args)
+	if *src == "" {
+		return errors.New("缺少-src参数")
+	}
+
+	result, err := i.ImportContext(ctx, mailbox(i), *format, *src)
+	if result != nil {
+		fmt.Printf("导入%d封，重复%d封，超过大小限制%d封\n", result.Imported, result.Duplicates, result.TooLarge)
+	}
+	return err
+}
+
+// stringList 可以重复指定的参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func runFlags(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	fs := flag.NewFlagSet("flags", flag.ExitOnError)
+	uidList := fs.String("uid", "", "邮件的UID，例如1,3,5:9")
+	var add, remove stringList
+	fs.Var(&add, "add", "添加的标志，例如\\Seen，可以重复指定")
+	fs.Var(&remove, "remove", "去掉的标志，可以重复指定")
+	fs.Parse(args)
+
+	uids, err := parseUids(*uidList)
+	if err != nil {
+		return err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return errors.New("缺少-add或者-remove参数")
+	}
+
+	if err = i.AddFlagsByUid(ctx, mailbox(i), uids, add...); err != nil {
+		return err
+	}
+	return i.RemoveFlagsByUid(ctx, mailbox(i), uids, remove...)
+}
+
+func runMove(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	fs := flag.NewFlagSet("move", flag.ExitOnError)
+	uidList := fs.String("uid", "", "邮件的UID，例如1,3,5:9")
+	dest := fs.String("to", "", "目标邮箱")
+	fs.Parse(args)
+
+	uids, err := parseUids(*uidList)
+	if err != nil {
+		return err
+	}
+	if *dest == "" {
+		return errors.New("缺少-to参数")
+	}
+	return i.MoveByUid(ctx, mailbox(i), uids, *dest)
+}
+
+func runIdle(ctx context.Context, i *zdpgo_imap.Imap, args []string) error {
+	ch, err := i.Watch(ctx, mailbox(i))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for result := range ch {
+		i.RemoveAttachments(result)
+		if err = enc.Encode(newSummary(result)); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,192 @@
+package main
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : main.go
+@Software: Goland2021.3.1
+@Description: zdpgo-imap 命令行工具
+
+用法：
+	zdpgo-imap [全局参数] <命令> [命令参数]
+
+账号信息的优先级：命令行参数 > 环境变量 > 配置文件(-config，JSON格式的zdpgo_imap.Config)
+环境变量：ZDPGO_IMAP_HOST、ZDPGO_IMAP_PORT、ZDPGO_IMAP_USERNAME、ZDPGO_IMAP_PASSWORD、
+ZDPGO_IMAP_SECURITY、ZDPGO_IMAP_AUTH、ZDPGO_IMAP_TOKEN
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+
+	"github.com/zhangdapeng520/zdpgo_imap"
+)
+
+// command 子命令
+type command struct {
+	usage string
+	run   func(ctx context.Context, i *zdpgo_imap.Imap, args []string) error
+}
+
+var commands = map[string]*command{
+	"list":        {"list [pattern]  列出邮箱和邮件数量", runList},
+	"search":      {"search [-json] [-raw] query  搜索邮件，例如from:alice -is:seen", runSearch},
+	"fetch":       {"fetch -uid N [-o file.eml]  输出或者保存一封邮件", runFetch},
+	"attachments": {"attachments -uid N[,M...] [-dir D]  下载附件", runAttachments},
+	"export":      {"export -format eml|mbox|maildir -dest D  导出邮箱", runExport},
+	"import":      {"import -format eml|mbox|maildir -src S  导入邮件", runImport},
+	"flags":       {"flags -uid N[,M...] [-add F] [-remove F]  修改邮件标志", runFlags},
+	"move":        {"move -uid N[,M...] -to Mailbox  移动邮件", runMove},
+	"idle":        {"idle  监听新邮件，每行输出一个JSON", runIdle},
+}
+
+// globalFlags 全局参数
+type globalFlags struct {
+	config   string
+	host     string
+	port     int
+	username string
+	password string
+	security string
+	auth     string
+	token    string
+	mailbox  string
+	insecure bool
+	debug    bool
+}
+
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "用法: zdpgo-imap [全局参数] <命令> [命令参数]\n\n命令:\n")
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(fs.Output(), "  %s\n", commands[name].usage)
+		}
+		fmt.Fprintf(fs.Output(), "\n全局参数:\n")
+		fs.PrintDefaults()
+	}
+}
+
+func main() {
+	var g globalFlags
+	fs := flag.NewFlagSet("zdpgo-imap", flag.ExitOnError)
+	fs.StringVar(&g.config, "config", "", "JSON格式的配置文件")
+	fs.StringVar(&g.host, "host", "", "邮件服务器地址")
+	fs.IntVar(&g.port, "port", 0, "邮件服务器端口，默认tls为993，其他为143")
+	fs.StringVar(&g.username, "user", "", "用户名")
+	fs.StringVar(&g.password, "password", "", "密码")
+	fs.StringVar(&g.security, "security", "", "连接方式：tls、starttls或者plain")
+	fs.StringVar(&g.auth, "auth", "", "认证方式：LOGIN、PLAIN、OAUTHBEARER或者EXTERNAL")
+	fs.StringVar(&g.token, "token", "", "OAUTHBEARER使用的access token")
+	fs.StringVar(&g.mailbox, "mailbox", "", "操作的邮箱，默认INBOX")
+	fs.BoolVar(&g.insecure, "insecure", false, "不校验服务器证书")
+	fs.BoolVar(&g.debug, "debug", false, "输出调试日志")
+	fs.Usage = usage(fs)
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知的命令: %s\n", fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	config, err := loadConfig(&g)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	i := zdpgo_imap.NewWithConfig(config)
+	defer i.Close()
+
+	// Ctrl+C 时停止正在执行的命令
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err = cmd.run(ctx, i, fs.Args()[1:]); err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, err)
+		i.Close()
+		os.Exit(1)
+	}
+}
+
+// loadConfig 依次读取配置文件、环境变量和命令行参数
+func loadConfig(g *globalFlags) (*zdpgo_imap.Config, error) {
+	config := &zdpgo_imap.Config{}
+	if g.config != "" {
+		data, err := ioutil.ReadFile(g.config)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("%s: %v", g.config, err)
+		}
+	}
+
+	env := func(dst *string, key string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	env(&config.Host, "ZDPGO_IMAP_HOST")
+	env(&config.Username, "ZDPGO_IMAP_USERNAME")
+	env(&config.Password, "ZDPGO_IMAP_PASSWORD")
+	env(&config.Security, "ZDPGO_IMAP_SECURITY")
+	env(&config.AuthMechanism, "ZDPGO_IMAP_AUTH")
+	env(&config.Token, "ZDPGO_IMAP_TOKEN")
+	if v := os.Getenv("ZDPGO_IMAP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("ZDPGO_IMAP_PORT: %v", err)
+		}
+		config.Port = port
+	}
+
+	flagValue := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	flagValue(&config.Host, g.host)
+	flagValue(&config.Username, g.username)
+	flagValue(&config.Password, g.password)
+	flagValue(&config.Security, g.security)
+	flagValue(&config.AuthMechanism, g.auth)
+	flagValue(&config.Token, g.token)
+	flagValue(&config.Mailbox, g.mailbox)
+	if g.port != 0 {
+		config.Port = g.port
+	}
+	if g.insecure {
+		config.InsecureSkipVerify = true
+	}
+	if g.debug {
+		config.Debug = true
+	}
+
+	if config.Host == "" {
+		return nil, fmt.Errorf("缺少邮件服务器地址，使用-host、ZDPGO_IMAP_HOST或者配置文件设置")
+	}
+	if config.Port == 0 {
+		config.Port = 993
+		if config.Security == zdpgo_imap.SecurityStartTLS || config.Security == zdpgo_imap.SecurityPlain {
+			config.Port = 143
+		}
+	}
+	return config, nil
+}
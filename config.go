@@ -9,11 +9,27 @@ package zdpgo_imap
 */
 
 type Config struct {
-	Debug       bool   `json:"debug"`
-	LogFilePath string `json:"log_file_path"`
-	Username    string `json:"username"`
-	Password    string `json:"password"`
-	Host        string `json:"host"`
-	Port        int    `json:"port"`
-	TmpDir      string `json:"tmp_dir"`
+	Debug              bool     `json:"debug"`
+	LogFilePath        string   `json:"log_file_path"`
+	Username           string   `json:"username"`
+	Password           string   `json:"password"`
+	Host               string   `json:"host"`
+	Port               int      `json:"port"`
+	Security           string   `json:"security"`             // 连接的安全方式，SecurityTLS(默认)、SecurityStartTLS或者SecurityPlain
+	DialTimeout        int      `json:"dial_timeout"`         // 连接超时时间，单位秒，0表示不超时
+	CAFile             string   `json:"ca_file"`              // 自定义的CA证书文件(PEM格式)，用于内网的服务器
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"` // 不校验服务器证书，只应该在测试环境中使用
+	CertFile           string   `json:"cert_file"`            // 客户端证书文件(PEM格式)
+	KeyFile            string   `json:"key_file"`             // 客户端证书私钥文件(PEM格式)
+	ServerName         string   `json:"server_name"`          // TLS的SNI和证书校验使用的名称，默认是Host
+	AuthMechanism      string   `json:"auth_mechanism"`       // 认证方式，AuthLogin、AuthPlain、AuthOAuthBearer或者AuthExternal，为空时自动选择
+	Token              string   `json:"token"`                // OAUTHBEARER认证使用的access token
+	TmpDir             string   `json:"tmp_dir"`
+	Mailbox            string   `json:"mailbox"`         // 默认搜索的邮箱，可以使用LIST通配符，例如"*"表示所有的邮箱
+	AttachmentMode     string   `json:"attachment_mode"` // 附件的处理模式，AttachmentModeMemory或者AttachmentModeDisk
+	SyncStateFile      string   `json:"sync_state_file"` // 增量同步状态保存的JSON文件
+	MaxConns           int      `json:"max_conns"`       // 每个账号最多同时打开的连接数量
+	KeyHeader          string   `json:"key_header"`      // Result.Key读取的邮件头，默认是DefaultKeyHeader
+	ExtraHeaders       []string `json:"extra_headers"`   // 需要额外保存到Result.Headers的邮件头
+	Compress           bool     `json:"compress"`        // 服务器支持COMPRESS=DEFLATE时压缩连接，适合带宽较小的链路
 }
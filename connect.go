@@ -0,0 +1,258 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+	"github.com/zhangdapeng520/zdpgo_imap/message/charset"
+	"github.com/zhangdapeng520/zdpgo_imap/sasl"
+)
+
+/*
+@Time : 2022/5/24 20:07
+@Author : 张大鹏
+@File : connect.go
+@Software: Goland2021.3.1
+@Description: 连接和登录邮件服务器
+*/
+
+// 连接的安全方式
+const (
+	SecurityTLS      = "tls"      // 直接使用TLS连接，默认的方式，一般是993端口
+	SecurityStartTLS = "starttls" // 先使用明文连接，再使用STARTTLS升级为TLS，一般是143端口
+	SecurityPlain    = "plain"    // 明文连接，只应该在内网中使用
+)
+
+// 登录的认证方式
+const (
+	AuthAuto        = ""            // 根据服务器支持的AUTH=能力自动选择
+	AuthLogin       = "LOGIN"       // 服务器支持AUTH=LOGIN时使用SASL LOGIN，否则使用LOGIN命令
+	AuthPlain       = "PLAIN"       // SASL PLAIN
+	AuthOAuthBearer = "OAUTHBEARER" // SASL OAUTHBEARER，使用Config.Token
+	AuthExternal    = "EXTERNAL"    // SASL EXTERNAL，一般和客户端证书一起使用
+)
+
+// dial 创建一个新的连接并登录邮件服务器，ctx结束时停止连接
+func (i *Imap) dial(ctx context.Context) (c *client.Client, err error) {
+	// 【字符集】  处理us-ascii和utf-8以外的字符集(例如gbk,gb2313等)时, 需要加上这行代码。
+	// 【参考】 https://github.com/zhangdapeng520/zdpgo_imap/imap/wiki/Charset-handling
+	imap.CharsetReader = charset.Reader
+
+	tlsConfig, err := i.tlsConfig()
+	if err != nil {
+		i.Log.Error("加载TLS配置失败", "error", err)
+		return nil, newError(ErrTLS, "load tls config", err)
+	}
+
+	// 连接邮件服务器
+	address := fmt.Sprintf("%s:%d", i.Config.Host, i.Config.Port)
+	dialer := &contextDialer{ctx: ctx}
+	dialer.dialer.Timeout = time.Duration(i.Config.DialTimeout) * time.Second
+	defer func() {
+		// 连接过程中ctx结束时连接已经被关闭，返回ctx的错误
+		if ctxErr := dialer.stop(); ctxErr != nil {
+			err = newError(ErrConnection, "dial "+address, ctxErr)
+		}
+	}()
+
+	switch strings.ToLower(i.Config.Security) {
+	case SecurityTLS, "":
+		c, err = client.DialWithDialerTLS(dialer, address, tlsConfig)
+	case SecurityStartTLS:
+		if c, err = client.DialWithDialer(dialer, address); err == nil {
+			if err = c.StartTLS(tlsConfig); err != nil {
+				err = newError(ErrTLS, "STARTTLS", err)
+			}
+		}
+	case SecurityPlain:
+		c, err = client.DialWithDialer(dialer, address)
+	default:
+		err = fmt.Errorf("imap: unknown security %q", i.Config.Security)
+	}
+	if err != nil {
+		i.Log.Error("连接邮件服务器失败", "error", err, "address", address)
+		if dialer.connected && isTLSError(err) {
+			return c, newError(ErrTLS, "dial "+address, err)
+		}
+		return c, newError(ErrConnection, "dial "+address, err)
+	}
+
+	// 登录
+	if err = i.authenticate(c); err != nil {
+		i.Log.Error("登录邮件服务器失败", "error", err, "username", i.Config.Username)
+		return c, newError(ErrAuth, "authenticate "+i.Config.Username, err)
+	}
+
+	// 登录之后再压缩，服务器不支持时不压缩
+	if i.Config.Compress {
+		ok, err := c.SupportCompress(imap.CompressDeflate)
+		if err == nil && ok {
+			err = c.Compress(imap.CompressDeflate)
+		}
+		if err != nil {
+			i.Log.Error("压缩连接失败", "error", err)
+			return c, newError(ErrConnection, "COMPRESS", err)
+		}
+	}
+	return c, nil
+}
+
+// tlsConfig 根据配置生成TLS配置
+func (i *Imap) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         i.Config.ServerName,
+		InsecureSkipVerify: i.Config.InsecureSkipVerify,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = i.Config.Host
+	}
+
+	// 自定义的CA证书，用于内网自签名证书的服务器
+	if i.Config.CAFile != "" {
+		pem, err := ioutil.ReadFile(i.Config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("imap: no certificate found in %s", i.Config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// 客户端证书
+	if i.Config.CertFile != "" || i.Config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(i.Config.CertFile, i.Config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// authenticate 使用配置的认证方式登录，没有配置时根据服务器的AUTH=能力自动选择
+func (i *Imap) authenticate(c *client.Client) error {
+	if c.State() == imap.AuthenticatedState {
+		// 服务器通过PREAUTH已经认证了连接
+		return nil
+	}
+
+	mech := strings.ToUpper(i.Config.AuthMechanism)
+	if mech == AuthAuto {
+		var err error
+		if mech, err = i.selectAuthMechanism(c); err != nil {
+			return err
+		}
+	}
+
+	switch mech {
+	case AuthLogin:
+		if ok, err := c.SupportAuth(AuthLogin); err != nil {
+			return err
+		} else if ok {
+			return c.Authenticate(sasl.NewLoginClient(i.Config.Username, i.Config.Password))
+		}
+		return c.Login(i.Config.Username, i.Config.Password)
+	case AuthPlain:
+		return c.Authenticate(sasl.NewPlainClient("", i.Config.Username, i.Config.Password))
+	case AuthOAuthBearer:
+		return c.Authenticate(sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{
+			Username: i.Config.Username,
+			Token:    i.Config.Token,
+			Host:     i.Config.Host,
+			Port:     i.Config.Port,
+		}))
+	case AuthExternal:
+		return c.Authenticate(sasl.NewExternalClient(i.Config.Username))
+	default:
+		return fmt.Errorf("imap: unknown auth mechanism %q", i.Config.AuthMechanism)
+	}
+}
+
+// selectAuthMechanism 根据配置和服务器支持的AUTH=能力选择认证方式
+func (i *Imap) selectAuthMechanism(c *client.Client) (string, error) {
+	var candidates []string
+	if i.Config.Token != "" {
+		candidates = append(candidates, AuthOAuthBearer)
+	}
+	if i.Config.CertFile != "" && i.Config.Password == "" {
+		candidates = append(candidates, AuthExternal)
+	}
+	if i.Config.Password != "" {
+		candidates = append(candidates, AuthPlain)
+	}
+
+	for _, mech := range candidates {
+		if ok, err := c.SupportAuth(mech); err != nil {
+			return "", err
+		} else if ok {
+			return mech, nil
+		}
+	}
+
+	// 服务器没有声明可用的SASL认证方式时，使用LOGIN命令
+	return AuthLogin, nil
+}
+
+// contextDialer 使用ctx建立TCP连接的拨号器
+// 调用stop之前ctx结束时关闭连接，中止TLS握手、读取问候语、STARTTLS和登录
+type contextDialer struct {
+	ctx       context.Context
+	dialer    net.Dialer
+	connected bool // TCP连接是否已经建立，用于区分连接错误和TLS错误
+
+	done    chan struct{}
+	aborted chan bool
+}
+
+func (d *contextDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(d.ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	d.connected = true
+
+	d.done = make(chan struct{})
+	d.aborted = make(chan bool, 1)
+	go func() {
+		select {
+		case <-d.ctx.Done():
+			conn.Close()
+			d.aborted <- true
+		case <-d.done:
+			d.aborted <- false
+		}
+	}()
+
+	// 读取服务器问候语时还没有客户端的超时设置，使用连接超时作为期限
+	if d.dialer.Timeout > 0 {
+		if err = conn.SetDeadline(time.Now().Add(d.dialer.Timeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// stop 停止监听ctx，之后ctx结束不会再关闭连接。连接已经因为ctx结束被关闭时返回ctx的错误
+func (d *contextDialer) stop() error {
+	if d.done == nil {
+		return nil
+	}
+	close(d.done)
+	d.done = nil
+	if <-d.aborted {
+		return d.ctx.Err()
+	}
+	return nil
+}
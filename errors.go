@@ -0,0 +1,109 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:07
+@Author : 张大鹏
+@File : errors.go
+@Software: Goland2021.3.1
+@Description: 错误模型
+*/
+
+// 错误的类型，使用errors.Is判断，例如errors.Is(err, ErrAuth)
+var (
+	ErrConnection      = errors.New("imap: connection error")
+	ErrTLS             = errors.New("imap: tls error")
+	ErrAuth            = errors.New("imap: authentication failed")
+	ErrMailboxNotFound = errors.New("imap: mailbox not found")
+	ErrServer          = errors.New("imap: server error")
+	ErrProtocol        = errors.New("imap: protocol error")
+)
+
+// Error 包装库中所有方法返回的错误
+// 使用errors.Is(err, ErrXxx)判断错误类型，使用errors.As获取*Error查看出错的操作和服务器的响应
+type Error struct {
+	Kind error            // 错误的类型，ErrConnection、ErrTLS等
+	Op   string           // 出错的操作，例如"SELECT INBOX"
+	Resp *imap.StatusResp // 服务器返回的NO或者BAD响应，没有时为nil
+	Err  error            // 原始的错误
+}
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%v: %s: %v", e.Kind, e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// newError 使用kind包装错误，已经包装过的错误和ctx的错误保持不变
+func newError(kind error, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	e = &Error{Kind: kind, Op: op, Err: err}
+	var statusErr *imap.ErrStatusResp
+	if errors.As(err, &statusErr) {
+		e.Resp = statusErr.Resp
+	}
+	return e
+}
+
+// commandError 根据错误的原因包装执行命令时的错误：
+// 服务器的NO/BAD响应为ErrServer，连接断开为ErrConnection，其他的为ErrProtocol(例如响应解析失败)
+func commandError(c *client.Client, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var statusErr *imap.ErrStatusResp
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return newError(ErrServer, op, err)
+	case errors.As(err, &netErr), err == io.EOF, c != nil && c.State() == imap.LogoutState:
+		return newError(ErrConnection, op, err)
+	default:
+		return newError(ErrProtocol, op, err)
+	}
+}
+
+// isTLSError 判断是否是TLS握手或者证书校验的错误
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return true
+	}
+	return strings.Contains(err.Error(), "tls: ")
+}
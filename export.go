@@ -0,0 +1,490 @@
+package zdpgo_imap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : export.go
+@Software: Goland2021.3.1
+@Description: 导出邮箱中的邮件为EML文件、mbox文件或者Maildir目录
+*/
+
+const (
+	ExportFormatEML     = "eml"     // 每封邮件保存为一个.eml文件
+	ExportFormatMbox    = "mbox"    // 所有的邮件保存在一个mboxrd格式的文件中
+	ExportFormatMaildir = "maildir" // Maildir目录，邮件标志保存在文件名中
+)
+
+// exportStateFile 导出进度文件的名称，用于中断后继续导出
+const exportStateFile = ".zdpgo_imap_export.json"
+
+// maildirFlags IMAP标志和Maildir文件名中标志的对应关系，按Maildir标志的字母顺序排列
+var maildirFlags = []struct {
+	flag string
+	char byte
+}{
+	{imap.DraftFlag, 'D'},
+	{imap.FlaggedFlag, 'F'},
+	{"$Forwarded", 'P'},
+	{imap.AnsweredFlag, 'R'},
+	{imap.SeenFlag, 'S'},
+	{imap.DeletedFlag, 'T'},
+}
+
+// ExportResult 一次导出的结果
+type ExportResult struct {
+	Mailbox     string `json:"mailbox"`
+	Format      string `json:"format"`
+	Dest        string `json:"dest"`
+	UidValidity uint32 `json:"uid_validity"`
+	LastUid     uint32 `json:"last_uid"` // 已经导出的最大UID
+	Exported    int    `json:"exported"` // 本次导出的邮件数量
+	Skipped     int    `json:"skipped"`  // 之前已经导出，本次跳过的邮件数量
+}
+
+// exportState 导出进度，每导出一批邮件保存一次
+type exportState struct {
+	Mailbox     string `json:"mailbox"`
+	Format      string `json:"format"`
+	UidValidity uint32 `json:"uid_validity"`
+	LastUid     uint32 `json:"last_uid"`
+	Offset      int64  `json:"offset"` // mbox文件中已经完整写入的长度
+}
+
+// exportSection 使用BODY.PEEK[]抓取整封邮件，不会给邮件设置\Seen标志
+var exportSection = &imap.BodySectionName{Peek: true}
+
+// exportWriter 导出邮件的写入器
+type exportWriter interface {
+	// Write 写入一封邮件，返回false表示邮件之前已经导出
+	Write(msg *imap.Message, body io.Reader) (bool, error)
+	// Sync 将已经写入的邮件保存到磁盘，并在state中记录恢复时需要的信息
+	Sync(state *exportState) error
+	Close() error
+}
+
+// Export 导出mailbox中的所有邮件到dest
+// format为ExportFormatEML或ExportFormatMaildir时dest是目录，为ExportFormatMbox时dest是文件
+// 使用BODY.PEEK[]分批抓取邮件，不会给邮件设置\Seen标志。导出进度按UID保存，中断后再次调用会从上次的位置继续
+func (i *Imap) Export(mailbox, format, dest string) (*ExportResult, error) {
+	return i.ExportContext(context.Background(), mailbox, format, dest)
+}
+
+// ExportContext 和Export相同，ctx结束时中止导出，已经导出的邮件会保存进度
+func (i *Imap) ExportContext(ctx context.Context, mailbox, format, dest string) (*ExportResult, error) {
+	var statePath string
+	switch format {
+	case ExportFormatEML, ExportFormatMaildir:
+		statePath = filepath.Join(dest, exportStateFile)
+	case ExportFormatMbox:
+		statePath = dest + exportStateFile
+	default:
+		return nil, fmt.Errorf("unknown export format: %q", format)
+	}
+
+	state, err := readExportState(statePath)
+	if err != nil {
+		i.Log.Error("读取导出进度失败", "error", err, "path", statePath)
+		return nil, err
+	}
+	if state.Mailbox != "" && (state.Mailbox != mailbox || state.Format != format) {
+		return nil, fmt.Errorf("%s already contains an export of %q in %s format", dest, state.Mailbox, state.Format)
+	}
+	state.Mailbox = mailbox
+	state.Format = format
+
+	result := &ExportResult{Mailbox: mailbox, Format: format, Dest: dest}
+	err = i.withClient(ctx, func(c *client.Client) error {
+		return i.export(ctx, c, state, statePath, dest, result)
+	})
+	result.UidValidity = state.UidValidity
+	result.LastUid = state.LastUid
+	return result, err
+}
+
+func (i *Imap) export(ctx context.Context, c *client.Client, state *exportState, statePath, dest string, result *ExportResult) error {
+	mbox, err := i.selectMailbox(ctx, c, state.Mailbox)
+	if err != nil {
+		return err
+	}
+
+	// UIDVALIDITY改变后原来的UID不再有效，重新导出所有的邮件
+	// 文件名中包含UIDVALIDITY，不会覆盖之前导出的邮件
+	if state.UidValidity != mbox.UidValidity {
+		if state.UidValidity != 0 {
+			i.Log.Warning("邮箱的UIDVALIDITY已改变，重新导出所有的邮件", "mailbox", state.Mailbox,
+				"old", state.UidValidity, "new", mbox.UidValidity)
+		}
+		state.UidValidity = mbox.UidValidity
+		state.LastUid = 0
+	}
+
+	// 只搜索上次导出之后的邮件
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(state.LastUid+1, 0)
+	found, err := c.UidSearchContext(ctx, criteria)
+	if err != nil {
+		i.Log.Error("搜索邮件失败", "error", err)
+		return commandError(c, "UID SEARCH", err)
+	}
+	var uids []uint32
+	for _, uid := range found {
+		// "n:*"总是包含最大的UID，即使它小于n
+		if uid > state.LastUid {
+			uids = append(uids, uid)
+		}
+	}
+	sortUidsAsc(uids)
+
+	w, err := newExportWriter(state, dest)
+	if err != nil {
+		i.Log.Error("创建导出文件失败", "error", err, "dest", dest)
+		return err
+	}
+	defer w.Close()
+
+	// 抓取UID才能把结果和请求对应起来
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchFlags, imap.FetchInternalDate, exportSection.FetchItem()}
+	for start := 0; start < len(uids); start += fetchBatchSize {
+		end := start + fetchBatchSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+
+		if err = i.exportBatch(ctx, c, w, uids[start:end], items, result); err != nil {
+			return err
+		}
+
+		// 每一批邮件写入磁盘后保存进度
+		state.LastUid = uids[end-1]
+		if err = w.Sync(state); err != nil {
+			return err
+		}
+		if err = writeJSONFile(statePath, state); err != nil {
+			i.Log.Error("保存导出进度失败", "error", err, "path", statePath)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportBatch 抓取一批邮件，每收到一封邮件就立即写入w，不会把整批邮件的内容同时保存在内存中
+func (i *Imap) exportBatch(ctx context.Context, c *client.Client, w exportWriter, uids []uint32, items []imap.FetchItem, result *ExportResult) error {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+
+	// 写入失败时取消抓取，不再下载剩下的邮件
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetchContext(fetchCtx, seqSet, items, ch)
+	}()
+
+	var writeErr error
+	received := make(map[uint32]bool, len(uids))
+	for msg := range ch {
+		if writeErr != nil {
+			// 继续读取信道，直到抓取结束
+			continue
+		}
+		received[msg.Uid] = true
+
+		body := msg.GetBody(exportSection)
+		if body == nil {
+			writeErr = newError(ErrProtocol, "UID FETCH", fmt.Errorf("message %d has no body", msg.Uid))
+			cancel()
+			continue
+		}
+		written, err := w.Write(msg, body)
+		if err != nil {
+			i.Log.Error("写入邮件失败", "error", err, "uid", msg.Uid)
+			writeErr = err
+			cancel()
+			continue
+		}
+		if written {
+			result.Exported++
+		} else {
+			result.Skipped++
+		}
+	}
+	err := <-done
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		i.Log.Error("批量抓取邮件失败", "error", err, "seqSet", seqSet)
+		return commandError(c, "UID FETCH", err)
+	}
+
+	for _, uid := range uids {
+		if !received[uid] {
+			// 抓取期间邮件已经被删除
+			i.Log.Warning("邮件服务器没有返回消息内容", "uid", uid)
+		}
+	}
+	return nil
+}
+
+// readExportState 读取导出进度，没有导出过时返回空的进度
+func readExportState(path string) (*exportState, error) {
+	state := &exportState{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func newExportWriter(state *exportState, dest string) (exportWriter, error) {
+	switch state.Format {
+	case ExportFormatEML:
+		return newEMLWriter(dest, state.UidValidity)
+	case ExportFormatMbox:
+		return newMboxWriter(dest, state.Offset)
+	case ExportFormatMaildir:
+		return newMaildirWriter(dest, state.UidValidity)
+	}
+	return nil, fmt.Errorf("unknown export format: %q", state.Format)
+}
+
+// writeFileAtomic 先写入tmp再重命名为path，中断时不会留下不完整的文件
+func writeFileAtomic(tmp, path string, r io.Reader, modTime time.Time) error {
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if !modTime.IsZero() {
+		os.Chtimes(tmp, modTime, modTime)
+	}
+	return os.Rename(tmp, path)
+}
+
+// emlWriter 每封邮件保存为一个"UIDVALIDITY_UID.eml"文件
+type emlWriter struct {
+	dir         string
+	uidValidity uint32
+}
+
+func newEMLWriter(dir string, uidValidity uint32) (*emlWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &emlWriter{dir: dir, uidValidity: uidValidity}, nil
+}
+
+func (w *emlWriter) Write(msg *imap.Message, body io.Reader) (bool, error) {
+	name := fmt.Sprintf("%d_%d.eml", w.uidValidity, msg.Uid)
+	path := filepath.Join(w.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+	err := writeFileAtomic(filepath.Join(w.dir, "."+name+".tmp"), path, body, msg.InternalDate)
+	return err == nil, err
+}
+
+func (w *emlWriter) Sync(state *exportState) error {
+	return nil
+}
+
+func (w *emlWriter) Close() error {
+	return nil
+}
+
+// mboxWriter 将邮件追加到mboxrd格式的文件中
+type mboxWriter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// newMboxWriter 打开mbox文件，丢弃上次中断时offset之后没有完整写入的内容
+// offset是导出进度中记录的长度，为0表示还没有导出过，这时不会修改已经存在的非空文件
+func newMboxWriter(path string, offset int64) (*mboxWriter, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		switch {
+		case offset == 0 && info.Size() > 0:
+			err = fmt.Errorf("%s already exists and is not an unfinished export, remove it or choose another path", path)
+		case info.Size() < offset:
+			// 文件在上次导出之后被修改或者替换了
+			err = fmt.Errorf("%s is shorter than the saved export progress (%d < %d bytes)", path, info.Size(), offset)
+		default:
+			if err = f.Truncate(offset); err == nil {
+				_, err = f.Seek(offset, io.SeekStart)
+			}
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &mboxWriter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Write 写入"From "分隔行和邮件内容
+// 按照mboxrd格式，内容中以">*From "开头的行前面再添加一个">"，换行统一为LF
+func (w *mboxWriter) Write(msg *imap.Message, body io.Reader) (bool, error) {
+	sender := "MAILER-DAEMON"
+	if msg.Envelope != nil && len(msg.Envelope.From) > 0 {
+		if addr := msg.Envelope.From[0].Address(); addr != "" && !strings.ContainsAny(addr, " \t") {
+			sender = addr
+		}
+	}
+	date := msg.InternalDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	if _, err := fmt.Fprintf(w.w, "From %s %s\n", sender, date.UTC().Format(time.ANSIC)); err != nil {
+		return false, err
+	}
+
+	r := bufio.NewReader(body)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+			if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+				w.w.WriteByte('>')
+			}
+			w.w.Write(line)
+			if _, werr := w.w.WriteString("\n"); werr != nil {
+				return false, werr
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	// 邮件之间使用空行分隔
+	_, err := w.w.WriteString("\n")
+	return err == nil, err
+}
+
+func (w *mboxWriter) Sync(state *exportState) error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	offset, err := w.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	state.Offset = offset
+	return nil
+}
+
+func (w *mboxWriter) Close() error {
+	return w.f.Close()
+}
+
+// maildirWriter 将邮件保存到Maildir的cur目录，文件名为"时间.UIDVALIDITY_UID.zdpgo_imap:2,标志"
+type maildirWriter struct {
+	dir         string
+	uidValidity uint32
+	existing    map[string]bool // 已经存在的邮件，文件名中":"之前的部分
+}
+
+func newMaildirWriter(dir string, uidValidity uint32) (*maildirWriter, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "cur"))
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(files))
+	for _, file := range files {
+		existing[strings.SplitN(file.Name(), ":", 2)[0]] = true
+	}
+	return &maildirWriter{dir: dir, uidValidity: uidValidity, existing: existing}, nil
+}
+
+func (w *maildirWriter) Write(msg *imap.Message, body io.Reader) (bool, error) {
+	key := fmt.Sprintf("%d.%d_%d.zdpgo_imap", msg.InternalDate.Unix(), w.uidValidity, msg.Uid)
+	if w.existing[key] {
+		return false, nil
+	}
+
+	name := key + ":2," + maildirInfo(msg.Flags)
+	err := writeFileAtomic(filepath.Join(w.dir, "tmp", key), filepath.Join(w.dir, "cur", name), body, msg.InternalDate)
+	if err != nil {
+		return false, err
+	}
+	w.existing[key] = true
+	return true, nil
+}
+
+func (w *maildirWriter) Sync(state *exportState) error {
+	return nil
+}
+
+func (w *maildirWriter) Close() error {
+	return nil
+}
+
+// maildirInfo 将IMAP标志转换为Maildir文件名中的标志
+func maildirInfo(flags []string) string {
+	var info []byte
+	for _, f := range maildirFlags {
+		for _, flag := range flags {
+			if strings.EqualFold(flag, f.flag) {
+				info = append(info, f.char)
+				break
+			}
+		}
+	}
+	return string(info)
+}
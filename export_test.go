@@ -0,0 +1,262 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend/memory"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+var mboxTests = []struct {
+	name string
+	body string
+	want string // 写入mbox文件的内容，不包含"From "分隔行
+}{
+	{
+		name: "plain",
+		body: "Subject: a\r\n\r\nhello\r\n",
+		want: "Subject: a\n\nhello\n\n",
+	},
+	{
+		name: "from line",
+		body: "Subject: b\r\n\r\nFrom here\r\nnot From\r\n",
+		want: "Subject: b\n\n>From here\nnot From\n\n",
+	},
+	{
+		name: "quoted from line",
+		body: "Subject: c\r\n\r\n>From here\r\n>>From there\r\n>Fromage\r\n",
+		want: "Subject: c\n\n>>From here\n>>>From there\n>Fromage\n\n",
+	},
+	{
+		name: "no trailing newline",
+		body: "Subject: d\r\n\r\nFrom",
+		want: "Subject: d\n\nFrom\n\n",
+	},
+	{
+		name: "lf line endings",
+		body: "Subject: e\n\nline\n\nFrom x\n",
+		want: "Subject: e\n\nline\n\n>From x\n\n",
+	},
+}
+
+func TestMboxWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zdpgo_imap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	date := time.Date(2022, 5, 24, 20, 8, 0, 0, time.UTC)
+	for n, test := range mboxTests {
+		path := filepath.Join(dir, test.name+".mbox")
+		w, err := newMboxWriter(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &imap.Message{
+			Uid:          uint32(n + 1),
+			InternalDate: date,
+			Envelope: &imap.Envelope{
+				From: []*imap.Address{{MailboxName: "sender", HostName: "example.org"}},
+			},
+		}
+		if _, err = w.Write(msg, strings.NewReader(test.body)); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Sync(&exportState{}); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "From sender@example.org Tue May 24 20:08:00 2022\n" + test.want
+		if string(data) != want {
+			t.Errorf("%s: mbox = %q, want %q", test.name, data, want)
+		}
+	}
+}
+
+func TestWalkMbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zdpgo_imap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 所有的邮件写入同一个mbox文件，再读取出来
+	path := filepath.Join(dir, "all.mbox")
+	w, err := newMboxWriter(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2022, 5, 24, 20, 8, 0, 0, time.UTC)
+	for n, test := range mboxTests {
+		msg := &imap.Message{Uid: uint32(n + 1), InternalDate: date.Add(time.Duration(n) * time.Minute)}
+		if _, err = w.Write(msg, strings.NewReader(test.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Sync(&exportState{}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	var messages []*importMessage
+	err = walkMbox(path, func(m *importMessage) error {
+		messages = append(messages, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(mboxTests) {
+		t.Fatalf("walkMbox() read %d messages, want %d", len(messages), len(mboxTests))
+	}
+	for n, test := range mboxTests {
+		want := string(toCRLF([]byte(test.body)))
+		if !strings.HasSuffix(want, "\r\n") {
+			want += "\r\n"
+		}
+		if string(messages[n].data) != want {
+			t.Errorf("%s: message = %q, want %q", test.name, messages[n].data, want)
+		}
+		if d := date.Add(time.Duration(n) * time.Minute); !messages[n].fromDate.Equal(d) {
+			t.Errorf("%s: date = %v, want %v", test.name, messages[n].fromDate, d)
+		}
+	}
+}
+
+func TestNewMboxWriterExisting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zdpgo_imap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const content = "From a Tue May 24 20:08:00 2022\nSubject: a\n\nhello\n\n"
+	tests := []struct {
+		name    string
+		offset  int64
+		wantErr bool
+		want    string
+	}{
+		{name: "existing archive", offset: 0, wantErr: true, want: content},
+		{name: "shorter than progress", offset: int64(len(content)) + 1, wantErr: true, want: content},
+		{name: "resume", offset: int64(len(content)), want: content},
+		{name: "resume after partial write", offset: 10, want: content[:10]},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, strings.Replace(test.name, " ", "_", -1)+".mbox")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		w, err := newMboxWriter(path, test.offset)
+		if test.wantErr {
+			if err == nil {
+				w.Close()
+				t.Errorf("%s: newMboxWriter() succeeded, want an error", test.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: newMboxWriter() = %v", test.name, err)
+			continue
+		} else {
+			w.Close()
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("%s: file = %q, want %q", test.name, data, test.want)
+		}
+	}
+}
+
+func TestImap_ExportEML(t *testing.T) {
+	i := newTestImap(t, memory.New())
+	appendTestMessages(t, i, "INBOX", "Subject: a\n\na\n", "Subject: b\n\nb\n")
+	dir := t.TempDir()
+
+	result, err := i.Export("INBOX", ExportFormatEML, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// memory后端中已有一封UID为6的邮件
+	if result.Exported != 3 || result.LastUid != 8 {
+		t.Errorf("Export() exported %d messages up to UID %d, want 3 up to 8", result.Exported, result.LastUid)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "1_8.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Subject: b\r\n\r\nb\r\n" {
+		t.Errorf("1_8.eml = %q", data)
+	}
+
+	// 再次导出时只导出新的邮件
+	appendTestMessages(t, i, "INBOX", "Subject: c\n\nc\n")
+	if result, err = i.Export("INBOX", ExportFormatEML, dir); err != nil {
+		t.Fatal(err)
+	}
+	if result.Exported != 1 || result.LastUid != 9 {
+		t.Errorf("Export() again exported %d messages up to UID %d, want 1 up to 9", result.Exported, result.LastUid)
+	}
+}
+
+// failingExportWriter 记录写入的邮件，写入第fail封邮件时返回错误
+type failingExportWriter struct {
+	fail int
+	uids []uint32
+}
+
+func (w *failingExportWriter) Write(msg *imap.Message, body io.Reader) (bool, error) {
+	if len(w.uids) == w.fail {
+		return false, errors.New("disk full")
+	}
+	w.uids = append(w.uids, msg.Uid)
+	return true, nil
+}
+
+func (w *failingExportWriter) Sync(state *exportState) error { return nil }
+func (w *failingExportWriter) Close() error                  { return nil }
+
+func TestImap_ExportBatchWriteError(t *testing.T) {
+	i := newTestImap(t, memory.New())
+	appendTestMessages(t, i, "INBOX", "Subject: a\n\na\n", "Subject: b\n\nb\n")
+
+	items := []imap.FetchItem{imap.FetchUid, exportSection.FetchItem()}
+	err := i.withClient(context.Background(), func(c *client.Client) error {
+		if _, err := i.selectMailbox(context.Background(), c, "INBOX"); err != nil {
+			return err
+		}
+		// 写入失败后不再写入剩下的邮件，也不会阻塞抓取
+		w := &failingExportWriter{fail: 1}
+		result := &ExportResult{}
+		err := i.exportBatch(context.Background(), c, w, []uint32{6, 7, 8}, items, result)
+		if err == nil || err.Error() != "disk full" {
+			t.Errorf("exportBatch() = %v, want the write error", err)
+		}
+		if len(w.uids) != 1 || result.Exported != 1 {
+			t.Errorf("exportBatch() wrote %v, exported %d, want a single message", w.uids, result.Exported)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
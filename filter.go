@@ -0,0 +1,189 @@
+package zdpgo_imap
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : filter.go
+@Software: Goland2021.3.1
+@Description: 在本地使用imap.SearchCriteria过滤已经获取的结果，语义和服务器的SEARCH相同
+*/
+
+// FilterResults 在本地使用criteria过滤结果，不访问服务器
+// 结果中缺少判断需要的数据时(例如只获取了邮件头，却要搜索正文)，结果放在undecidable中
+func (i *Imap) FilterResults(results []*Result, criteria *imap.SearchCriteria) (matched, undecidable []*Result) {
+	for _, result := range results {
+		switch criteria.MatchMessage(i.resultMessage(result)) {
+		case imap.MatchTrue:
+			matched = append(matched, result)
+		case imap.MatchUndecidable:
+			undecidable = append(undecidable, result)
+		}
+	}
+	return matched, undecidable
+}
+
+// Filter 使用criteria过滤结果，本地无法判断的结果使用UID SEARCH交给服务器判断，返回的结果保持原来的顺序
+func (i *Imap) Filter(ctx context.Context, results []*Result, criteria *imap.SearchCriteria) ([]*Result, error) {
+	matched, undecidable := i.FilterResults(results, criteria)
+	if len(undecidable) == 0 {
+		return matched, nil
+	}
+
+	groups, err := i.groupByMailbox(undecidable)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[*Result]bool, len(results))
+	for _, result := range matched {
+		keep[result] = true
+	}
+	for _, group := range groups {
+		err = i.withClientRetry(ctx, func(c *client.Client) error {
+			if _, err := i.selectMailbox(ctx, c, group.mailbox); err != nil {
+				return err
+			}
+
+			// 只在这些邮件中搜索
+			only := imap.NewSearchCriteria()
+			only.Uid = uidSet(group.uids)
+			mergeCriteria(only, criteria)
+			uids, err := c.UidSearchContext(ctx, only)
+			if err != nil {
+				i.Log.Error("搜索邮件失败", "error", err, "mailbox", group.mailbox)
+				return commandError(c, "UID SEARCH", err)
+			}
+
+			found := make(map[uint32]bool, len(uids))
+			for _, uid := range uids {
+				found[uid] = true
+			}
+			for _, result := range group.results {
+				if found[result.Uid] {
+					keep[result] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filtered []*Result
+	for _, result := range results {
+		if keep[result] {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered, nil
+}
+
+// resultMessage 将结果转换为imap.Message，只包含结果中已有的数据
+func (i *Imap) resultMessage(r *Result) *imap.Message {
+	msg := &imap.Message{
+		SeqNum:       r.SeqNum,
+		Uid:          r.Uid,
+		InternalDate: r.DateTime,
+		Size:         r.Size,
+		Flags:        r.Flags,
+		Items:        make(map[imap.FetchItem]interface{}),
+		Body:         make(map[*imap.BodySectionName]imap.Literal),
+	}
+	// 结果中的标志和大小总是从服务器获取的
+	msg.Items[imap.FetchFlags] = nil
+	msg.Items[imap.FetchRFC822Size] = nil
+	if msg.Flags == nil {
+		msg.Flags = []string{}
+	}
+
+	msg.Envelope = &imap.Envelope{
+		Date:      r.SentDate,
+		Subject:   r.Title,
+		From:      imapAddressList(r.FromList),
+		ReplyTo:   imapAddressList(r.ReplyTo),
+		To:        imapAddressList(r.To),
+		Cc:        imapAddressList(r.Cc),
+		Bcc:       imapAddressList(r.Bcc),
+		InReplyTo: formatMsgIDs(r.InReplyTo),
+	}
+	if r.Sender != nil {
+		msg.Envelope.Sender = imapAddressList([]*Address{r.Sender})
+	}
+	if r.MessageID != "" {
+		msg.Envelope.MessageId = "<" + r.MessageID + ">"
+	}
+
+	// 保存在结果中的其他邮件头
+	var header bytes.Buffer
+	fields := []string{"References"}
+	if len(r.References) > 0 {
+		header.WriteString("References: " + formatMsgIDs(r.References) + "\r\n")
+	}
+	if i.Config.KeyHeader != "" {
+		fields = append(fields, i.Config.KeyHeader)
+		if r.Key != "" {
+			header.WriteString(i.Config.KeyHeader + ": " + r.Key + "\r\n")
+		}
+	}
+	for _, key := range i.Config.ExtraHeaders {
+		fields = append(fields, key)
+		for _, value := range r.Headers[key] {
+			header.WriteString(key + ": " + value + "\r\n")
+		}
+	}
+
+	// 只有获取了正文的结果才能搜索正文
+	text := r.TextBody
+	if r.HTMLBody != "" {
+		text += "\r\n" + r.HTMLBody
+	}
+	if text == "" {
+		text = r.Body
+	}
+	if text != "" {
+		fields = append(fields, "Content-Type", "Content-Transfer-Encoding")
+		header.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		msg.Body[&imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.TextSpecifier}}] = bytes.NewBufferString(text)
+	}
+
+	header.WriteString("\r\n")
+	section := &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier, Fields: fields},
+	}
+	msg.Body[section] = bytes.NewBuffer(header.Bytes())
+	return msg
+}
+
+// imapAddressList 将Address转换为imap.Address
+func imapAddressList(addrs []*Address) []*imap.Address {
+	var list []*imap.Address
+	for _, addr := range addrs {
+		if addr == nil {
+			continue
+		}
+		mailbox, host := addr.Email, ""
+		if n := strings.LastIndexByte(addr.Email, '@'); n >= 0 {
+			mailbox, host = addr.Email[:n], addr.Email[n+1:]
+		}
+		list = append(list, &imap.Address{PersonalName: addr.Name, MailboxName: mailbox, HostName: host})
+	}
+	return list
+}
+
+// formatMsgIDs 将Message-ID列表转换为邮件头中的格式
+func formatMsgIDs(ids []string) string {
+	var list []string
+	for _, id := range ids {
+		list = append(list, "<"+id+">")
+	}
+	return strings.Join(list, " ")
+}
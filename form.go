@@ -12,17 +12,61 @@ import "time"
 
 type Result struct {
 	From        string              `json:"from"`
+	FromName    string              `json:"from_name"` // 第一个发件人的显示名称
+	FromList    []*Address          `json:"from_list"` // 所有的发件人
+	Sender      *Address            `json:"sender"`    // Sender头，代替发件人发送邮件的地址
+	ReplyTo     []*Address          `json:"reply_to"`
 	ToEmails    []string            `json:"to_emails"`
 	CcEmails    []string            `json:"cc_emails"`
 	BccEmails   []string            `json:"bcc_emails"`
+	To          []*Address          `json:"to"` // 带显示名称的收件人
+	Cc          []*Address          `json:"cc"`
+	Bcc         []*Address          `json:"bcc"`
 	Date        int                 `json:"date"`
 	DateStr     string              `json:"date_str"`
-	DateTime    time.Time           `json:"date_time"`
-	Key         string              `json:"key"`
+	DateTime    time.Time           `json:"date_time"`   // 邮件到达服务器的时间(INTERNALDATE)
+	SentDate    time.Time           `json:"sent_date"`   // 邮件头中的Date，发件人发送的时间
+	MessageID   string              `json:"message_id"`  // Message-ID，不包含尖括号
+	InReplyTo   []string            `json:"in_reply_to"` // 回复的邮件的Message-ID
+	References  []string            `json:"references"`  // 同一个会话中之前的邮件的Message-ID
+	Headers     map[string][]string `json:"headers"`     // Config.ExtraHeaders中配置的邮件头
+	Key         string              `json:"key"`         // Config.KeyHeader对应的邮件头
 	Title       string              `json:"title"`
-	Body        string              `json:"body"`
+	Body        string              `json:"body"`         // 最后一个文本正文，兼容旧版本
+	TextBody    string              `json:"text_body"`    // 纯文本正文
+	HTMLBody    string              `json:"html_body"`    // HTML正文
+	InlineParts []*InlinePart       `json:"inline_parts"` // 内嵌的图片等内容
 	Attachments []map[string][]byte `json:"attachments"`
+	Files       []*AttachmentFile   `json:"files"` // 附件保存到磁盘时的文件信息
 	Size        uint32              `json:"size"`
 	Flags       []string            `json:"flags"`
 	SeqNum      uint32              `json:"seq_num"`
+	Uid         uint32              `json:"uid"`
+	Mailbox     string              `json:"mailbox"` // 邮件所在的邮箱
+}
+
+// AttachmentFile 保存到临时目录的附件
+type AttachmentFile struct {
+	Filename    string `json:"filename"`     // 邮件中的附件名称
+	Path        string `json:"path"`         // 保存的文件路径
+	Size        int64  `json:"size"`         // 文件大小
+	ContentType string `json:"content_type"` // 附件类型
+	ContentID   string `json:"content_id"`   // Content-ID，不包含尖括号
+	SHA256      string `json:"sha256"`       // 文件内容的SHA-256
+}
+
+// InlinePart 被正文引用的内嵌内容，例如HTML中通过cid:引用的图片
+type InlinePart struct {
+	ContentID   string `json:"content_id"`     // Content-ID，不包含尖括号
+	ContentType string `json:"content_type"`   // 内容类型，例如image/png
+	Filename    string `json:"filename"`       // 文件名，可能为空
+	Size        int64  `json:"size"`           // 内容大小
+	Data        []byte `json:"data,omitempty"` // 内容，附件保存在内存中时使用
+	Path        string `json:"path,omitempty"` // 保存的文件路径，附件保存到磁盘时使用
+}
+
+// Address 邮件地址
+type Address struct {
+	Name  string `json:"name"`  // 显示名称，可能为空
+	Email string `json:"email"` // 邮箱地址
 }
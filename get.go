@@ -1,5 +1,19 @@
 package zdpgo_imap
 
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+	"github.com/zhangdapeng520/zdpgo_imap/message/mail"
+)
+
 /*
 @Time : 2022/5/24 20:08
 @Author : 张大鹏
@@ -7,3 +21,162 @@ package zdpgo_imap
 @Software: Goland2021.3.1
 @Description:
 */
+
+// fetchBatchSize 每次UidFetch请求的最大UID数量
+const fetchBatchSize = 100
+
+// fetchByUids 分批使用UidFetch抓取指定UID的邮件，返回UID到邮件的映射
+func (i *Imap) fetchByUids(ctx context.Context, c *client.Client, uids []uint32, items []imap.FetchItem) (map[uint32]*imap.Message, error) {
+	// 抓取UID才能把结果和请求对应起来
+	items = append([]imap.FetchItem{imap.FetchUid}, items...)
+
+	messages := make(map[uint32]*imap.Message, len(uids))
+	for start := 0; start < len(uids); start += fetchBatchSize {
+		end := start + fetchBatchSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+
+		seqSet := new(imap.SeqSet)
+		seqSet.AddNum(uids[start:end]...)
+
+		ch := make(chan *imap.Message, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidFetchContext(ctx, seqSet, items, ch)
+		}()
+		for msg := range ch {
+			messages[msg.Uid] = msg
+		}
+		if err := <-done; err != nil {
+			i.Log.Error("批量抓取邮件失败", "error", err, "seqSet", seqSet)
+			return nil, commandError(c, "UID FETCH", err)
+		}
+	}
+
+	return messages, nil
+}
+
+// sortUidsDesc 将UID按从大到小排序，最新的邮件排在最前面
+func sortUidsDesc(uids []uint32) {
+	sort.Slice(uids, func(a, b int) bool {
+		return uids[a] > uids[b]
+	})
+}
+
+// fetchResults 分批抓取邮件的MIME内容并生成查询结果，结果的顺序和uids一致
+// infos 是第一次fetch得到的邮件头信息，match 不为nil时只保留match返回true的邮件
+func (i *Imap) fetchResults(ctx context.Context, c *client.Client, uids []uint32, infos map[uint32]*imap.Message, match func(body []byte) bool) ([]*Result, error) {
+	var (
+		section imap.BodySectionName
+		results []*Result
+		done    bool
+	)
+	// 出错时删除之前的结果已经保存到临时目录的附件和内嵌内容
+	defer func() {
+		if !done {
+			i.RemoveAttachments(results...)
+		}
+	}()
+
+	for start := 0; start < len(uids); start += fetchBatchSize {
+		end := start + fetchBatchSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+
+		bodies, err := i.fetchByUids(ctx, c, uids[start:end], []imap.FetchItem{imap.FetchRFC822})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, uid := range uids[start:end] {
+			msg, ok := bodies[uid]
+			if !ok {
+				i.Log.Error("返回的邮件消息为空", "uid", uid)
+				return nil, newError(ErrProtocol, "UID FETCH", fmt.Errorf("message %d not returned by server", uid))
+			}
+
+			literal := msg.GetBody(&section)
+			if literal == nil {
+				i.Log.Error("获取片段名称失败", "uid", uid)
+				return nil, newError(ErrProtocol, "UID FETCH", fmt.Errorf("message %d has no body", uid))
+			}
+			// 需要匹配内容时才复制一份邮件内容，避免大邮件占用双倍的内存
+			var body io.Reader = literal
+			if match != nil {
+				raw, err := ioutil.ReadAll(literal)
+				if err != nil {
+					return nil, err
+				}
+				if !match(raw) {
+					continue
+				}
+				body = bytes.NewReader(raw)
+			}
+
+			// 创建邮件阅读器
+			mailReader, err := mail.CreateReader(body)
+			if err != nil {
+				i.Log.Error("创建邮件阅读器失败", "error", err)
+				return nil, newError(ErrProtocol, "parse message", err)
+			}
+
+			// 设置邮件查询结果
+			info := infos[uid]
+			if info == nil {
+				info = msg
+			}
+			result, err := i.GetResult(info, mailReader)
+			if err != nil {
+				i.Log.Error("设置查询结果失败", "error", err)
+				return nil, err
+			}
+			results = append(results, result)
+		}
+	}
+
+	done = true
+	return results, nil
+}
+
+// containsText 解码邮件的标题和正文(text或者html)，判断是否包含text
+func containsText(body []byte, text string) bool {
+	if text == "" {
+		return true
+	}
+
+	mailReader, err := mail.CreateReader(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	if subject, err := mailReader.Header.Subject(); err == nil && strings.Contains(subject, text) {
+		return true
+	}
+
+	for {
+		part, err := mailReader.NextPart()
+		if err != nil {
+			return false
+		}
+
+		if _, ok := part.Header.(*mail.InlineHeader); !ok {
+			continue
+		}
+		content, err := ioutil.ReadAll(part.Body)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(content), text) {
+			return true
+		}
+	}
+}
+
+// sortUidsAsc 将UID按从小到大排序，最早到达的邮件排在最前面
+func sortUidsAsc(uids []uint32) {
+	sort.Slice(uids, func(a, b int) bool {
+		return uids[a] < uids[b]
+	})
+}
@@ -4,6 +4,7 @@ go 1.17
 
 require (
 	github.com/zhangdapeng520/zdpgo_log v1.3.4
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
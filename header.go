@@ -0,0 +1,204 @@
+package zdpgo_imap
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/message/mail"
+	"github.com/zhangdapeng520/zdpgo_imap/message/textproto"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : header.go
+@Software: Goland2021.3.1
+@Description: 邮件头信息，ENVELOPE中没有的字段从RFC822.HEADER中补充
+*/
+
+// DefaultKeyHeader Result.Key默认读取的邮件头
+const DefaultKeyHeader = "X-ZdpgoEmail-Auther"
+
+// headerFields ENVELOPE中没有或者不完整，需要额外抓取的邮件头
+var headerFields = []string{"Message-Id", "In-Reply-To", "References"}
+
+// headerSection 第一次fetch时额外抓取的邮件头片段
+// 使用BODY.PEEK，不会给邮件设置\Seen标志
+func (i *Imap) headerSection() *imap.BodySectionName {
+	fields := append([]string{}, headerFields...)
+	if i.Config.KeyHeader != "" {
+		fields = append(fields, i.Config.KeyHeader)
+	}
+	fields = append(fields, i.Config.ExtraHeaders...)
+
+	return &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{
+			Specifier: imap.HeaderSpecifier,
+			Fields:    fields,
+		},
+		Peek: true,
+	}
+}
+
+// infoItems 第一次fetch抓取的内容：邮件头，邮件标志，邮件大小，到达时间和额外的邮件头
+func (i *Imap) infoItems() []imap.FetchItem {
+	return []imap.FetchItem{
+		imap.FetchEnvelope,
+		imap.FetchFlags,
+		imap.FetchRFC822Size,
+		imap.FetchInternalDate,
+		i.headerSection().FetchItem(),
+	}
+}
+
+// messageHeader 解析fetch返回的邮件头片段，没有抓取时返回nil
+func messageHeader(message *imap.Message) *mail.Header {
+	for section, literal := range message.Body {
+		if section.Specifier != imap.HeaderSpecifier || literal == nil {
+			continue
+		}
+		h, err := textproto.ReadHeader(bufio.NewReader(literal))
+		if err != nil {
+			return nil
+		}
+		header := &mail.Header{}
+		header.Header.Header = h
+		return header
+	}
+	return nil
+}
+
+// newAddress 转换ENVELOPE中的地址，地址为空时返回nil
+func newAddress(addr *imap.Address) *Address {
+	if addr == nil || (addr.MailboxName == "" && addr.HostName == "") {
+		return nil
+	}
+	return &Address{
+		Name:  addr.PersonalName,
+		Email: addr.Address(),
+	}
+}
+
+// newAddressList 转换ENVELOPE中的地址列表，跳过空地址和分组标记
+func newAddressList(addrs []*imap.Address) []*Address {
+	var list []*Address
+	for _, addr := range addrs {
+		if a := newAddress(addr); a != nil {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// emails 返回地址列表中的邮箱地址
+func emails(list []*Address) []string {
+	var result []string
+	for _, addr := range list {
+		result = append(result, addr.Email)
+	}
+	return result
+}
+
+// setEnvelope 使用ENVELOPE设置结果的邮件头信息
+func setEnvelope(result *Result, envelope *imap.Envelope) {
+	if envelope == nil {
+		return
+	}
+
+	result.Title = envelope.Subject
+	result.SentDate = envelope.Date
+	result.MessageID = trimMsgID(envelope.MessageId)
+	if envelope.InReplyTo != "" {
+		result.InReplyTo = parseMsgIDs(envelope.InReplyTo)
+	}
+
+	result.FromList = newAddressList(envelope.From)
+	if len(result.FromList) > 0 {
+		result.From = result.FromList[0].Email
+		result.FromName = result.FromList[0].Name
+	}
+	for _, sender := range envelope.Sender {
+		result.Sender = newAddress(sender)
+		break
+	}
+	result.ReplyTo = newAddressList(envelope.ReplyTo)
+
+	result.To = newAddressList(envelope.To)
+	result.Cc = newAddressList(envelope.Cc)
+	result.Bcc = newAddressList(envelope.Bcc)
+	result.ToEmails = emails(result.To)
+	result.CcEmails = emails(result.Cc)
+	result.BccEmails = emails(result.Bcc)
+}
+
+// setHeader 使用邮件头补充ENVELOPE中没有的信息，已经设置的字段不会被覆盖
+// h 可以是第一次fetch抓取的邮件头片段，也可以是完整的邮件头
+func (i *Imap) setHeader(result *Result, h *mail.Header) {
+	if h == nil {
+		return
+	}
+
+	if result.MessageID == "" {
+		if id, err := h.MessageID(); err == nil {
+			result.MessageID = id
+		}
+	}
+	if len(result.InReplyTo) == 0 {
+		if ids, err := h.MsgIDList("In-Reply-To"); err == nil {
+			result.InReplyTo = ids
+		}
+	}
+	if len(result.References) == 0 {
+		if ids, err := h.MsgIDList("References"); err == nil {
+			result.References = ids
+		}
+	}
+	if result.SentDate.IsZero() {
+		if date, err := h.Date(); err == nil {
+			result.SentDate = date
+		}
+	}
+	if result.Key == "" && i.Config.KeyHeader != "" {
+		result.Key = h.Get(i.Config.KeyHeader)
+	}
+
+	for _, key := range i.Config.ExtraHeaders {
+		if _, ok := result.Headers[key]; ok {
+			continue
+		}
+		fields := h.FieldsByKey(key)
+		var values []string
+		for fields.Next() {
+			value, err := fields.Text()
+			if err != nil {
+				value = fields.Value()
+			}
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if result.Headers == nil {
+			result.Headers = make(map[string][]string)
+		}
+		result.Headers[key] = values
+	}
+}
+
+// trimMsgID 去掉Message-ID两边的尖括号
+func trimMsgID(id string) string {
+	id = strings.TrimSpace(id)
+	return strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+}
+
+// parseMsgIDs 解析In-Reply-To等包含多个Message-ID的值
+func parseMsgIDs(value string) []string {
+	var h mail.Header
+	h.Set("In-Reply-To", value)
+	ids, err := h.MsgIDList("In-Reply-To")
+	if err != nil || len(ids) == 0 {
+		return []string{trimMsgID(value)}
+	}
+	return ids
+}
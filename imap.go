@@ -1,15 +1,18 @@
 package zdpgo_imap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/zhangdapeng520/zdpgo_imap/imap"
 	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
-	"github.com/zhangdapeng520/zdpgo_imap/message/charset"
 	"github.com/zhangdapeng520/zdpgo_imap/message/mail"
 	"github.com/zhangdapeng520/zdpgo_log"
 )
@@ -29,7 +32,11 @@ type Imap struct {
 	All            []*Result // 存储所有的邮件
 	LastSearchTime time.Time // 最近一次搜索
 	Client         *client.Client
+	Pool           *Pool     // 已登录的会话池，多个Imap对象可以共享同一个会话池
+	SyncStore      SyncStore // 增量同步状态的存储，默认保存在Config.SyncStateFile
 	Log            *zdpgo_log.Log
+
+	locker sync.Mutex // 保护All和LastSearchTime
 }
 
 func New() *Imap {
@@ -49,217 +56,385 @@ func NewWithConfig(config *Config) *Imap {
 	if config.TmpDir == "" {
 		config.TmpDir = ".zdpgo_imap_tmp_downloads"
 	}
+	if config.SyncStateFile == "" {
+		config.SyncStateFile = ".zdpgo_imap_sync_state.json"
+	}
+	if config.Mailbox == "" {
+		config.Mailbox = imap.InboxName
+	}
+	if config.AttachmentMode == "" {
+		config.AttachmentMode = AttachmentModeMemory
+	}
+	if config.MaxConns <= 0 {
+		config.MaxConns = 5
+	}
+	if config.KeyHeader == "" {
+		config.KeyHeader = DefaultKeyHeader
+	}
 	i.Config = config
 
+	// 会话池
+	i.Pool = NewPool(config.MaxConns)
+
+	// 同步状态
+	i.SyncStore = NewJSONFileStore(config.SyncStateFile)
+
 	return i
 }
 
-func (i *Imap) InitClient() {
-	var err error
+// InitClient 连接并登录邮件服务器，连接保存在i.Client中
+// 返回的错误是*Error，可以使用errors.Is判断是连接、TLS还是认证失败
+func (i *Imap) InitClient() error {
+	c, err := i.dial(context.Background())
+	if err != nil {
+		if c != nil {
+			c.Terminate()
+		}
+		return err
+	}
+	i.Client = c
+	return nil
+}
 
-	// 【字符集】  处理us-ascii和utf-8以外的字符集(例如gbk,gb2313等)时, 需要加上这行代码。
-	// 【参考】 https://github.com/zhangdapeng520/zdpgo_imap/imap/wiki/Charset-handling
-	imap.CharsetReader = charset.Reader
+// Check 检查邮件服务器是否可用：依次建立连接、TLS握手、登录并以只读方式打开Config.Mailbox
+// 全部成功时返回nil，否则返回*Error，其中Kind表示出错的阶段：
+// ErrConnection、ErrTLS、ErrAuth、ErrMailboxNotFound、ErrServer或者ErrProtocol
+func (i *Imap) Check(ctx context.Context) error {
+	c, err := i.dial(ctx)
+	if err != nil {
+		if c != nil {
+			c.Terminate()
+		}
+		return err
+	}
+	defer closeClient(c)
 
-	// 连接邮件服务器
-	address := fmt.Sprintf("%s:%d", i.Config.Host, i.Config.Port)
-	i.Client, err = client.DialTLS(address, nil)
+	mailboxes, err := i.resolveMailboxes(c, i.Config.Mailbox)
 	if err != nil {
-		i.Log.Error("连接邮件服务器失败", "error", err)
-		return
+		return err
+	}
+	for _, mailbox := range mailboxes {
+		if _, err = i.selectMailbox(ctx, c, mailbox); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchByTitle 根据邮件标题查询邮件
+// 【处理业务需求】假设需求是找出标题包含title的邮件，并下载附件。
+// 【思路】标题的匹配交给服务器的SEARCH SUBJECT完成，中文标题使用CHARSET UTF-8，避免逐封抓取邮件头。
+// 有些邮件包含附件后会变得特别大，因此对匹配的UID分两次批量fetch处理，减少处理时长：
+// 1)第一次fetch先使用ENVELOPE获取邮件头信息，再次确认标题包含title(服务器的SUBJECT匹配不区分大小写)
+// 2)第二次fetch根据确认后的UID使用'RFC822'获取邮件MIME内容，下载附件
+func (i *Imap) SearchByTitle(title string) ([]*Result, error) {
+	return i.SearchByTitleContext(context.Background(), title)
+}
+
+// SearchByTitleContext 和SearchByTitle相同，ctx结束时中止正在执行的命令
+func (i *Imap) SearchByTitleContext(ctx context.Context, title string) ([]*Result, error) {
+	// 如果距离最近一次搜索不超过30秒钟，则使用最近搜索的数据
+	i.locker.Lock()
+	if time.Since(i.LastSearchTime).Seconds() < 10 {
+		all := i.All
+		i.locker.Unlock()
+		return all, nil
 	}
+	i.locker.Unlock()
 
-	// 使用账号密码登录
-	if err = i.Client.Login(i.Config.Username, i.Config.Password); err != nil {
-		i.Log.Error("登录邮件服务器失败", "error", err, "config", i.Config)
+	results, err := i.SearchByTitleIn(ctx, i.Config.Mailbox, title)
+	if err != nil {
+		return nil, err
 	}
+
+	// 同步到全部结果
+	i.locker.Lock()
+	i.LastSearchTime = time.Now()
+	i.All = results
+	i.locker.Unlock()
+	return results, nil
 }
 
-func (i *Imap) IsHealth() bool {
-	var err error
-	// 【字符集】  处理us-ascii和utf-8以外的字符集(例如gbk,gb2313等)时, 需要加上这行代码。
-	// 【参考】 https://github.com/zhangdapeng520/zdpgo_imap/imap/wiki/Charset-handling
-	imap.CharsetReader = charset.Reader
+// SearchByTitleIn 在mailbox匹配的所有邮箱中根据邮件标题查询邮件
+// mailbox可以是邮箱名称，也可以是包含通配符*和%的LIST模式，例如"*"表示所有的邮箱
+func (i *Imap) SearchByTitleIn(ctx context.Context, mailbox, title string) ([]*Result, error) {
+	return i.searchMailboxes(ctx, mailbox, func(c *client.Client, name string) ([]*Result, error) {
+		return i.searchByTitle(ctx, c, name, title)
+	})
+}
 
-	// 连接邮件服务器
-	address := fmt.Sprintf("%s:%d", i.Config.Host, i.Config.Port)
-	i.Client, err = client.DialTLS(address, nil)
+func (i *Imap) searchByTitle(ctx context.Context, c *client.Client, mailbox, title string) ([]*Result, error) {
+	// 以只读方式打开邮箱
+	_, err := i.selectMailbox(ctx, c, mailbox)
 	if err != nil {
-		i.Log.Error("连接邮件服务器失败", "error", err)
-		return false
+		return nil, err
 	}
-	defer func(Client *client.Client) {
-		err = Client.Close()
-		if err != nil {
-			i.Log.Error("关闭Imap客户端对象失败", "error", err)
-		}
-	}(i.Client)
 
-	// 使用账号密码登录
-	if err = i.Client.Login(i.Config.Username, i.Config.Password); err != nil {
-		i.Log.Error("登录邮件服务器失败", "error", err, "config", i.Config)
-		return true
+	// 搜索条件实例对象，标题为空时搜索所有的邮件
+	// See RFC 3501 section 6.4.4 for a list of searching criteria.
+	criteria := imap.NewSearchCriteria()
+	if title != "" {
+		criteria.Header.Add("Subject", title)
 	}
 
-	return false
-}
+	// 执行搜索，获取所有匹配的UID
+	uids, err := c.UidSearchContext(ctx, criteria)
+	if err != nil {
+		i.Log.Error("搜索邮件失败", "error", err)
+		return nil, commandError(c, "UID SEARCH", err)
+	}
+	sortUidsDesc(uids)
 
-// SearchByTitle 根据邮件标题查询邮件
-// 【处理业务需求】假设需求是找出求以subject开头的标题的最新邮件，并下载附件。
-// 【思路】有些邮件包含附件后会变得特别大，如果要遍历的邮件很多，直接遍历处理，每封邮件都获取'RFC822'内容，
-// fetch方法执行耗时可能会很长, 因此可以分两次fetch处理，减少处理时长：
-// 1)第一次fetch先使用ENVELOP或者RFC822.HEADER获取邮件头信息找到满足业务需求邮件的id
-// 2)第二次fetch根据这个邮件id使用'RFC822'获取邮件MIME内容，下载附件
-func (i *Imap) SearchByTitle(title string) ([]*Result, error) {
-	// 如果距离最近一次搜索不超过30秒钟，则使用最近搜索的数据
-	now := time.Now()
-	diffTime := now.Sub(i.LastSearchTime).Seconds()
-	if diffTime < 10 {
-		return i.All, nil
+	// 第一次fetch, 只抓取邮件头，邮件标志，邮件大小等信息，执行速度快
+	// 【实践经验】这里遇到过的err信息是：ENVELOPE doesn't contain 10 fields
+	// 原因是对方发送的邮件格式不规范，解析失败
+	// 相关的issue: https://github.com/zhangdapeng520/zdpgo_imap/imap/issues/143
+	infos, err := i.fetchByUids(ctx, c, uids, i.infoItems())
+	if err != nil {
+		i.Log.Error("抓取邮件信息失败", "error", err)
+		return nil, err
 	}
 
-	// 连接邮件服务器
-	i.InitClient()
-	defer func(Client *client.Client) {
-		err := Client.Logout()
-		if err != nil {
-			i.Log.Error("注销失败", "error", err)
+	// 确认标题确实包含要查找的内容
+	var matched []uint32
+	for _, uid := range uids {
+		message, ok := infos[uid]
+		if !ok || message.Envelope == nil {
+			i.Log.Warning("邮件服务器没有返回消息内容", "uid", uid)
+			continue
+		}
+		if strings.Contains(message.Envelope.Subject, title) {
+			matched = append(matched, uid)
 		}
-	}(i.Client)
+	}
 
-	// 选择收件箱
-	_, err := i.Client.Select("INBOX", false)
+	// 这里是第二次fetch, 获取邮件MIME内容
+	results, err := i.fetchResults(ctx, c, matched, infos, nil)
 	if err != nil {
-		i.Log.Error("选择收件箱失败", "error", err)
+		i.Log.Error("获取邮件MIME内容失败", "error", err)
 		return nil, err
 	}
 
-	// 搜索条件实例对象
-	criteria := imap.NewSearchCriteria()
+	return results, nil
+}
 
-	// ALL是默认条件
-	// See RFC 3501 section 6.4.4 for a list of searching criteria.
-	criteria.WithoutFlags = []string{"ALL"}
+// SearchByContent 根据内容搜索
+// 【思路】优先使用服务器的SEARCH BODY/TEXT进行搜索，如果服务器的SEARCH不支持该字符集(例如中文内容)，
+// 则退化为搜索所有的邮件，在本地解码邮件正文后进行匹配。
+// 服务器的匹配规则不一定和本地一致，所以最终只返回标题或正文确实包含searchContent的结果。
+func (i *Imap) SearchByContent(searchContent string) ([]*Result, error) {
+	return i.SearchByContentContext(context.Background(), searchContent)
+}
 
-	// 执行搜索，获取所有的ID
-	ids, err := i.Client.Search(criteria)
+// SearchByContentContext 和SearchByContent相同，ctx结束时中止正在执行的命令
+func (i *Imap) SearchByContentContext(ctx context.Context, searchContent string) ([]*Result, error) {
+	return i.SearchByContentIn(ctx, i.Config.Mailbox, searchContent)
+}
+
+// SearchByContentIn 在mailbox匹配的所有邮箱中根据内容搜索
+func (i *Imap) SearchByContentIn(ctx context.Context, mailbox, searchContent string) ([]*Result, error) {
+	return i.searchMailboxes(ctx, mailbox, func(c *client.Client, name string) ([]*Result, error) {
+		return i.searchByContent(ctx, c, name, searchContent)
+	})
+}
+
+func (i *Imap) searchByContent(ctx context.Context, c *client.Client, mailbox, searchContent string) ([]*Result, error) {
+	// 以只读方式打开邮箱
+	_, err := i.selectMailbox(ctx, c, mailbox)
 	if err != nil {
-		i.Log.Error("搜索邮件失败", "error", err)
 		return nil, err
 	}
 
-	// 片段
-	var section imap.BodySectionName
+	// 搜索条件：正文或者全文(邮件头+正文)包含要搜索的内容
+	criteria := imap.NewSearchCriteria()
+	if searchContent != "" {
+		bodyCriteria := imap.NewSearchCriteria()
+		bodyCriteria.Body = []string{searchContent}
+		textCriteria := imap.NewSearchCriteria()
+		textCriteria.Text = []string{searchContent}
+		criteria.Or = [][2]*imap.SearchCriteria{{bodyCriteria, textCriteria}}
+	}
 
-	// 遍历邮件，进行搜索
-	var results []*Result
-	for {
-		if len(ids) == 0 {
-			break
+	// 执行搜索，明确使用UTF-8，不使用UidSearch在[BADCHARSET]时自动改用US-ASCII的重试，
+	// 用US-ASCII搜索非ASCII的内容没有意义，只有内容都是ASCII字符时才改用US-ASCII。
+	// 服务器不支持UTF-8，或者搜索非ASCII的内容失败时，在本地搜索所有的邮件
+	ascii := isASCII(searchContent)
+	uids, err := c.UidSearchCharset(ctx, "UTF-8", criteria)
+	if ascii && isBadCharset(err) {
+		uids, err = c.UidSearchCharset(ctx, "US-ASCII", criteria)
+	}
+	if isBadCharset(err) || (!ascii && isStatusError(err)) {
+		i.Log.Warning("服务器不支持搜索内容的字符集，改为本地搜索", "error", err)
+		if uids, err = c.UidSearchContext(ctx, imap.NewSearchCriteria()); err != nil {
+			i.Log.Error("搜索邮件失败", "error", err)
+			return nil, commandError(c, "UID SEARCH", err)
 		}
-		id := pop(&ids)            // 获取ID
-		seqSet := new(imap.SeqSet) // 获取索引集合
-		seqSet.AddNum(id)          // 索引集合添加ID
-
-		// 查询邮件信息，不查询邮件的附件和内容
-		chanMessage := make(chan *imap.Message, 1)
-		go func() {
-			// 第一次fetch, 只抓取邮件头，邮件标志，邮件大小等信息，执行速度快
-			err = i.Client.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size}, chanMessage)
-			if err != nil {
-				// 【实践经验】这里遇到过的err信息是：ENVELOPE doesn't contain 10 fields
-				// 原因是对方发送的邮件格式不规范，解析失败
-				// 相关的issue: https://github.com/zhangdapeng520/zdpgo_imap/imap/issues/143
-				i.Log.Error("抓取邮件内容失败", "error", err, "seqSet", seqSet)
-			}
-		}()
+	} else if err != nil {
+		i.Log.Error("搜索邮件失败", "error", err)
+		return nil, commandError(c, "UID SEARCH", err)
+	}
+	sortUidsDesc(uids)
 
-		message := <-chanMessage
-		if message == nil {
-			i.Log.Warning("邮件服务器没有返回消息内容", "message", message)
-			continue
-		}
+	// 抓取邮件头，邮件标志，邮件大小等信息
+	infos, err := i.fetchByUids(ctx, c, uids, i.infoItems())
+	if err != nil {
+		i.Log.Error("抓取邮件信息失败", "error", err)
+		return nil, err
+	}
 
-		// 如果包含要查找的标题，则进一步搜索内容
-		if strings.Contains(message.Envelope.Subject, title) {
-			// 查询邮件的内容和附件，不查询信息
-			chanMsg := make(chan *imap.Message, 1)
-			go func() {
-				// 这里是第二次fetch, 获取邮件MIME内容
-				err = i.Client.Fetch(seqSet, []imap.FetchItem{imap.FetchRFC822}, chanMsg)
-				if err != nil {
-					i.Log.Error("获取邮件MIME内容失败", "error", err, "seqSet", seqSet)
-				}
-			}()
+	// 获取邮件MIME内容，只保留确实包含搜索内容的邮件
+	results, err := i.fetchResults(ctx, c, uids, infos, func(body []byte) bool {
+		return containsText(body, searchContent)
+	})
+	if err != nil {
+		i.Log.Error("获取邮件MIME内容失败", "error", err)
+		return nil, err
+	}
+	return results, nil
+}
 
-			msg := <-chanMsg
-			if msg == nil {
-				i.Log.Error("返回的邮件消息为空", "msg", msg)
-				return nil, err
-			}
+// isBadCharset 判断err是否为服务器返回的[BADCHARSET]错误
+func isBadCharset(err error) bool {
+	var statusErr *imap.ErrStatusResp
+	return errors.As(err, &statusErr) && statusErr.Resp != nil && statusErr.Resp.Code == imap.CodeBadCharset
+}
 
-			sectionName := msg.GetBody(&section)
-			if sectionName == nil {
-				i.Log.Error("获取片段名称失败", "sectionName", sectionName)
-				return nil, err
-			}
+// isStatusError 判断err是否为服务器返回的NO或BAD响应，而不是连接错误
+func isStatusError(err error) bool {
+	var statusErr *imap.ErrStatusResp
+	return errors.As(err, &statusErr)
+}
 
-			// 创建邮件阅读器
-			mailReader, err1 := mail.CreateReader(sectionName)
-			if err1 != nil {
-				i.Log.Error("创建邮件阅读器失败", "error", err)
-				return nil, err1
-			}
+// isASCII 判断s是否只包含ASCII字符
+func isASCII(s string) bool {
+	for n := 0; n < len(s); n++ {
+		if s[n] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
 
-			// 设置邮件查询结果
-			result, err := i.GetResult(message, mailReader)
-			if err != nil {
-				i.Log.Error("设置查询结果失败", "error", err)
-				return nil, err
-			}
-			results = append(results, result)
+// Search 在mailbox匹配的所有邮箱中搜索满足criteria的邮件，并获取邮件的MIME内容，最新的邮件排在最前面
+// mailbox可以是邮箱名称，也可以是包含通配符*和%的LIST模式
+func (i *Imap) Search(ctx context.Context, mailbox string, criteria *imap.SearchCriteria) ([]*Result, error) {
+	return i.searchMailboxes(ctx, mailbox, func(c *client.Client, name string) ([]*Result, error) {
+		return i.searchByCriteria(ctx, c, name, criteria, true)
+	})
+}
+
+// SearchHeaders 和Search相同，但是只获取邮件头、标志和大小等信息，不下载邮件内容
+func (i *Imap) SearchHeaders(ctx context.Context, mailbox string, criteria *imap.SearchCriteria) ([]*Result, error) {
+	return i.searchMailboxes(ctx, mailbox, func(c *client.Client, name string) ([]*Result, error) {
+		return i.searchByCriteria(ctx, c, name, criteria, false)
+	})
+}
+
+// FetchByUid 获取mailbox中指定UID的邮件，最新的邮件排在最前面
+func (i *Imap) FetchByUid(ctx context.Context, mailbox string, uids []uint32) ([]*Result, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = uidSet(uids)
+	return i.Search(ctx, mailbox, criteria)
+}
+
+// FetchRawByUid 将mailbox中指定UID的邮件原文写入w，不会给邮件设置\Seen标志
+func (i *Imap) FetchRawByUid(ctx context.Context, mailbox string, uid uint32, w io.Writer) error {
+	// 使用BODY.PEEK[]获取整封邮件
+	section := &imap.BodySectionName{Peek: true}
+	var body imap.Literal
+	err := i.withClientRetry(ctx, func(c *client.Client) error {
+		if _, err := i.selectMailbox(ctx, c, mailbox); err != nil {
+			return err
+		}
+		messages, err := i.fetchByUids(ctx, c, []uint32{uid}, []imap.FetchItem{section.FetchItem()})
+		if err != nil {
+			return err
+		}
+		body = nil
+		if message, ok := messages[uid]; ok {
+			body = message.GetBody(section)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		return fmt.Errorf("imap: message %d not found in %s", uid, mailbox)
 	}
 
-	// 同步到全部结果
-	i.LastSearchTime = time.Now()
-	i.All = results
-	return results, nil
+	// 抓取成功之后才写入w，重试时不会写入重复的内容
+	_, err = io.Copy(w, body)
+	return err
 }
 
-// SearchByContent 根据内容搜索
-func (i *Imap) SearchByContent(searchContent string) ([]*Result, error) {
-	results, err := i.SearchByTitle("") // 搜索所有的邮件
+func (i *Imap) searchByCriteria(ctx context.Context, c *client.Client, mailbox string, criteria *imap.SearchCriteria, body bool) ([]*Result, error) {
+	// 以只读方式打开邮箱
+	_, err := i.selectMailbox(ctx, c, mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	uids, err := c.UidSearchContext(ctx, criteria)
 	if err != nil {
 		i.Log.Error("搜索邮件失败", "error", err)
+		return nil, commandError(c, "UID SEARCH", err)
+	}
+	sortUidsDesc(uids)
+
+	infos, err := i.fetchByUids(ctx, c, uids, i.infoItems())
+	if err != nil {
+		i.Log.Error("抓取邮件信息失败", "error", err)
 		return nil, err
 	}
+	if body {
+		return i.fetchResults(ctx, c, uids, infos, nil)
+	}
+
+	var results []*Result
+	for _, uid := range uids {
+		if message, ok := infos[uid]; ok {
+			results = append(results, i.GetBasicResult(message))
+		}
+	}
 	return results, nil
 }
 
-// 搜索最近的指定数量的邮件
+// SearchByRecent 搜索最近的指定数量的邮件
 func (i *Imap) SearchByRecent(recentNum uint32) ([]*Result, error) {
-	// 连接邮件服务器
-	i.InitClient()
-	defer func(Client *client.Client) {
-		err := Client.Logout()
-		if err != nil {
-			i.Log.Error("关闭邮件IMAP客户端失败", "error", err)
-		}
-	}(i.Client)
+	return i.SearchByRecentContext(context.Background(), recentNum)
+}
 
-	// 选择收件箱
-	mbox, err := i.Client.Select("INBOX", false)
+// SearchByRecentContext 和SearchByRecent相同，ctx结束时中止正在执行的命令
+func (i *Imap) SearchByRecentContext(ctx context.Context, recentNum uint32) ([]*Result, error) {
+	return i.SearchByRecentIn(ctx, i.Config.Mailbox, recentNum)
+}
+
+// SearchByRecentIn 在mailbox匹配的每个邮箱中搜索最近的指定数量的邮件
+func (i *Imap) SearchByRecentIn(ctx context.Context, mailbox string, recentNum uint32) ([]*Result, error) {
+	return i.searchMailboxes(ctx, mailbox, func(c *client.Client, name string) ([]*Result, error) {
+		return i.searchByRecent(ctx, c, name, recentNum)
+	})
+}
+
+func (i *Imap) searchByRecent(ctx context.Context, c *client.Client, mailbox string, recentNum uint32) ([]*Result, error) {
+	// 以只读方式打开邮箱
+	mbox, err := i.selectMailbox(ctx, c, mailbox)
 	if err != nil {
-		i.Log.Error("获取收件箱失败", "error", err)
 		return nil, err
 	}
+	if mbox.Messages == 0 || recentNum == 0 {
+		return nil, nil
+	}
 
 	// 获取近指定数量封邮件
-	from := recentNum
+	from := uint32(1)
 	to := mbox.Messages
 	if mbox.Messages > recentNum {
-		from = mbox.Messages - recentNum
+		from = mbox.Messages - recentNum + 1
 	}
 	seqSet := new(imap.SeqSet) // 索引集合
 	seqSet.AddRange(from, to)  // 设置邮件搜索范围
@@ -269,11 +444,8 @@ func (i *Imap) SearchByRecent(recentNum uint32) ([]*Result, error) {
 	done := make(chan error, 1)
 	go func() {
 		// 抓取邮件消息体传入到messages信道
-		searchItems := []imap.FetchItem{
-			imap.FetchEnvelope,     // 邮件信息
-			imap.FetchInternalDate, // 时间
-		}
-		done <- i.Client.Fetch(seqSet, searchItems, messages)
+		items := append([]imap.FetchItem{imap.FetchUid}, i.infoItems()...)
+		done <- c.FetchContext(ctx, seqSet, items, messages)
 	}()
 
 	// 处理查询结果
@@ -285,7 +457,7 @@ func (i *Imap) SearchByRecent(recentNum uint32) ([]*Result, error) {
 
 	if err = <-done; err != nil {
 		i.Log.Error("执行查询失败", "error", err)
-		return nil, err
+		return nil, commandError(c, "FETCH", err)
 	}
 
 	// 返回结果
@@ -293,10 +465,11 @@ func (i *Imap) SearchByRecent(recentNum uint32) ([]*Result, error) {
 }
 
 // GetBasicResult 获取基本结果信息
+// 邮件头信息优先使用ENVELOPE，ENVELOPE中没有的字段从第一次fetch抓取的邮件头片段中补充
 func (i *Imap) GetBasicResult(message *imap.Message) *Result {
 	result := &Result{
-		Title:    message.Envelope.Subject,
 		SeqNum:   message.SeqNum,
+		Uid:      message.Uid,
 		Size:     message.Size,
 		Flags:    message.Flags,
 		DateTime: message.InternalDate,
@@ -304,38 +477,18 @@ func (i *Imap) GetBasicResult(message *imap.Message) *Result {
 		DateStr:  message.InternalDate.Format("2006-01-02 15:04:05"),
 	}
 
-	// 发件人
-	for _, from := range message.Envelope.From {
-		result.From = from.Address()
-		break
-	}
-
-	// 收件人
-	var toEmails []string
-	for _, to := range message.Envelope.To {
-		toEmails = append(toEmails, to.Address())
-	}
-	result.ToEmails = toEmails
-
-	// 抄送
-	var ccEmails []string
-	for _, to := range message.Envelope.Cc {
-		ccEmails = append(ccEmails, to.Address())
-	}
-	result.CcEmails = ccEmails
+	// 发件人，收件人，抄送，密送等
+	setEnvelope(result, message.Envelope)
 
-	// 密送
-	var bccEmails []string
-	for _, to := range message.Envelope.Bcc {
-		bccEmails = append(bccEmails, to.Address())
-	}
-	result.BccEmails = bccEmails
+	// Message-ID，References等
+	i.setHeader(result, messageHeader(message))
 
 	// 返回
 	return result
 }
 
 // GetResult 获取查询结果
+// 纯文本正文保存在TextBody，HTML正文保存在HTMLBody，都已经解码为UTF-8；内嵌的图片等保存在InlineParts
 func (i *Imap) GetResult(message *imap.Message,
 	mailReader *mail.Reader) (*Result, error) {
 	var (
@@ -347,34 +500,69 @@ func (i *Imap) GetResult(message *imap.Message,
 
 	result := i.GetBasicResult(message)
 
+	// 使用完整的邮件头补充缺少的信息
+	i.setHeader(result, &mailReader.Header)
+
 	// 处理消息体的每个part
 	for {
 		part, err = mailReader.NextPart()
-		if err != nil {
+		if isUnknownCharset(err) {
+			// 无法识别的字符集，保留未解码的内容
+			i.Log.Warning("未知的字符集", "error", err)
+		} else if err != nil {
 			break
 		}
 
 		// 分别处理
 		switch h := part.Header.(type) {
-		case *mail.Header:
-			// 获取请求头信息
-			result.Key = h.Get("X-ZdpgoEmail-Auther")
 		case *mail.InlineHeader:
+			contentType, _, _ := h.ContentType()
+			if !strings.HasPrefix(contentType, "text/") {
+				// 内嵌的图片等
+				if err = i.addInlinePart(result, h, "", part.Body); err != nil {
+					i.RemoveAttachments(result)
+					return nil, err
+				}
+				continue
+			}
+
 			// 获取正文内容, text或者html
 			body, err = ioutil.ReadAll(part.Body)
 			if err != nil {
 				i.Log.Error("获取正文内容失败", "error", err)
+				i.RemoveAttachments(result)
 				return nil, err
 			}
+			if contentType == "text/html" {
+				result.HTMLBody = joinBody(result.HTMLBody, string(body))
+			} else {
+				result.TextBody = joinBody(result.TextBody, string(body))
+			}
 			result.Body = string(body)
 		case *mail.AttachmentHeader:
 			// 下载附件
 			filename, err = h.Filename()
 			if err != nil {
 				i.Log.Error("获取附件名称失败", "error", err)
+				i.RemoveAttachments(result)
 				return nil, err
 			}
-			if filename != "" {
+			if isInlinePart(h, filename) {
+				// 没有文件名但是有Content-ID，是被HTML正文引用的内嵌图片
+				if err = i.addInlinePart(result, h, filename, part.Body); err != nil {
+					i.RemoveAttachments(result)
+					return nil, err
+				}
+			} else if filename != "" && i.Config.AttachmentMode == AttachmentModeDisk {
+				// 流式保存到临时目录，不在内存中保存附件内容
+				file, err := i.saveAttachment(h, filename, part.Body)
+				if err != nil {
+					i.Log.Error("保存附件失败", "error", err, "filename", filename)
+					i.RemoveAttachments(result)
+					return nil, err
+				}
+				result.Files = append(result.Files, file)
+			} else if filename != "" {
 				body, err = ioutil.ReadAll(part.Body)
 				if err != nil && err != io.EOF {
 					i.Log.Warning("读取附件内容失败", "error", err, "filename", filename, "body", body)
@@ -389,10 +577,3 @@ func (i *Imap) GetResult(message *imap.Message,
 	// 返回
 	return result, nil
 }
-
-func pop(list *[]uint32) uint32 {
-	length := len(*list)
-	lastEle := (*list)[length-1]
-	*list = (*list)[:length-1]
-	return lastEle
-}
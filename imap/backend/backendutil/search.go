@@ -69,6 +69,13 @@ func bodyLen(e *message.Entity) (int, error) {
 // Match returns true if a message and its metadata matches the provided
 // criteria.
 func Match(e *message.Entity, seqNum, uid uint32, date time.Time, flags []string, c *imap.SearchCriteria) (bool, error) {
+	return MatchModSeq(e, seqNum, uid, 0, date, flags, c)
+}
+
+// MatchModSeq is like Match, but also takes the message mod-sequence into
+// account for backends that support CONDSTORE. Match never matches criteria
+// containing a MODSEQ key.
+func MatchModSeq(e *message.Entity, seqNum, uid uint32, modSeq uint64, date time.Time, flags []string, c *imap.SearchCriteria) (bool, error) {
 	// TODO: support encoded header fields for Bcc, Cc, From, To
 	// TODO: add header size for Larger and Smaller
 
@@ -164,19 +171,23 @@ func Match(e *message.Entity, seqNum, uid uint32, date time.Time, flags []string
 		}
 	}
 
+	if c.ModSeq > 0 && modSeq < c.ModSeq {
+		return false, nil
+	}
+
 	for _, not := range c.Not {
-		ok, err := Match(e, seqNum, uid, date, flags, not)
+		ok, err := MatchModSeq(e, seqNum, uid, modSeq, date, flags, not)
 		if err != nil || ok {
 			return false, err
 		}
 	}
 	for _, or := range c.Or {
-		ok1, err := Match(e, seqNum, uid, date, flags, or[0])
+		ok1, err := MatchModSeq(e, seqNum, uid, modSeq, date, flags, or[0])
 		if err != nil {
 			return ok1, err
 		}
 
-		ok2, err := Match(e, seqNum, uid, date, flags, or[1])
+		ok2, err := MatchModSeq(e, seqNum, uid, modSeq, date, flags, or[1])
 		if err != nil || (!ok1 && !ok2) {
 			return false, err
 		}
@@ -0,0 +1,245 @@
+package backendutil
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/message"
+	"github.com/zhangdapeng520/zdpgo_imap/message/mail"
+)
+
+// SortMessage is a message to be ordered by Sort or Thread.
+type SortMessage struct {
+	// The message sequence number or UID, returned by Sort and Thread.
+	Id uint32
+	// The message. Only its header is used.
+	Entity *message.Entity
+	// The internal date of the message.
+	Date time.Time
+	// The RFC 822 size of the message.
+	Size uint32
+}
+
+// sortKey holds the values a message is sorted by.
+type sortKey struct {
+	msg      *SortMessage
+	sentDate time.Time
+	subject  string
+	reply    bool
+	from     string
+	to       string
+	cc       string
+}
+
+func newSortKey(msg *SortMessage) *sortKey {
+	h := mail.Header{Header: msg.Entity.Header}
+	k := &sortKey{msg: msg}
+
+	// Messages without a valid Date header field are sorted by internal date,
+	// see RFC 5256 section 2.2
+	if date, err := h.Date(); err == nil && !date.IsZero() {
+		k.sentDate = date
+	} else {
+		k.sentDate = msg.Date
+	}
+
+	subject, _ := h.Subject()
+	k.subject, k.reply = BaseSubject(subject)
+	k.subject = asciiLower(k.subject)
+
+	k.from = firstMailbox(h, "From")
+	k.to = firstMailbox(h, "To")
+	k.cc = firstMailbox(h, "Cc")
+	return k
+}
+
+// firstMailbox returns the mailbox (the part before the "@") of the first
+// address in a header field, see RFC 5256 section 3.
+func firstMailbox(h mail.Header, key string) string {
+	addrs, err := h.AddressList(key)
+	if err != nil || len(addrs) == 0 {
+		return ""
+	}
+	mailbox := addrs[0].Address
+	if i := strings.LastIndexByte(mailbox, '@'); i >= 0 {
+		mailbox = mailbox[:i]
+	}
+	return asciiLower(mailbox)
+}
+
+// asciiLower implements the i;ascii-casemap collation used to compare strings.
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareUint(a, b uint32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (k *sortKey) compare(other *sortKey, field imap.SortField) int {
+	switch field {
+	case imap.SortArrival:
+		return compareTime(k.msg.Date, other.msg.Date)
+	case imap.SortCc:
+		return strings.Compare(k.cc, other.cc)
+	case imap.SortDate:
+		return compareTime(k.sentDate, other.sentDate)
+	case imap.SortFrom:
+		return strings.Compare(k.from, other.from)
+	case imap.SortSize:
+		return compareUint(k.msg.Size, other.msg.Size)
+	case imap.SortSubject:
+		return strings.Compare(k.subject, other.subject)
+	case imap.SortTo:
+		return strings.Compare(k.to, other.to)
+	}
+	return 0
+}
+
+// Sort orders messages according to the provided sort criteria, as defined in
+// RFC 5256 section 3, and returns their IDs. Messages must be given in
+// sequence number order: messages which compare equal keep this order.
+func Sort(msgs []*SortMessage, criteria []imap.SortCriterion) []uint32 {
+	keys := make([]*sortKey, len(msgs))
+	for i, msg := range msgs {
+		keys[i] = newSortKey(msg)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		for _, c := range criteria {
+			cmp := keys[i].compare(keys[j], c.Field)
+			if c.Reverse {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	ids := make([]uint32, len(keys))
+	for i, k := range keys {
+		ids[i] = k.msg.Id
+	}
+	return ids
+}
+
+// BaseSubject extracts the base subject of a decoded subject, as defined in
+// RFC 5256 section 2.1. reply is true if the subject indicates a reply or a
+// forward.
+func BaseSubject(subject string) (base string, reply bool) {
+	// (1) Reduce whitespace to a single space
+	s := strings.Join(strings.Fields(subject), " ")
+
+	for {
+		// (2) Remove trailing "(fwd)"
+		for {
+			trimmed := strings.TrimRight(s, " ")
+			if n := len(trimmed); n >= 5 && strings.EqualFold(trimmed[n-5:], "(fwd)") {
+				trimmed = trimmed[:n-5]
+				reply = true
+			}
+			if trimmed == s {
+				break
+			}
+			s = trimmed
+		}
+
+		// (3) and (4) Remove leading "Re:", "Fwd:" and "[blob]"
+		for {
+			prev := s
+			if rest, ok := trimSubjectLeader(s); ok {
+				s = rest
+				reply = true
+			}
+			if rest, ok := trimSubjectBlob(s); ok && rest != "" {
+				s = rest
+			}
+			if s == prev {
+				break
+			}
+		}
+
+		// (5) Remove "[fwd:" ... "]" and start over
+		if len(s) >= 6 && strings.EqualFold(s[:5], "[fwd:") && s[len(s)-1] == ']' {
+			s = strings.TrimSpace(s[5 : len(s)-1])
+			reply = true
+			continue
+		}
+		break
+	}
+
+	return s, reply
+}
+
+// trimSubjectBlob removes a leading subj-blob: "[" *BLOBCHAR "]" *WSP.
+func trimSubjectBlob(s string) (string, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return s, false
+	}
+	i := strings.IndexAny(s[1:], "[]")
+	if i < 0 || s[1+i] != ']' {
+		return s, false
+	}
+	return strings.TrimLeft(s[i+2:], " "), true
+}
+
+// trimSubjectLeader removes a leading subj-leader:
+// (*subj-blob subj-refwd) / WSP, where subj-refwd is
+// ("re" / ("fw" ["d"])) *WSP [subj-blob] ":".
+func trimSubjectLeader(s string) (string, bool) {
+	if strings.HasPrefix(s, " ") {
+		return strings.TrimLeft(s, " "), true
+	}
+
+	rest := s
+	for {
+		trimmed, ok := trimSubjectBlob(rest)
+		if !ok {
+			break
+		}
+		rest = trimmed
+	}
+
+	switch {
+	case len(rest) >= 3 && strings.EqualFold(rest[:3], "fwd"):
+		rest = rest[3:]
+	case len(rest) >= 2 && (strings.EqualFold(rest[:2], "fw") || strings.EqualFold(rest[:2], "re")):
+		rest = rest[2:]
+	default:
+		return s, false
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	if trimmed, ok := trimSubjectBlob(rest); ok {
+		rest = trimmed
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return s, false
+	}
+	return strings.TrimLeft(rest[1:], " "), true
+}
@@ -0,0 +1,108 @@
+package backendutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/message"
+)
+
+var sortDate = time.Date(2022, 5, 24, 20, 8, 0, 0, time.UTC)
+
+// newSortMessage builds a message from header fields, arrival is the number of
+// minutes after sortDate the message was received.
+func newSortMessage(t *testing.T, id uint32, arrival int, size uint32, header string) *SortMessage {
+	entity, err := message.Read(strings.NewReader(header + "\r\n"))
+	if err != nil {
+		t.Fatalf("message.Read(%q) = %v", header, err)
+	}
+	return &SortMessage{
+		Id:     id,
+		Entity: entity,
+		Date:   sortDate.Add(time.Duration(arrival) * time.Minute),
+		Size:   size,
+	}
+}
+
+func sortMessages(t *testing.T) []*SortMessage {
+	return []*SortMessage{
+		newSortMessage(t, 1, 3, 300, "Date: Sun, 01 May 2022 10:00:00 +0000\r\n"+
+			"Subject: Re: beta\r\nFrom: Carol <Carol@example.org>\r\nTo: bob@example.org\r\n"),
+		newSortMessage(t, 2, 1, 100, "Date: Tue, 03 May 2022 10:00:00 +0000\r\n"+
+			"Subject: alpha\r\nFrom: alice@example.org\r\nTo: dave@example.org\r\n"),
+		// No Date header field, sorted by internal date
+		newSortMessage(t, 3, 2, 200, "Subject: Beta\r\nFrom: Bob <bob@example.org>\r\n"+
+			"Cc: erin@example.org\r\n"),
+		newSortMessage(t, 4, 1, 100, "Date: Mon, 02 May 2022 10:00:00 +0000\r\n"+
+			"Subject: [list] Alpha\r\nFrom: ALICE@example.org\r\n"),
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		criteria string
+		want     []uint32
+	}{
+		{"ARRIVAL", []uint32{2, 4, 3, 1}},
+		{"REVERSE ARRIVAL", []uint32{1, 3, 2, 4}},
+		{"SIZE", []uint32{2, 4, 3, 1}},
+		{"REVERSE SIZE", []uint32{1, 3, 2, 4}},
+		{"DATE", []uint32{1, 4, 2, 3}},
+		{"REVERSE DATE", []uint32{3, 2, 4, 1}},
+		{"SUBJECT", []uint32{2, 4, 1, 3}},
+		{"SUBJECT REVERSE DATE", []uint32{2, 4, 3, 1}},
+		{"REVERSE SUBJECT DATE", []uint32{1, 3, 4, 2}},
+		{"FROM", []uint32{2, 4, 3, 1}},
+		{"FROM REVERSE DATE", []uint32{2, 4, 3, 1}},
+		{"FROM DATE", []uint32{4, 2, 3, 1}},
+		{"TO", []uint32{3, 4, 1, 2}},
+		{"CC", []uint32{1, 2, 4, 3}},
+		{"REVERSE CC SIZE", []uint32{3, 2, 4, 1}},
+	}
+
+	for _, test := range tests {
+		var fields []interface{}
+		for _, f := range strings.Fields(test.criteria) {
+			fields = append(fields, f)
+		}
+		criteria, err := imap.ParseSortCriteria(fields)
+		if err != nil {
+			t.Fatalf("ParseSortCriteria(%q) = %v", test.criteria, err)
+		}
+
+		if got := Sort(sortMessages(t), criteria); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Sort(%q) = %v, want %v", test.criteria, got, test.want)
+		}
+	}
+}
+
+func TestBaseSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		base    string
+		reply   bool
+	}{
+		{"", "", false},
+		{"Hello", "Hello", false},
+		{" Hello \t World ", "Hello World", false},
+		{"Re: Hello", "Hello", true},
+		{"re: FWD: Hello", "Hello", true},
+		{"Re[2]: Hello", "Hello", true},
+		{"[list] Hello", "Hello", false},
+		{"[list] Re: Hello", "Hello", true},
+		{"[only]", "[only]", false},
+		{"Hello (fwd) (FWD)", "Hello", true},
+		{"[Fwd: Re: Hello]", "Hello", true},
+		{"Reply", "Reply", false},
+	}
+
+	for _, test := range tests {
+		base, reply := BaseSubject(test.subject)
+		if base != test.base || reply != test.reply {
+			t.Errorf("BaseSubject(%q) = %q, %v, want %q, %v", test.subject, base, reply, test.base, test.reply)
+		}
+	}
+}
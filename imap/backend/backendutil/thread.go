@@ -0,0 +1,326 @@
+package backendutil
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/message/mail"
+)
+
+// ErrUnsupportedThreadAlgorithm is returned by Thread when the requested
+// algorithm isn't implemented.
+var ErrUnsupportedThreadAlgorithm = errors.New("Unsupported threading algorithm")
+
+// ThreadAlgorithms contains the threading algorithms implemented by Thread.
+var ThreadAlgorithms = []imap.ThreadAlgorithm{
+	imap.OrderedSubjectThreading,
+	imap.ReferencesThreading,
+}
+
+// Thread groups messages into threads using the provided algorithm, as defined
+// in RFC 5256 section 3. Messages must be given in sequence number order.
+func Thread(msgs []*SortMessage, algorithm imap.ThreadAlgorithm) ([]*imap.Thread, error) {
+	keys := make([]*sortKey, len(msgs))
+	for i, msg := range msgs {
+		keys[i] = newSortKey(msg)
+	}
+
+	switch algorithm {
+	case imap.OrderedSubjectThreading:
+		return threadOrderedSubject(keys), nil
+	case imap.ReferencesThreading:
+		return threadReferences(keys), nil
+	}
+	return nil, ErrUnsupportedThreadAlgorithm
+}
+
+// threadOrderedSubject implements the ORDEREDSUBJECT algorithm: messages with
+// the same base subject are children of the first one, in sent date order.
+func threadOrderedSubject(keys []*sortKey) []*imap.Thread {
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].subject != keys[j].subject {
+			return keys[i].subject < keys[j].subject
+		}
+		return keys[i].sentDate.Before(keys[j].sentDate)
+	})
+
+	var threads []*imap.Thread
+	var dates []*sortKey
+	for i, k := range keys {
+		if i > 0 && k.subject == keys[i-1].subject {
+			root := threads[len(threads)-1]
+			root.Children = append(root.Children, &imap.Thread{Id: k.msg.Id})
+			continue
+		}
+		threads = append(threads, &imap.Thread{Id: k.msg.Id})
+		dates = append(dates, k)
+	}
+
+	// Threads are ordered by the sent date of their first message
+	order := make([]int, len(threads))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return dates[order[i]].sentDate.Before(dates[order[j]].sentDate)
+	})
+	sorted := make([]*imap.Thread, len(threads))
+	for i, n := range order {
+		sorted[i] = threads[n]
+	}
+	return sorted
+}
+
+// container is a node of the REFERENCES algorithm. A container without a
+// message is a dummy.
+type container struct {
+	key      *sortKey
+	parent   *container
+	children []*container
+}
+
+func (c *container) hasDescendant(other *container) bool {
+	if c == other {
+		return true
+	}
+	for _, child := range c.children {
+		if child.hasDescendant(other) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *container) addChild(child *container) {
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+func (c *container) removeChild(child *container) {
+	for i, ch := range c.children {
+		if ch == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// first returns the key of the container, or of its first child if it's a
+// dummy.
+func (c *container) first() *sortKey {
+	if c.key != nil {
+		return c.key
+	}
+	if len(c.children) > 0 {
+		return c.children[0].first()
+	}
+	return nil
+}
+
+// threadReferences implements the REFERENCES algorithm described in RFC 5256
+// section 3.
+func threadReferences(keys []*sortKey) []*imap.Thread {
+	// (1) Link messages using the Message-ID, References and In-Reply-To header
+	// fields
+	table := make(map[string]*container)
+	var all []*container
+	get := func(id string) *container {
+		c, ok := table[id]
+		if !ok {
+			c = new(container)
+			table[id] = c
+			all = append(all, c)
+		}
+		return c
+	}
+
+	for i, k := range keys {
+		h := mail.Header{Header: k.msg.Entity.Header}
+
+		var c *container
+		if id, err := h.MessageID(); err == nil && id != "" {
+			c = get(id)
+		}
+		if c == nil || c.key != nil {
+			// Messages without Message-ID or with a duplicate one are unique
+			c = get("\x00" + strconv.Itoa(i))
+		}
+		c.key = k
+
+		refs, _ := h.MsgIDList("References")
+		if len(refs) == 0 {
+			if inReplyTo, _ := h.MsgIDList("In-Reply-To"); len(inReplyTo) > 0 {
+				refs = inReplyTo[:1]
+			}
+		}
+
+		var prev *container
+		for _, id := range refs {
+			ref := get(id)
+			if prev != nil && ref.parent == nil && !ref.hasDescendant(prev) {
+				prev.addChild(ref)
+			}
+			prev = ref
+		}
+
+		if c.parent != nil {
+			c.parent.removeChild(c)
+		}
+		if prev != nil && !c.hasDescendant(prev) {
+			prev.addChild(c)
+		}
+	}
+
+	// (2) Gather the root set
+	var roots []*container
+	for _, c := range all {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+
+	// (4) Prune dummies
+	roots = pruneContainers(roots, true)
+
+	// (5) Group the root set by base subject
+	roots = groupBySubject(roots)
+
+	// (6) Sort siblings by sent date
+	sortContainers(roots)
+
+	threads := make([]*imap.Thread, len(roots))
+	for i, c := range roots {
+		threads[i] = containerThread(c)
+	}
+	return threads
+}
+
+// pruneContainers removes dummies without children and replaces the other
+// dummies with their children, except at the root level if they have more than
+// one child.
+func pruneContainers(list []*container, root bool) []*container {
+	var pruned []*container
+	for _, c := range list {
+		c.children = pruneContainers(c.children, false)
+		for _, child := range c.children {
+			child.parent = c
+		}
+
+		if c.key != nil {
+			pruned = append(pruned, c)
+			continue
+		}
+		if len(c.children) == 0 {
+			continue
+		}
+		if !root || len(c.children) == 1 {
+			for _, child := range c.children {
+				child.parent = c.parent
+			}
+			pruned = append(pruned, c.children...)
+			continue
+		}
+		pruned = append(pruned, c)
+	}
+	return pruned
+}
+
+// groupBySubject merges root containers which have the same base subject.
+func groupBySubject(roots []*container) []*container {
+	subjects := make(map[string]*container)
+	for _, c := range roots {
+		k := c.first()
+		if k == nil || k.subject == "" {
+			continue
+		}
+		old, ok := subjects[k.subject]
+		if !ok {
+			subjects[k.subject] = c
+			continue
+		}
+		// Prefer dummies, then non-replies
+		if (c.key == nil && old.key != nil) || (c.key != nil && old.key != nil && old.key.reply && !c.key.reply) {
+			subjects[k.subject] = c
+		}
+	}
+
+	var merged []*container
+	for _, c := range roots {
+		if c.parent != nil {
+			continue
+		}
+		k := c.first()
+		if k == nil || k.subject == "" {
+			merged = append(merged, c)
+			continue
+		}
+		old := subjects[k.subject]
+		if old == c {
+			merged = append(merged, c)
+			continue
+		}
+
+		switch {
+		case old.key == nil && c.key == nil:
+			for _, child := range append([]*container(nil), c.children...) {
+				old.addChild(child)
+			}
+		case old.key == nil:
+			old.addChild(c)
+		case !old.key.reply && c.key.reply:
+			old.addChild(c)
+		default:
+			dummy := new(container)
+			replaced := replaceContainer(merged, old, dummy)
+			dummy.addChild(old)
+			dummy.addChild(c)
+			subjects[k.subject] = dummy
+			if !replaced {
+				merged = append(merged, dummy)
+			}
+		}
+	}
+	return merged
+}
+
+func replaceContainer(list []*container, old, c *container) bool {
+	for i, item := range list {
+		if item == old {
+			list[i] = c
+			return true
+		}
+	}
+	return false
+}
+
+// sortContainers sorts siblings by sent date. A dummy is sorted by the date
+// of its first child.
+func sortContainers(list []*container) {
+	for _, c := range list {
+		sortContainers(c.children)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].first(), list[j].first()
+		if !a.sentDate.Equal(b.sentDate) {
+			return a.sentDate.Before(b.sentDate)
+		}
+		return a.msg.Id < b.msg.Id
+	})
+}
+
+func containerThread(c *container) *imap.Thread {
+	thread := new(imap.Thread)
+	if c.key != nil {
+		thread.Id = c.key.msg.Id
+	}
+	for _, child := range c.children {
+		thread.Children = append(thread.Children, containerThread(child))
+	}
+	return thread
+}
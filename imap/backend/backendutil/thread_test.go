@@ -0,0 +1,162 @@
+package backendutil
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// formatThreads formats threads as "1{2{3},4} 5", a dummy node is "-".
+func formatThreads(threads []*imap.Thread) string {
+	s := make([]string, len(threads))
+	for i, thread := range threads {
+		s[i] = formatThread(thread)
+	}
+	return strings.Join(s, " ")
+}
+
+func formatThread(thread *imap.Thread) string {
+	label := "-"
+	if thread.Id != 0 {
+		label = strconv.Itoa(int(thread.Id))
+	}
+	if len(thread.Children) == 0 {
+		return label
+	}
+	children := make([]string, len(thread.Children))
+	for i, child := range thread.Children {
+		children[i] = formatThread(child)
+	}
+	return label + "{" + strings.Join(children, ",") + "}"
+}
+
+func TestThread_orderedSubject(t *testing.T) {
+	threads, err := Thread(sortMessages(t), imap.OrderedSubjectThreading)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := formatThreads(threads), "1{3} 4{2}"; got != want {
+		t.Errorf("Thread(ORDEREDSUBJECT) = %q, want %q", got, want)
+	}
+}
+
+func TestThread_references(t *testing.T) {
+	type testMessage struct {
+		header string
+		day    int
+	}
+	tests := []struct {
+		name     string
+		messages []testMessage
+		want     string
+	}{
+		{
+			name: "references",
+			messages: []testMessage{
+				{"Message-Id: <a@x>\r\nSubject: hello\r\n", 1},
+				{"Message-Id: <b@x>\r\nReferences: <a@x>\r\nSubject: Re: hello\r\n", 2},
+				{"Message-Id: <c@x>\r\nReferences: <a@x> <b@x>\r\nSubject: Re: hello\r\n", 3},
+				{"Message-Id: <d@x>\r\nReferences: <a@x>\r\nSubject: Re: hello\r\n", 4},
+			},
+			want: "1{2{3},4}",
+		},
+		{
+			name: "in-reply-to",
+			messages: []testMessage{
+				{"Message-Id: <a@x>\r\nSubject: hello\r\n", 1},
+				{"Message-Id: <b@x>\r\nIn-Reply-To: <a@x>\r\nSubject: Re: hello\r\n", 2},
+			},
+			want: "1{2}",
+		},
+		{
+			name: "sent date order",
+			messages: []testMessage{
+				{"Message-Id: <c@x>\r\nReferences: <a@x> <b@x>\r\nSubject: c\r\n", 3},
+				{"Message-Id: <b@x>\r\nReferences: <a@x>\r\nSubject: b\r\n", 2},
+				{"Message-Id: <a@x>\r\nSubject: a\r\n", 1},
+				{"Message-Id: <z@x>\r\nSubject: z\r\n", 0},
+			},
+			want: "4 3{2{1}}",
+		},
+		{
+			name: "missing parent",
+			messages: []testMessage{
+				{"Message-Id: <b@x>\r\nReferences: <x@x>\r\nSubject: b\r\n", 1},
+			},
+			want: "1",
+		},
+		{
+			name: "missing parent with several replies",
+			messages: []testMessage{
+				{"Message-Id: <b@x>\r\nReferences: <x@x>\r\nSubject: b\r\n", 1},
+				{"Message-Id: <c@x>\r\nReferences: <x@x>\r\nSubject: c\r\n", 2},
+			},
+			want: "-{1,2}",
+		},
+		{
+			name: "missing intermediate message",
+			messages: []testMessage{
+				{"Message-Id: <a@x>\r\nSubject: a\r\n", 1},
+				{"Message-Id: <c@x>\r\nReferences: <a@x> <b@x>\r\nSubject: c\r\n", 2},
+			},
+			want: "1{2}",
+		},
+		{
+			name: "loop",
+			messages: []testMessage{
+				{"Message-Id: <a@x>\r\nReferences: <b@x>\r\nSubject: a\r\n", 1},
+				{"Message-Id: <b@x>\r\nReferences: <a@x>\r\nSubject: b\r\n", 2},
+			},
+			want: "2{1}",
+		},
+		{
+			name: "duplicate message-id",
+			messages: []testMessage{
+				{"Message-Id: <a@x>\r\nSubject: a\r\n", 1},
+				{"Message-Id: <a@x>\r\nSubject: b\r\n", 2},
+			},
+			want: "1 2",
+		},
+		{
+			name: "same subject",
+			messages: []testMessage{
+				{"Subject: hello\r\n", 1},
+				{"Subject: Re: hello\r\n", 2},
+				{"Subject: other\r\n", 3},
+			},
+			want: "1{2} 3",
+		},
+		{
+			name: "same subject without original",
+			messages: []testMessage{
+				{"Subject: Re: hello\r\n", 1},
+				{"Subject: Re: Hello\r\n", 2},
+			},
+			want: "-{1,2}",
+		},
+	}
+
+	for _, test := range tests {
+		msgs := make([]*SortMessage, len(test.messages))
+		for i, m := range test.messages {
+			msgs[i] = newSortMessage(t, uint32(i+1), 0, 0, "Date: "+
+				sortDate.AddDate(0, 0, m.day).Format("Mon, 02 Jan 2006 15:04:05 -0700")+"\r\n"+m.header)
+		}
+
+		threads, err := Thread(msgs, imap.ReferencesThreading)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatThreads(threads); got != test.want {
+			t.Errorf("%s: Thread(REFERENCES) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestThread_unsupported(t *testing.T) {
+	if _, err := Thread(sortMessages(t), imap.ThreadAlgorithm("FOO")); err != ErrUnsupportedThreadAlgorithm {
+		t.Errorf("Thread(FOO) = %v, want %v", err, ErrUnsupportedThreadAlgorithm)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/zhangdapeng520/zdpgo_imap/imap"
 	"github.com/zhangdapeng520/zdpgo_imap/imap/backend"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend/backendutil"
 )
 
 type Backend struct {
@@ -22,6 +23,22 @@ func (be *Backend) Login(_ *imap.ConnInfo, username, password string) (backend.U
 	return nil, errors.New("Bad username or password")
 }
 
+func (be *Backend) SupportModSeq() bool {
+	return true
+}
+
+func (be *Backend) SupportUidPlus() bool {
+	return true
+}
+
+func (be *Backend) SupportSort() bool {
+	return true
+}
+
+func (be *Backend) ThreadAlgorithms() []imap.ThreadAlgorithm {
+	return backendutil.ThreadAlgorithms
+}
+
 func New() *Backend {
 	user := &User{username: "username", password: "password"}
 
@@ -45,6 +62,8 @@ func New() *Backend {
 					Flags: []string{"\\Seen"},
 					Size:  uint32(len(body)),
 					Body:  []byte(body),
+
+					ModSeq: 1,
 				},
 			},
 		},
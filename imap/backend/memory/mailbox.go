@@ -17,6 +17,16 @@ type Mailbox struct {
 
 	name string
 	user *User
+
+	// The last mod-sequence given to a change in this mailbox, and the
+	// messages expunged so far, needed for QRESYNC.
+	modSeq   uint64
+	expunged []expungedMessage
+}
+
+type expungedMessage struct {
+	uid    uint32
+	modSeq uint64
 }
 
 func (mbox *Mailbox) Name() string {
@@ -38,10 +48,35 @@ func (mbox *Mailbox) uidNext() uint32 {
 			uid = msg.Uid
 		}
 	}
+	// UIDs of expunged messages must not be reused
+	for _, msg := range mbox.expunged {
+		if msg.uid > uid {
+			uid = msg.uid
+		}
+	}
 	uid++
 	return uid
 }
 
+func (mbox *Mailbox) highestModSeq() uint64 {
+	modSeq := mbox.modSeq
+	for _, msg := range mbox.Messages {
+		if msg.ModSeq > modSeq {
+			modSeq = msg.ModSeq
+		}
+	}
+	// Zero means that mod-sequences aren't supported
+	if modSeq == 0 {
+		modSeq = 1
+	}
+	return modSeq
+}
+
+func (mbox *Mailbox) nextModSeq() uint64 {
+	mbox.modSeq = mbox.highestModSeq() + 1
+	return mbox.modSeq
+}
+
 func (mbox *Mailbox) flags() []string {
 	flagsMap := make(map[string]bool)
 	for _, msg := range mbox.Messages {
@@ -96,6 +131,8 @@ func (mbox *Mailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error
 			status.Recent = 0 // TODO
 		case imap.StatusUnseen:
 			status.Unseen = 0 // TODO
+		case imap.StatusHighestModSeq:
+			status.HighestModSeq = mbox.highestModSeq()
 		}
 	}
 
@@ -159,27 +196,93 @@ func (mbox *Mailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]
 	return ids, nil
 }
 
+// sortMessages returns the messages that match the criteria.
+func (mbox *Mailbox) sortMessages(uid bool, criteria *imap.SearchCriteria) ([]*backendutil.SortMessage, error) {
+	var msgs []*backendutil.SortMessage
+	for i, msg := range mbox.Messages {
+		seqNum := uint32(i + 1)
+
+		ok, err := msg.Match(seqNum, criteria)
+		if err != nil || !ok {
+			continue
+		}
+
+		e, err := msg.entity()
+		if err != nil {
+			return nil, err
+		}
+
+		id := seqNum
+		if uid {
+			id = msg.Uid
+		}
+		msgs = append(msgs, &backendutil.SortMessage{
+			Id:     id,
+			Entity: e,
+			Date:   msg.Date,
+			Size:   msg.Size,
+		})
+	}
+	return msgs, nil
+}
+
+func (mbox *Mailbox) SortMessages(uid bool, sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria) ([]uint32, error) {
+	msgs, err := mbox.sortMessages(uid, criteria)
+	if err != nil {
+		return nil, err
+	}
+	return backendutil.Sort(msgs, sortCriteria), nil
+}
+
+func (mbox *Mailbox) ThreadMessages(uid bool, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*imap.Thread, error) {
+	msgs, err := mbox.sortMessages(uid, criteria)
+	if err != nil {
+		return nil, err
+	}
+	return backendutil.Thread(msgs, algorithm)
+}
+
 func (mbox *Mailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	_, err := mbox.CreateMessageUid(flags, date, body)
+	return err
+}
+
+func (mbox *Mailbox) CreateMessageUid(flags []string, date time.Time, body imap.Literal) (*imap.AppendData, error) {
 	if date.IsZero() {
 		date = time.Now()
 	}
 
 	b, err := ioutil.ReadAll(body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	mbox.Messages = append(mbox.Messages, &Message{
+	msg := &Message{
 		Uid:   mbox.uidNext(),
 		Date:  date,
 		Size:  uint32(len(b)),
 		Flags: flags,
 		Body:  b,
-	})
-	return nil
+
+		ModSeq: mbox.nextModSeq(),
+	}
+	mbox.Messages = append(mbox.Messages, msg)
+	return &imap.AppendData{UidValidity: 1, Uid: msg.Uid}, nil
 }
 
 func (mbox *Mailbox) UpdateMessagesFlags(uid bool, seqset *imap.SeqSet, op imap.FlagsOp, flags []string) error {
+	_, err := mbox.updateMessagesFlags(uid, seqset, 0, false, op, flags)
+	return err
+}
+
+func (mbox *Mailbox) UpdateMessagesFlagsUnchangedSince(uid bool, seqset *imap.SeqSet, unchangedSince uint64, op imap.FlagsOp, flags []string) (*imap.SeqSet, error) {
+	return mbox.updateMessagesFlags(uid, seqset, unchangedSince, true, op, flags)
+}
+
+func (mbox *Mailbox) updateMessagesFlags(uid bool, seqset *imap.SeqSet, unchangedSince uint64, conditional bool, op imap.FlagsOp, flags []string) (*imap.SeqSet, error) {
+	// All the messages altered by a single command share the same mod-sequence
+	var modSeq uint64
+	modified := new(imap.SeqSet)
 	for i, msg := range mbox.Messages {
 		var id uint32
 		if uid {
@@ -190,19 +293,60 @@ func (mbox *Mailbox) UpdateMessagesFlags(uid bool, seqset *imap.SeqSet, op imap.
 		if !seqset.Contains(id) {
 			continue
 		}
+		if conditional && msg.ModSeq > unchangedSince {
+			modified.AddNum(id)
+			continue
+		}
 
-		msg.Flags = backendutil.UpdateFlags(msg.Flags, op, flags)
+		updated := backendutil.UpdateFlags(msg.Flags, op, flags)
+		if equalFlags(msg.Flags, updated) {
+			continue
+		}
+		if modSeq == 0 {
+			modSeq = mbox.nextModSeq()
+		}
+		msg.Flags = updated
+		msg.ModSeq = modSeq
 	}
 
-	return nil
+	if modified.Empty() {
+		return nil, nil
+	}
+	return modified, nil
+}
+
+func equalFlags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, flag := range a {
+		set[flag] = true
+	}
+	for _, flag := range b {
+		if !set[flag] {
+			return false
+		}
+	}
+	return true
 }
 
 func (mbox *Mailbox) CopyMessages(uid bool, seqset *imap.SeqSet, destName string) error {
+	_, err := mbox.CopyMessagesUid(uid, seqset, destName)
+	return err
+}
+
+func (mbox *Mailbox) CopyMessagesUid(uid bool, seqset *imap.SeqSet, destName string) (*imap.CopyData, error) {
 	dest, ok := mbox.user.mailboxes[destName]
 	if !ok {
-		return backend.ErrNoSuchMailbox
+		return nil, backend.ErrNoSuchMailbox
 	}
 
+	data := &imap.CopyData{
+		UidValidity: 1,
+		SourceUids:  new(imap.SeqSet),
+		DestUids:    new(imap.SeqSet),
+	}
 	for i, msg := range mbox.Messages {
 		var id uint32
 		if uid {
@@ -216,28 +360,76 @@ func (mbox *Mailbox) CopyMessages(uid bool, seqset *imap.SeqSet, destName string
 
 		msgCopy := *msg
 		msgCopy.Uid = dest.uidNext()
+		msgCopy.ModSeq = dest.nextModSeq()
 		dest.Messages = append(dest.Messages, &msgCopy)
+
+		data.SourceUids.AddNum(msg.Uid)
+		data.DestUids.AddNum(msgCopy.Uid)
 	}
 
-	return nil
+	return data, nil
+}
+
+func (mbox *Mailbox) MoveMessages(uid bool, seqset *imap.SeqSet, destName string) error {
+	_, err := mbox.MoveMessagesUid(uid, seqset, destName)
+	return err
+}
+
+func (mbox *Mailbox) MoveMessagesUid(uid bool, seqset *imap.SeqSet, destName string) (*imap.CopyData, error) {
+	data, err := mbox.CopyMessagesUid(uid, seqset, destName)
+	if err != nil {
+		return nil, err
+	}
+
+	mbox.expunge(func(msg *Message) bool {
+		return data.SourceUids.Contains(msg.Uid)
+	})
+	return data, nil
 }
 
 func (mbox *Mailbox) Expunge() error {
+	mbox.expunge(isDeleted)
+	return nil
+}
+
+func (mbox *Mailbox) ExpungeUids(uids *imap.SeqSet) error {
+	mbox.expunge(func(msg *Message) bool {
+		return uids.Contains(msg.Uid) && isDeleted(msg)
+	})
+	return nil
+}
+
+func (mbox *Mailbox) expunge(remove func(msg *Message) bool) {
+	var modSeq uint64
 	for i := len(mbox.Messages) - 1; i >= 0; i-- {
 		msg := mbox.Messages[i]
+		if !remove(msg) {
+			continue
+		}
 
-		deleted := false
-		for _, flag := range msg.Flags {
-			if flag == imap.DeletedFlag {
-				deleted = true
-				break
-			}
+		if modSeq == 0 {
+			modSeq = mbox.nextModSeq()
 		}
+		mbox.expunged = append(mbox.expunged, expungedMessage{uid: msg.Uid, modSeq: modSeq})
+		mbox.Messages = append(mbox.Messages[:i], mbox.Messages[i+1:]...)
+	}
+}
 
-		if deleted {
-			mbox.Messages = append(mbox.Messages[:i], mbox.Messages[i+1:]...)
+func isDeleted(msg *Message) bool {
+	for _, flag := range msg.Flags {
+		if flag == imap.DeletedFlag {
+			return true
 		}
 	}
+	return false
+}
 
-	return nil
+func (mbox *Mailbox) ExpungedSince(modSeq uint64, uids *imap.SeqSet) (*imap.SeqSet, error) {
+	set := new(imap.SeqSet)
+	for _, msg := range mbox.expunged {
+		if msg.modSeq > modSeq && (uids == nil || uids.Contains(msg.uid)) {
+			set.AddNum(msg.uid)
+		}
+	}
+	return set, nil
 }
@@ -13,11 +13,12 @@ import (
 )
 
 type Message struct {
-	Uid   uint32
-	Date  time.Time
-	Size  uint32
-	Flags []string
-	Body  []byte
+	Uid    uint32
+	Date   time.Time
+	Size   uint32
+	Flags  []string
+	Body   []byte
+	ModSeq uint64
 }
 
 func (m *Message) entity() (*message.Entity, error) {
@@ -48,6 +49,8 @@ func (m *Message) Fetch(seqNum uint32, items []imap.FetchItem) (*imap.Message, e
 			fetched.Size = m.Size
 		case imap.FetchUid:
 			fetched.Uid = m.Uid
+		case imap.FetchModSeq:
+			fetched.ModSeq = m.ModSeq
 		default:
 			section, err := imap.ParseBodySectionName(item)
 			if err != nil {
@@ -70,5 +73,5 @@ func (m *Message) Fetch(seqNum uint32, items []imap.FetchItem) (*imap.Message, e
 
 func (m *Message) Match(seqNum uint32, c *imap.SearchCriteria) (bool, error) {
 	e, _ := m.entity()
-	return backendutil.Match(e, seqNum, m.Uid, m.Date, m.Flags, c)
+	return backendutil.MatchModSeq(e, seqNum, m.Uid, m.ModSeq, m.Date, m.Flags, c)
 }
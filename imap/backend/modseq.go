@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// ModSeqBackend is a backend whose mailboxes track a mod-sequence for each
+// message, as defined in RFC 7162. The server advertises the CONDSTORE and
+// QRESYNC extensions only if the backend implements this interface.
+type ModSeqBackend interface {
+	Backend
+
+	// SupportModSeq returns true if all mailboxes implement ModSeqMailbox.
+	SupportModSeq() bool
+}
+
+// ModSeqMailbox is a mailbox that tracks a mod-sequence for each message.
+//
+// Every change to a message (creation or flags update) must give it a
+// mod-sequence greater than all the existing ones in the mailbox. In addition
+// to the methods below, such a mailbox must support imap.StatusHighestModSeq
+// in Status, imap.FetchModSeq in ListMessages and the ModSeq search criteria in
+// SearchMessages.
+type ModSeqMailbox interface {
+	Mailbox
+
+	// UpdateMessagesFlagsUnchangedSince is like UpdateMessagesFlags, but only
+	// alters messages whose mod-sequence is lower than or equal to
+	// unchangedSince. It returns the sequence numbers, or the UIDs if uid is
+	// true, of the messages that have been left untouched because they were
+	// modified in the meantime.
+	UpdateMessagesFlagsUnchangedSince(uid bool, seqset *imap.SeqSet, unchangedSince uint64, operation imap.FlagsOp, flags []string) (modified *imap.SeqSet, err error)
+
+	// ExpungedSince returns the UIDs of the messages that have been expunged
+	// after the mod-sequence modSeq. If uids is not nil, only UIDs in this set
+	// are returned.
+	ExpungedSince(modSeq uint64, uids *imap.SeqSet) (*imap.SeqSet, error)
+}
@@ -0,0 +1,45 @@
+package backend
+
+import (
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// SortBackend is a backend whose mailboxes can sort messages, as defined in
+// RFC 5256. The server advertises the SORT extension only if the backend
+// implements this interface.
+type SortBackend interface {
+	Backend
+
+	// SupportSort returns true if all mailboxes implement SortMailbox.
+	SupportSort() bool
+}
+
+// SortMailbox is a mailbox that supports the SORT extension.
+type SortMailbox interface {
+	Mailbox
+
+	// SortMessages searches messages like SearchMessages and returns their
+	// sequence numbers, or UIDs if uid is true, ordered by sortCriteria.
+	SortMessages(uid bool, sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria) ([]uint32, error)
+}
+
+// ThreadBackend is a backend whose mailboxes can group messages into threads,
+// as defined in RFC 5256. The server advertises a THREAD capability for each
+// of the returned algorithms.
+type ThreadBackend interface {
+	Backend
+
+	// ThreadAlgorithms returns the algorithms supported by all mailboxes,
+	// which must implement ThreadMailbox.
+	ThreadAlgorithms() []imap.ThreadAlgorithm
+}
+
+// ThreadMailbox is a mailbox that supports the THREAD extension.
+type ThreadMailbox interface {
+	Mailbox
+
+	// ThreadMessages searches messages like SearchMessages and groups them
+	// into threads using the provided algorithm. Thread IDs are sequence
+	// numbers, or UIDs if uid is true.
+	ThreadMessages(uid bool, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*imap.Thread, error)
+}
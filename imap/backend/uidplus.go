@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// UidPlusBackend is a backend that supports the UIDPLUS extension, defined in
+// RFC 4315. The server advertises UIDPLUS only if the backend implements this
+// interface.
+type UidPlusBackend interface {
+	Backend
+
+	// SupportUidPlus returns true if all mailboxes implement UidPlusMailbox.
+	SupportUidPlus() bool
+}
+
+// UidPlusMailbox is a mailbox that reports the UIDs assigned to new messages
+// and supports expunging a subset of the deleted messages.
+type UidPlusMailbox interface {
+	Mailbox
+
+	// CreateMessageUid is like CreateMessage, but returns the UIDVALIDITY of
+	// the mailbox and the UID assigned to the new message.
+	CreateMessageUid(flags []string, date time.Time, body imap.Literal) (*imap.AppendData, error)
+
+	// CopyMessagesUid is like CopyMessages, but returns the UIDVALIDITY of the
+	// destination mailbox, the UIDs of the copied messages and the UIDs
+	// assigned to their copies.
+	CopyMessagesUid(uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyData, error)
+
+	// ExpungeUids is like Expunge, but only removes the messages whose UID is
+	// in uids.
+	ExpungeUids(uids *imap.SeqSet) error
+}
+
+// UidPlusMoveMailbox is a mailbox that reports the UIDs assigned to moved
+// messages.
+type UidPlusMoveMailbox interface {
+	MoveMailbox
+
+	// MoveMessagesUid is like MoveMessages, but returns the same data as
+	// UidPlusMailbox.CopyMessagesUid.
+	MoveMessagesUid(uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyData, error)
+}
@@ -6,6 +6,7 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -60,11 +61,30 @@ type MessageUpdate struct {
 
 func (u *MessageUpdate) update() {}
 
+// VanishedUpdate is delivered when messages are deleted and QRESYNC is
+// enabled. It replaces ExpungeUpdate, see RFC 7162 section 3.2.10.
+type VanishedUpdate struct {
+	// True if the messages were deleted before the current command, e.g.
+	// when resynchronizing a mailbox.
+	Earlier bool
+	Uids    *imap.SeqSet
+}
+
+func (u *VanishedUpdate) update() {}
+
 // Client is an IMAP client.
+//
+// Methods ending with Context accept a context.Context. When the context is
+// done before the command has been sent, the command is not sent and the
+// connection is still usable. When the context is done while waiting for the
+// server's response, the connection is closed because IMAP has no way to
+// cancel a running command: the client switches to imap.LogoutState and the
+// context error is returned.
 type Client struct {
-	conn       *imap.Conn
-	isTLS      bool
-	serverName string
+	conn         *imap.Conn
+	isTLS        bool
+	isCompressed bool
+	serverName   string
 
 	loggedOut chan struct{}
 	continues chan<- bool
@@ -178,6 +198,78 @@ type handleResult struct {
 }
 
 func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	return c.executeContext(context.Background(), cmdr, h)
+}
+
+// abortTimeout is the maximum amount of time abort waits for the reader
+// goroutine to stop.
+const abortTimeout = time.Second
+
+// abort closes the connection after a command has been cancelled while the
+// server was still processing it. The IMAP protocol has no way to cancel a
+// running command, so the connection can't be used anymore.
+func (c *Client) abort() {
+	c.SetState(imap.LogoutState, nil)
+	c.conn.Close()
+
+	// Wait for the reader goroutine to stop, so that no response handler is
+	// still running when the caller returns. The reader may be blocked sending
+	// an unilateral update to c.Updates, so don't wait forever.
+	select {
+	case <-c.loggedOut:
+	case <-time.After(abortTimeout):
+	}
+}
+
+// writeCommand sends cmd to the server. If ctx is done before the command has
+// been written, the connection is aborted and ctx.Err() is returned. This
+// interrupts a blocked write and a literal waiting for the server's
+// continuation request.
+func (c *Client) writeCommand(ctx context.Context, cmd *imap.Command, flush bool) error {
+	if ctx.Done() == nil {
+		// The context can't be cancelled
+		if err := cmd.WriteTo(c.conn.Writer); err != nil || !flush {
+			return err
+		}
+		return c.conn.Writer.Flush()
+	}
+
+	done := make(chan struct{})
+	aborted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.abort()
+			// Unblock a pending literal write
+			select {
+			case c.continues <- false:
+			case <-done:
+			}
+			aborted <- true
+		case <-done:
+			aborted <- false
+		}
+	}()
+
+	err := cmd.WriteTo(c.conn.Writer)
+	if err == nil && flush {
+		err = c.conn.Writer.Flush()
+	}
+	close(done)
+
+	if <-aborted {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (c *Client) executeContext(ctx context.Context, cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	// Don't send anything if the context is already done, the connection is
+	// still usable in this case.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	cmd := cmdr.Command()
 	cmd.Tag = generateTag()
 
@@ -245,8 +337,8 @@ func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 		return responses.ErrUnhandled
 	}))
 
-	// Send the command to the server
-	if err := cmd.WriteTo(c.conn.Writer); err != nil {
+	// Send the command to the server, flush writer if we are upgrading
+	if err := c.writeCommand(ctx, cmd, upgrading); err != nil {
 		// Error while sending the command
 		close(unregister)
 
@@ -263,14 +355,6 @@ func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 
 		return nil, err
 	}
-	// Flush writer if we are upgrading
-	if upgrading {
-		if err := c.conn.Writer.Flush(); err != nil {
-			// Error while sending the command
-			close(unregister)
-			return nil, err
-		}
-	}
 
 	for {
 		select {
@@ -287,6 +371,17 @@ func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 			// ends.
 			close(unregister)
 			return nil, errClosed
+		case <-ctx.Done():
+			// The command has been sent but its response is still pending.
+			close(unregister)
+			select {
+			case result := <-doneHandle:
+				// The response arrived in the meantime
+				return result.status, result.err
+			default:
+			}
+			c.abort()
+			return nil, ctx.Err()
 		case result := <-doneHandle:
 			return result.status, result.err
 		}
@@ -332,6 +427,17 @@ func (c *Client) Execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 	return c.execute(cmdr, h)
 }
 
+// ExecuteContext is like Execute, but the command is aborted when ctx is done.
+// If ctx is done before the command is sent, the connection is left untouched.
+// Otherwise the connection is closed, the client switches to the logout state
+// and ctx.Err() is returned.
+//
+// This function should not be called directly, it must only be used by
+// libraries implementing extensions of the IMAP protocol.
+func (c *Client) ExecuteContext(ctx context.Context, cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	return c.executeContext(ctx, cmdr, h)
+}
+
 func (c *Client) handleContinuationReqs() {
 	c.registerHandler(responses.HandlerFunc(func(resp imap.Resp) error {
 		if _, ok := resp.(*imap.ContinuationReq); ok {
@@ -368,6 +474,14 @@ func (c *Client) handleUnilateral() {
 
 			switch resp.Type {
 			case imap.StatusRespOk, imap.StatusRespNo, imap.StatusRespBad:
+				if resp.Code == imap.CodeHighestModSeq && len(resp.Arguments) > 0 && c.Mailbox() != nil {
+					if modSeq, err := imap.ParseNumber64(resp.Arguments[0]); err == nil {
+						c.locker.Lock()
+						c.mailbox.HighestModSeq = modSeq
+						c.locker.Unlock()
+					}
+				}
+
 				if c.Updates != nil {
 					c.Updates <- &StatusUpdate{resp}
 				}
@@ -448,6 +562,15 @@ func (c *Client) handleUnilateral() {
 				if c.Updates != nil {
 					c.Updates <- &MessageUpdate{msg}
 				}
+			case "VANISHED":
+				vanished := new(responses.Vanished)
+				if err := vanished.Handle(resp); err != nil {
+					break
+				}
+
+				if c.Updates != nil {
+					c.Updates <- &VanishedUpdate{vanished.Earlier, vanished.Uids}
+				}
 			default:
 				return responses.ErrUnhandled
 			}
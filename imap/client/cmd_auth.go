@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -26,16 +27,20 @@ func (c *Client) ensureAuthenticated() error {
 // Even if the readOnly parameter is set to false, the server can decide to open
 // the mailbox in read-only mode.
 func (c *Client) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	return c.SelectContext(context.Background(), name, readOnly)
+}
+
+// SelectContext is like Select, but the command is aborted when ctx is done.
+func (c *Client) SelectContext(ctx context.Context, name string, readOnly bool) (*imap.MailboxStatus, error) {
+	return c.selectCommand(ctx, &commands.Select{Mailbox: name, ReadOnly: readOnly})
+}
+
+func (c *Client) selectCommand(ctx context.Context, cmd *commands.Select) (*imap.MailboxStatus, error) {
 	if err := c.ensureAuthenticated(); err != nil {
 		return nil, err
 	}
 
-	cmd := &commands.Select{
-		Mailbox:  name,
-		ReadOnly: readOnly,
-	}
-
-	mbox := &imap.MailboxStatus{Name: name, Items: make(map[imap.StatusItem]interface{})}
+	mbox := &imap.MailboxStatus{Name: cmd.Mailbox, Items: make(map[imap.StatusItem]interface{})}
 	res := &responses.Select{
 		Mailbox: mbox,
 	}
@@ -43,7 +48,7 @@ func (c *Client) Select(name string, readOnly bool) (*imap.MailboxStatus, error)
 	c.mailbox = mbox
 	c.locker.Unlock()
 
-	status, err := c.execute(cmd, res)
+	status, err := c.executeContext(ctx, cmd, res)
 	if err != nil {
 		c.locker.Lock()
 		c.mailbox = nil
@@ -211,6 +216,11 @@ func (c *Client) Lsub(ref, name string, ch chan *imap.MailboxInfo) error {
 //
 // See RFC 3501 section 6.3.10 for a list of items that can be requested.
 func (c *Client) Status(name string, items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	return c.StatusContext(context.Background(), name, items)
+}
+
+// StatusContext is like Status, but the command is aborted when ctx is done.
+func (c *Client) StatusContext(ctx context.Context, name string, items []imap.StatusItem) (*imap.MailboxStatus, error) {
 	if err := c.ensureAuthenticated(); err != nil {
 		return nil, err
 	}
@@ -223,7 +233,7 @@ func (c *Client) Status(name string, items []imap.StatusItem) (*imap.MailboxStat
 		Mailbox: new(imap.MailboxStatus),
 	}
 
-	status, err := c.execute(cmd, res)
+	status, err := c.executeContext(ctx, cmd, res)
 	if err != nil {
 		return nil, err
 	}
@@ -235,8 +245,18 @@ func (c *Client) Status(name string, items []imap.StatusItem) (*imap.MailboxStat
 // RFC 2822 message. flags and date are optional arguments and can be set to
 // nil and the empty struct.
 func (c *Client) Append(mbox string, flags []string, date time.Time, msg imap.Literal) error {
+	return c.AppendContext(context.Background(), mbox, flags, date, msg)
+}
+
+// AppendContext is like Append, but the command is aborted when ctx is done.
+func (c *Client) AppendContext(ctx context.Context, mbox string, flags []string, date time.Time, msg imap.Literal) error {
+	_, err := c.append(ctx, mbox, flags, date, msg)
+	return err
+}
+
+func (c *Client) append(ctx context.Context, mbox string, flags []string, date time.Time, msg imap.Literal) (*imap.StatusResp, error) {
 	if err := c.ensureAuthenticated(); err != nil {
-		return err
+		return nil, err
 	}
 
 	cmd := &commands.Append{
@@ -246,11 +266,11 @@ func (c *Client) Append(mbox string, flags []string, date time.Time, msg imap.Li
 		Message: msg,
 	}
 
-	status, err := c.execute(cmd, nil)
+	status, err := c.executeContext(ctx, cmd, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return status.Err()
+	return status, status.Err()
 }
 
 // Enable requests the server to enable the named extensions. The extensions
@@ -352,6 +372,17 @@ func (c *Client) Idle(stop <-chan struct{}, opts *IdleOptions) error {
 	}
 }
 
+// IdleContext is like Idle, but idling stops when ctx is done instead of when a
+// stop channel is closed. The IDLE command is terminated normally, so the
+// connection is still usable afterwards. If idling stopped because ctx is done,
+// ctx.Err() is returned.
+func (c *Client) IdleContext(ctx context.Context, opts *IdleOptions) error {
+	if err := c.Idle(ctx.Done(), opts); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
 func (c *Client) idleFallback(stop <-chan struct{}, opts *IdleOptions) error {
 	pollInterval := time.Minute
 	if opts != nil {
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"errors"
 
 	"github.com/zhangdapeng520/zdpgo_imap/imap"
@@ -69,6 +70,30 @@ func (c *Client) Terminate() error {
 // the currently selected mailbox. If ch is not nil, sends sequence IDs of each
 // deleted message to this channel.
 func (c *Client) Expunge(ch chan uint32) error {
+	return c.expunge(nil, ch)
+}
+
+// UidExpunge permanently removes the messages that have the \Deleted flag set
+// and whose UID is in seqset. Other messages marked as deleted are kept. If ch
+// is not nil, sends sequence IDs of each deleted message to this channel.
+//
+// The server must support the UIDPLUS extension defined in RFC 4315, otherwise
+// ErrExtensionUnsupported is returned.
+func (c *Client) UidExpunge(seqset *imap.SeqSet, ch chan uint32) error {
+	if ok, err := c.Support("UIDPLUS"); err != nil || !ok {
+		if ch != nil {
+			close(ch)
+		}
+		if err == nil {
+			err = ErrExtensionUnsupported
+		}
+		return err
+	}
+
+	return c.expunge(seqset, ch)
+}
+
+func (c *Client) expunge(seqset *imap.SeqSet, ch chan uint32) error {
 	if ch != nil {
 		defer close(ch)
 	}
@@ -77,7 +102,10 @@ func (c *Client) Expunge(ch chan uint32) error {
 		return ErrNoMailboxSelected
 	}
 
-	cmd := new(commands.Expunge)
+	var cmd imap.Commander = new(commands.Expunge)
+	if seqset != nil {
+		cmd = &commands.Uid{Cmd: &commands.Expunge{SeqSet: seqset}}
+	}
 
 	var h responses.Handler
 	if ch != nil {
@@ -91,7 +119,7 @@ func (c *Client) Expunge(ch chan uint32) error {
 	return status.Err()
 }
 
-func (c *Client) executeSearch(uid bool, criteria *imap.SearchCriteria, charset string) (ids []uint32, status *imap.StatusResp, err error) {
+func (c *Client) executeSearch(ctx context.Context, uid bool, criteria *imap.SearchCriteria, charset string) (ids []uint32, status *imap.StatusResp, err error) {
 	if c.State() != imap.SelectedState {
 		err = ErrNoMailboxSelected
 		return
@@ -107,7 +135,7 @@ func (c *Client) executeSearch(uid bool, criteria *imap.SearchCriteria, charset
 
 	res := new(responses.Search)
 
-	status, err = c.execute(cmd, res)
+	status, err = c.executeContext(ctx, cmd, res)
 	if err != nil {
 		return
 	}
@@ -116,11 +144,11 @@ func (c *Client) executeSearch(uid bool, criteria *imap.SearchCriteria, charset
 	return
 }
 
-func (c *Client) search(uid bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
-	ids, status, err := c.executeSearch(uid, criteria, "UTF-8")
+func (c *Client) search(ctx context.Context, uid bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
+	ids, status, err := c.executeSearch(ctx, uid, criteria, "UTF-8")
 	if status != nil && status.Code == imap.CodeBadCharset {
 		// Some servers don't support UTF-8
-		ids, _, err = c.executeSearch(uid, criteria, "US-ASCII")
+		ids, _, err = c.executeSearch(ctx, uid, criteria, "US-ASCII")
 	}
 	return
 }
@@ -134,33 +162,180 @@ func (c *Client) search(uid bool, criteria *imap.SearchCriteria) (ids []uint32,
 // searching criteria. When no criteria has been set, all messages in the mailbox
 // will be searched using ALL criteria.
 func (c *Client) Search(criteria *imap.SearchCriteria) (seqNums []uint32, err error) {
-	return c.search(false, criteria)
+	return c.search(context.Background(), false, criteria)
+}
+
+// SearchContext is like Search, but the command is aborted when ctx is done.
+func (c *Client) SearchContext(ctx context.Context, criteria *imap.SearchCriteria) (seqNums []uint32, err error) {
+	return c.search(ctx, false, criteria)
 }
 
 // UidSearch is identical to Search, but UIDs are returned instead of message
 // sequence numbers.
 func (c *Client) UidSearch(criteria *imap.SearchCriteria) (uids []uint32, err error) {
-	return c.search(true, criteria)
+	return c.search(context.Background(), true, criteria)
+}
+
+// UidSearchContext is like UidSearch, but the command is aborted when ctx is
+// done.
+func (c *Client) UidSearchContext(ctx context.Context, criteria *imap.SearchCriteria) (uids []uint32, err error) {
+	return c.search(ctx, true, criteria)
+}
+
+// SearchCharset is like SearchContext, but criteria is sent with the provided
+// charset. Unlike Search, the command isn't retried with US-ASCII if the server
+// doesn't support the charset: an *imap.ErrStatusResp with the
+// imap.CodeBadCharset code is returned instead. An empty charset omits the
+// CHARSET argument.
+func (c *Client) SearchCharset(ctx context.Context, charset string, criteria *imap.SearchCriteria) (seqNums []uint32, err error) {
+	seqNums, _, err = c.executeSearch(ctx, false, criteria, charset)
+	return
+}
+
+// UidSearchCharset is identical to SearchCharset, but UIDs are returned instead
+// of message sequence numbers.
+func (c *Client) UidSearchCharset(ctx context.Context, charset string, criteria *imap.SearchCriteria) (uids []uint32, err error) {
+	uids, _, err = c.executeSearch(ctx, true, criteria, charset)
+	return
 }
 
-func (c *Client) fetch(uid bool, seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+func (c *Client) executeSort(ctx context.Context, uid bool, sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria, charset string) (ids []uint32, status *imap.StatusResp, err error) {
+	if c.State() != imap.SelectedState {
+		err = ErrNoMailboxSelected
+		return
+	}
+
+	var cmd imap.Commander = &commands.Sort{
+		SortCriteria: sortCriteria,
+		Charset:      charset,
+		Criteria:     criteria,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(responses.Sort)
+
+	status, err = c.executeContext(ctx, cmd, res)
+	if err != nil {
+		return
+	}
+
+	err, ids = status.Err(), res.Ids
+	return
+}
+
+func (c *Client) sort(ctx context.Context, uid bool, sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria) (ids []uint32, err error) {
+	ids, status, err := c.executeSort(ctx, uid, sortCriteria, criteria, "UTF-8")
+	if status != nil && status.Code == imap.CodeBadCharset {
+		// Some servers don't support UTF-8
+		ids, _, err = c.executeSort(ctx, uid, sortCriteria, criteria, "US-ASCII")
+	}
+	return
+}
+
+// Sort searches the mailbox for messages that match the given searching
+// criteria and returns their message sequence numbers, ordered by the given
+// sort criteria. Messages which compare equal are ordered by sequence number.
+// The server must advertise the SORT capability. See RFC 5256 section 3.
+func (c *Client) Sort(sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria) (seqNums []uint32, err error) {
+	return c.sort(context.Background(), false, sortCriteria, criteria)
+}
+
+// SortContext is like Sort, but the command is aborted when ctx is done.
+func (c *Client) SortContext(ctx context.Context, sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria) (seqNums []uint32, err error) {
+	return c.sort(ctx, false, sortCriteria, criteria)
+}
+
+// UidSort is identical to Sort, but UIDs are returned instead of message
+// sequence numbers.
+func (c *Client) UidSort(sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria) (uids []uint32, err error) {
+	return c.sort(context.Background(), true, sortCriteria, criteria)
+}
+
+// UidSortContext is like UidSort, but the command is aborted when ctx is done.
+func (c *Client) UidSortContext(ctx context.Context, sortCriteria []imap.SortCriterion, criteria *imap.SearchCriteria) (uids []uint32, err error) {
+	return c.sort(ctx, true, sortCriteria, criteria)
+}
+
+func (c *Client) executeThread(ctx context.Context, uid bool, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria, charset string) (threads []*imap.Thread, status *imap.StatusResp, err error) {
+	if c.State() != imap.SelectedState {
+		err = ErrNoMailboxSelected
+		return
+	}
+
+	var cmd imap.Commander = &commands.Thread{
+		Algorithm: algorithm,
+		Charset:   charset,
+		Criteria:  criteria,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(responses.Thread)
+
+	status, err = c.executeContext(ctx, cmd, res)
+	if err != nil {
+		return
+	}
+
+	err, threads = status.Err(), res.Threads
+	return
+}
+
+func (c *Client) thread(ctx context.Context, uid bool, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) (threads []*imap.Thread, err error) {
+	threads, status, err := c.executeThread(ctx, uid, algorithm, criteria, "UTF-8")
+	if status != nil && status.Code == imap.CodeBadCharset {
+		// Some servers don't support UTF-8
+		threads, _, err = c.executeThread(ctx, uid, algorithm, criteria, "US-ASCII")
+	}
+	return
+}
+
+// Thread searches the mailbox for messages that match the given searching
+// criteria and groups them into threads using the given algorithm. The server
+// must advertise the THREAD=<algorithm> capability. See RFC 5256 section 3.
+func (c *Client) Thread(algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*imap.Thread, error) {
+	return c.thread(context.Background(), false, algorithm, criteria)
+}
+
+// ThreadContext is like Thread, but the command is aborted when ctx is done.
+func (c *Client) ThreadContext(ctx context.Context, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*imap.Thread, error) {
+	return c.thread(ctx, false, algorithm, criteria)
+}
+
+// UidThread is identical to Thread, but UIDs are returned instead of message
+// sequence numbers.
+func (c *Client) UidThread(algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*imap.Thread, error) {
+	return c.thread(context.Background(), true, algorithm, criteria)
+}
+
+// UidThreadContext is like UidThread, but the command is aborted when ctx is
+// done.
+func (c *Client) UidThreadContext(ctx context.Context, algorithm imap.ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*imap.Thread, error) {
+	return c.thread(ctx, true, algorithm, criteria)
+}
+
+func (c *Client) fetch(ctx context.Context, uid bool, seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.fetchCommand(ctx, uid, &commands.Fetch{SeqSet: seqset, Items: items}, ch)
+}
+
+func (c *Client) fetchCommand(ctx context.Context, uid bool, fetch *commands.Fetch, ch chan *imap.Message) error {
 	defer close(ch)
 
 	if c.State() != imap.SelectedState {
 		return ErrNoMailboxSelected
 	}
 
-	var cmd imap.Commander = &commands.Fetch{
-		SeqSet: seqset,
-		Items:  items,
-	}
+	var cmd imap.Commander = fetch
 	if uid {
 		cmd = &commands.Uid{Cmd: cmd}
 	}
 
-	res := &responses.Fetch{Messages: ch, SeqSet: seqset, Uid: uid}
+	res := &responses.Fetch{Messages: ch, SeqSet: fetch.SeqSet, Uid: uid}
 
-	status, err := c.execute(cmd, res)
+	status, err := c.executeContext(ctx, cmd, res)
 	if err != nil {
 		return err
 	}
@@ -170,26 +345,45 @@ func (c *Client) fetch(uid bool, seqset *imap.SeqSet, items []imap.FetchItem, ch
 // Fetch retrieves data associated with a message in the mailbox. See RFC 3501
 // section 6.4.5 for a list of items that can be requested.
 func (c *Client) Fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
-	return c.fetch(false, seqset, items, ch)
+	return c.fetch(context.Background(), false, seqset, items, ch)
+}
+
+// FetchContext is like Fetch, but the command is aborted when ctx is done.
+func (c *Client) FetchContext(ctx context.Context, seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.fetch(ctx, false, seqset, items, ch)
 }
 
 // UidFetch is identical to Fetch, but seqset is interpreted as containing
 // unique identifiers instead of message sequence numbers.
 func (c *Client) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
-	return c.fetch(true, seqset, items, ch)
+	return c.fetch(context.Background(), true, seqset, items, ch)
+}
+
+// UidFetchContext is like UidFetch, but the command is aborted when ctx is
+// done.
+func (c *Client) UidFetchContext(ctx context.Context, seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.fetch(ctx, true, seqset, items, ch)
+}
+
+func (c *Client) store(ctx context.Context, uid bool, seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
+	status, err := c.storeCommand(ctx, uid, &commands.Store{SeqSet: seqset, Item: item, Value: value}, ch)
+	if err != nil {
+		return err
+	}
+	return status.Err()
 }
 
-func (c *Client) store(uid bool, seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
+func (c *Client) storeCommand(ctx context.Context, uid bool, store *commands.Store, ch chan *imap.Message) (*imap.StatusResp, error) {
 	if ch != nil {
 		defer close(ch)
 	}
 
 	if c.State() != imap.SelectedState {
-		return ErrNoMailboxSelected
+		return nil, ErrNoMailboxSelected
 	}
 
 	// TODO: this could break extensions (this only works when item is FLAGS)
-	if fields, ok := value.([]interface{}); ok {
+	if fields, ok := store.Value.([]interface{}); ok {
 		for i, field := range fields {
 			if s, ok := field.(string); ok {
 				fields[i] = imap.RawString(s)
@@ -200,49 +394,52 @@ func (c *Client) store(uid bool, seqset *imap.SeqSet, item imap.StoreItem, value
 	// If ch is nil, the updated values are data which will be lost, so don't
 	// retrieve it.
 	if ch == nil {
-		op, _, err := imap.ParseFlagsOp(item)
+		op, _, err := imap.ParseFlagsOp(store.Item)
 		if err == nil {
-			item = imap.FormatFlagsOp(op, true)
+			store.Item = imap.FormatFlagsOp(op, true)
 		}
 	}
 
-	var cmd imap.Commander = &commands.Store{
-		SeqSet: seqset,
-		Item:   item,
-		Value:  value,
-	}
+	var cmd imap.Commander = store
 	if uid {
 		cmd = &commands.Uid{Cmd: cmd}
 	}
 
 	var h responses.Handler
 	if ch != nil {
-		h = &responses.Fetch{Messages: ch, SeqSet: seqset, Uid: uid}
+		h = &responses.Fetch{Messages: ch, SeqSet: store.SeqSet, Uid: uid}
 	}
 
-	status, err := c.execute(cmd, h)
-	if err != nil {
-		return err
-	}
-	return status.Err()
+	return c.executeContext(ctx, cmd, h)
 }
 
 // Store alters data associated with a message in the mailbox. If ch is not nil,
 // the updated value of the data will be sent to this channel. See RFC 3501
 // section 6.4.6 for a list of items that can be updated.
 func (c *Client) Store(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
-	return c.store(false, seqset, item, value, ch)
+	return c.store(context.Background(), false, seqset, item, value, ch)
+}
+
+// StoreContext is like Store, but the command is aborted when ctx is done.
+func (c *Client) StoreContext(ctx context.Context, seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
+	return c.store(ctx, false, seqset, item, value, ch)
 }
 
 // UidStore is identical to Store, but seqset is interpreted as containing
 // unique identifiers instead of message sequence numbers.
 func (c *Client) UidStore(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
-	return c.store(true, seqset, item, value, ch)
+	return c.store(context.Background(), true, seqset, item, value, ch)
+}
+
+// UidStoreContext is like UidStore, but the command is aborted when ctx is
+// done.
+func (c *Client) UidStoreContext(ctx context.Context, seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
+	return c.store(ctx, true, seqset, item, value, ch)
 }
 
-func (c *Client) copy(uid bool, seqset *imap.SeqSet, dest string) error {
+func (c *Client) copy(ctx context.Context, uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyData, error) {
 	if c.State() != imap.SelectedState {
-		return ErrNoMailboxSelected
+		return nil, ErrNoMailboxSelected
 	}
 
 	var cmd imap.Commander = &commands.Copy{
@@ -253,34 +450,38 @@ func (c *Client) copy(uid bool, seqset *imap.SeqSet, dest string) error {
 		cmd = &commands.Uid{Cmd: cmd}
 	}
 
-	status, err := c.execute(cmd, nil)
+	status, err := c.executeContext(ctx, cmd, nil)
 	if err != nil {
-		return err
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
 	}
-	return status.Err()
+	return parseCopyData(status)
 }
 
 // Copy copies the specified message(s) to the end of the specified destination
 // mailbox.
 func (c *Client) Copy(seqset *imap.SeqSet, dest string) error {
-	return c.copy(false, seqset, dest)
+	_, err := c.copy(context.Background(), false, seqset, dest)
+	return err
 }
 
 // UidCopy is identical to Copy, but seqset is interpreted as containing unique
 // identifiers instead of message sequence numbers.
 func (c *Client) UidCopy(seqset *imap.SeqSet, dest string) error {
-	return c.copy(true, seqset, dest)
+	_, err := c.copy(context.Background(), true, seqset, dest)
+	return err
 }
 
-func (c *Client) move(uid bool, seqset *imap.SeqSet, dest string) error {
+func (c *Client) move(ctx context.Context, uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyData, error) {
 	if c.State() != imap.SelectedState {
-		return ErrNoMailboxSelected
+		return nil, ErrNoMailboxSelected
 	}
 
 	if ok, err := c.Support("MOVE"); err != nil {
-		return err
+		return nil, err
 	} else if !ok {
-		return c.moveFallback(uid, seqset, dest)
+		return c.moveFallback(ctx, uid, seqset, dest)
 	}
 
 	var cmd imap.Commander = &commands.Move{
@@ -291,37 +492,60 @@ func (c *Client) move(uid bool, seqset *imap.SeqSet, dest string) error {
 		cmd = &commands.Uid{Cmd: cmd}
 	}
 
-	if status, err := c.Execute(cmd, nil); err != nil {
-		return err
-	} else {
-		return status.Err()
+	// The COPYUID response code is sent in an untagged OK response, before
+	// the EXPUNGE responses (RFC 6851 section 4.3)
+	var data *imap.CopyData
+	var dataErr error
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		status, ok := resp.(*imap.StatusResp)
+		if !ok || status.Tag != "*" || status.Code != imap.CodeCopyUid {
+			return responses.ErrUnhandled
+		}
+		data, dataErr = parseCopyData(status)
+		return nil
+	})
+
+	status, err := c.executeContext(ctx, cmd, h)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
 	}
+	if data == nil && dataErr == nil {
+		// Some servers send it in the tagged response
+		return parseCopyData(status)
+	}
+	return data, dataErr
 }
 
 // moveFallback uses COPY, STORE and EXPUNGE for servers which don't support
 // MOVE.
-func (c *Client) moveFallback(uid bool, seqset *imap.SeqSet, dest string) error {
+func (c *Client) moveFallback(ctx context.Context, uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyData, error) {
 	item := imap.FormatFlagsOp(imap.AddFlags, true)
 	flags := []interface{}{imap.DeletedFlag}
+	data, err := c.copy(ctx, uid, seqset, dest)
+	if err != nil {
+		return nil, err
+	}
+
 	if uid {
-		if err := c.UidCopy(seqset, dest); err != nil {
-			return err
+		if err := c.UidStoreContext(ctx, seqset, item, flags, nil); err != nil {
+			return nil, err
 		}
 
-		if err := c.UidStore(seqset, item, flags, nil); err != nil {
-			return err
+		// Only expunge the moved messages if the server supports it
+		if ok, err := c.Support("UIDPLUS"); err != nil {
+			return nil, err
+		} else if ok {
+			return data, c.UidExpunge(seqset, nil)
 		}
 	} else {
-		if err := c.Copy(seqset, dest); err != nil {
-			return err
-		}
-
-		if err := c.Store(seqset, item, flags, nil); err != nil {
-			return err
+		if err := c.StoreContext(ctx, seqset, item, flags, nil); err != nil {
+			return nil, err
 		}
 	}
 
-	return c.Expunge(nil)
+	return data, c.Expunge(nil)
 }
 
 // Move moves the specified message(s) to the end of the specified destination
@@ -330,13 +554,15 @@ func (c *Client) moveFallback(uid bool, seqset *imap.SeqSet, dest string) error
 // If the server doesn't support the MOVE extension defined in RFC 6851,
 // go-imap will fallback to copy, store and expunge.
 func (c *Client) Move(seqset *imap.SeqSet, dest string) error {
-	return c.move(false, seqset, dest)
+	_, err := c.move(context.Background(), false, seqset, dest)
+	return err
 }
 
 // UidMove is identical to Move, but seqset is interpreted as containing unique
 // identifiers instead of message sequence numbers.
 func (c *Client) UidMove(seqset *imap.SeqSet, dest string) error {
-	return c.move(true, seqset, dest)
+	_, err := c.move(context.Background(), true, seqset, dest)
+	return err
 }
 
 // Unselect frees server's resources associated with the selected mailbox and
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/commands"
+)
+
+// This file implements the COMPRESS extension, defined in RFC 4978.
+
+// ErrCompressionActive is returned if Compress is called when compression is
+// already enabled.
+var ErrCompressionActive = errors.New("Compression is already enabled")
+
+// SupportCompress checks if the server supports a compression mechanism, e.g.
+// imap.CompressDeflate.
+func (c *Client) SupportCompress(mech string) (bool, error) {
+	return c.Support("COMPRESS=" + mech)
+}
+
+// Compress enables compression of the connection in both directions. Only
+// imap.CompressDeflate is supported. It should be called after authentication,
+// and after StartTLS if TLS is used.
+func (c *Client) Compress(mech string) error {
+	if c.isCompressed {
+		return ErrCompressionActive
+	}
+	if mech != imap.CompressDeflate {
+		return errors.New("Unsupported compression mechanism: " + mech)
+	}
+	if err := c.ensureSupport("COMPRESS=" + mech); err != nil {
+		return err
+	}
+
+	cmd := &commands.Compress{Mechanism: mech}
+
+	err := c.Upgrade(func(conn net.Conn) (net.Conn, error) {
+		// Flag connection as in upgrading
+		c.upgrading = true
+		if status, err := c.execute(cmd, nil); err != nil {
+			return nil, err
+		} else if err := status.Err(); err != nil {
+			return nil, err
+		}
+
+		// Wait for reader to block.
+		c.conn.WaitReady()
+		return imap.NewDeflateConn(conn)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.isCompressed = true
+	return nil
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/commands"
+)
+
+// This file implements the CONDSTORE and QRESYNC extensions, defined in
+// RFC 7162.
+
+func (c *Client) ensureSupport(caps ...string) error {
+	for _, cap := range caps {
+		if ok, err := c.Support(cap); err != nil {
+			return err
+		} else if !ok {
+			return ErrExtensionUnsupported
+		}
+	}
+	return nil
+}
+
+// SelectCondStore is like SelectContext, but also enables CONDSTORE. The
+// returned mailbox status contains the mailbox's highest mod-sequence, which
+// is zero if the mailbox doesn't support persistent mod-sequences.
+func (c *Client) SelectCondStore(ctx context.Context, name string, readOnly bool) (*imap.MailboxStatus, error) {
+	if err := c.ensureSupport("CONDSTORE"); err != nil {
+		return nil, err
+	}
+
+	return c.selectCommand(ctx, &commands.Select{Mailbox: name, ReadOnly: readOnly, CondStore: true})
+}
+
+// EnableQResync enables the QRESYNC extension, which also enables CONDSTORE.
+// It must be called before selecting a mailbox. Once QRESYNC is enabled, the
+// server reports expunged messages as VanishedUpdate instead of ExpungeUpdate.
+func (c *Client) EnableQResync() error {
+	if err := c.ensureSupport("QRESYNC"); err != nil {
+		return err
+	}
+
+	caps, err := c.Enable([]string{"QRESYNC"})
+	if err != nil {
+		return err
+	}
+	for _, cap := range caps {
+		if strings.EqualFold(cap, "QRESYNC") {
+			return nil
+		}
+	}
+	return ErrExtensionUnsupported
+}
+
+// SelectQResync selects a mailbox and resynchronizes it using the state saved
+// in params, as defined in RFC 7162 section 3.2.5. EnableQResync must have
+// been called before.
+//
+// If the mailbox UIDVALIDITY is still params.UidValidity, the messages
+// expunged since params.ModSeq are delivered to c.Updates as a VanishedUpdate
+// with Earlier set, and the messages whose flags changed are delivered as
+// MessageUpdate. Otherwise, the client must perform a full resynchronization.
+func (c *Client) SelectQResync(ctx context.Context, name string, readOnly bool, params *imap.QResyncParams) (*imap.MailboxStatus, error) {
+	return c.selectCommand(ctx, &commands.Select{Mailbox: name, ReadOnly: readOnly, QResync: params})
+}
+
+// FetchChangedSince is like FetchContext, but only returns messages whose
+// mod-sequence is greater than changedSince. The MODSEQ item is always
+// returned.
+func (c *Client) FetchChangedSince(ctx context.Context, seqset *imap.SeqSet, items []imap.FetchItem, changedSince uint64, ch chan *imap.Message) error {
+	if err := c.ensureSupport("CONDSTORE"); err != nil {
+		close(ch)
+		return err
+	}
+
+	cmd := &commands.Fetch{SeqSet: seqset, Items: items, ChangedSince: changedSince}
+	return c.fetchCommand(ctx, false, cmd, ch)
+}
+
+// UidFetchChangedSince is like FetchChangedSince, but seqset is interpreted as
+// containing unique identifiers instead of message sequence numbers.
+//
+// If vanished is true, the UIDs in seqset which have been expunged since
+// changedSince are delivered to c.Updates as a VanishedUpdate with Earlier
+// set. This requires QRESYNC to be enabled.
+func (c *Client) UidFetchChangedSince(ctx context.Context, seqset *imap.SeqSet, items []imap.FetchItem, changedSince uint64, vanished bool, ch chan *imap.Message) error {
+	caps := []string{"CONDSTORE"}
+	if vanished {
+		caps = append(caps, "QRESYNC")
+	}
+	if err := c.ensureSupport(caps...); err != nil {
+		close(ch)
+		return err
+	}
+
+	cmd := &commands.Fetch{SeqSet: seqset, Items: items, ChangedSince: changedSince, Vanished: vanished}
+	return c.fetchCommand(ctx, true, cmd, ch)
+}
+
+func (c *Client) storeUnchangedSince(ctx context.Context, uid bool, seqset *imap.SeqSet, unchangedSince uint64, item imap.StoreItem, value interface{}, ch chan *imap.Message) (*imap.SeqSet, error) {
+	if err := c.ensureSupport("CONDSTORE"); err != nil {
+		if ch != nil {
+			close(ch)
+		}
+		return nil, err
+	}
+
+	cmd := &commands.Store{
+		SeqSet:            seqset,
+		Item:              item,
+		Value:             value,
+		UnchangedSince:    unchangedSince,
+		HasUnchangedSince: true,
+	}
+	status, err := c.storeCommand(ctx, uid, cmd, ch)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	if status.Code != imap.CodeModified || len(status.Arguments) == 0 {
+		return nil, nil
+	}
+	s, err := imap.ParseString(status.Arguments[0])
+	if err != nil {
+		return nil, err
+	}
+	return imap.ParseSeqSet(s)
+}
+
+// StoreUnchangedSince is like StoreContext, but only alters messages whose
+// mod-sequence is lower than or equal to unchangedSince. The messages that
+// were modified in the meantime are left untouched and returned.
+func (c *Client) StoreUnchangedSince(ctx context.Context, seqset *imap.SeqSet, unchangedSince uint64, item imap.StoreItem, value interface{}, ch chan *imap.Message) (modified *imap.SeqSet, err error) {
+	return c.storeUnchangedSince(ctx, false, seqset, unchangedSince, item, value, ch)
+}
+
+// UidStoreUnchangedSince is like StoreUnchangedSince, but seqset is
+// interpreted as containing unique identifiers instead of message sequence
+// numbers. The returned set contains UIDs.
+func (c *Client) UidStoreUnchangedSince(ctx context.Context, seqset *imap.SeqSet, unchangedSince uint64, item imap.StoreItem, value interface{}, ch chan *imap.Message) (modified *imap.SeqSet, err error) {
+	return c.storeUnchangedSince(ctx, true, seqset, unchangedSince, item, value, ch)
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/commands"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/responses"
+)
+
+// This file implements the ESEARCH extension, defined in RFC 4731, and the
+// SEARCHRES extension, defined in RFC 5182. A search result saved with
+// imap.SearchReturnSave is referred to with imap.SearchRes, for instance
+// c.UidFetch(imap.SearchRes(), items, ch).
+
+func (c *Client) executeESearch(ctx context.Context, uid bool, criteria *imap.SearchCriteria, options []imap.SearchReturnOption, charset string) (data *imap.SearchData, status *imap.StatusResp, err error) {
+	if c.State() != imap.SelectedState {
+		err = ErrNoMailboxSelected
+		return
+	}
+
+	var cmd imap.Commander = &commands.Search{
+		Charset:  charset,
+		Criteria: criteria,
+		Return:   options,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(responses.ESearch)
+
+	status, err = c.executeContext(ctx, cmd, res)
+	if err != nil {
+		return
+	}
+	if err = status.Err(); err != nil {
+		return
+	}
+
+	// No ESEARCH response is sent if SAVE is the only option
+	data = res.Data
+	if data == nil {
+		data = &imap.SearchData{Uid: uid}
+	}
+	return
+}
+
+func (c *Client) esearch(ctx context.Context, uid bool, criteria *imap.SearchCriteria, options []imap.SearchReturnOption) (*imap.SearchData, error) {
+	caps := []string{"ESEARCH"}
+	if imap.HasSearchReturnOption(options, imap.SearchReturnSave) {
+		caps = append(caps, "SEARCHRES")
+	}
+	if err := c.ensureSupport(caps...); err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		options = []imap.SearchReturnOption{imap.SearchReturnAll}
+	}
+
+	data, status, err := c.executeESearch(ctx, uid, criteria, options, "UTF-8")
+	if status != nil && status.Code == imap.CodeBadCharset {
+		// Some servers don't support UTF-8
+		data, _, err = c.executeESearch(ctx, uid, criteria, options, "US-ASCII")
+	}
+	return data, err
+}
+
+// ESearch is like Search, but only returns the data requested by options. An
+// empty list of options is equivalent to imap.SearchReturnAll. The matching
+// messages are returned as a sequence set, which is much more compact than the
+// list returned by Search for large mailboxes.
+//
+// If options contain imap.SearchReturnSave, the result is saved by the server
+// and can be referred to with imap.SearchRes in subsequent commands.
+func (c *Client) ESearch(criteria *imap.SearchCriteria, options []imap.SearchReturnOption) (*imap.SearchData, error) {
+	return c.esearch(context.Background(), false, criteria, options)
+}
+
+// ESearchContext is like ESearch, but the command is aborted when ctx is done.
+func (c *Client) ESearchContext(ctx context.Context, criteria *imap.SearchCriteria, options []imap.SearchReturnOption) (*imap.SearchData, error) {
+	return c.esearch(ctx, false, criteria, options)
+}
+
+// UidESearch is identical to ESearch, but UIDs are returned instead of
+// message sequence numbers.
+func (c *Client) UidESearch(criteria *imap.SearchCriteria, options []imap.SearchReturnOption) (*imap.SearchData, error) {
+	return c.esearch(context.Background(), true, criteria, options)
+}
+
+// UidESearchContext is like UidESearch, but the command is aborted when ctx is
+// done.
+func (c *Client) UidESearchContext(ctx context.Context, criteria *imap.SearchCriteria, options []imap.SearchReturnOption) (*imap.SearchData, error) {
+	return c.esearch(ctx, true, criteria, options)
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// This file implements the result codes of the UIDPLUS extension, defined in
+// RFC 4315. UID EXPUNGE is implemented by UidExpunge.
+//
+// The returned data is nil if the server doesn't support UIDPLUS, or if the
+// destination mailbox doesn't support persistent UIDs (UIDNOTSTICKY). It is
+// also nil if no message matched the sequence set.
+
+func parseCopyData(status *imap.StatusResp) (*imap.CopyData, error) {
+	if status.Code != imap.CodeCopyUid {
+		return nil, nil
+	}
+
+	data := new(imap.CopyData)
+	if err := data.Parse(status.Arguments); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// AppendUid is like AppendContext, but also returns the UID assigned to the
+// new message.
+func (c *Client) AppendUid(ctx context.Context, mbox string, flags []string, date time.Time, msg imap.Literal) (*imap.AppendData, error) {
+	status, err := c.append(ctx, mbox, flags, date, msg)
+	if err != nil {
+		return nil, err
+	}
+	if status.Code != imap.CodeAppendUid {
+		return nil, nil
+	}
+
+	data := new(imap.AppendData)
+	if err := data.Parse(status.Arguments); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CopyUid is like Copy, but also returns the UIDs assigned to the copies.
+func (c *Client) CopyUid(ctx context.Context, seqset *imap.SeqSet, dest string) (*imap.CopyData, error) {
+	return c.copy(ctx, false, seqset, dest)
+}
+
+// UidCopyUid is like UidCopy, but also returns the UIDs assigned to the
+// copies.
+func (c *Client) UidCopyUid(ctx context.Context, seqset *imap.SeqSet, dest string) (*imap.CopyData, error) {
+	return c.copy(ctx, true, seqset, dest)
+}
+
+// MoveUid is like Move, but also returns the UIDs assigned to the moved
+// messages in the destination mailbox.
+func (c *Client) MoveUid(ctx context.Context, seqset *imap.SeqSet, dest string) (*imap.CopyData, error) {
+	return c.move(ctx, false, seqset, dest)
+}
+
+// UidMoveUid is like UidMove, but also returns the UIDs assigned to the moved
+// messages in the destination mailbox.
+func (c *Client) UidMoveUid(ctx context.Context, seqset *imap.SeqSet, dest string) (*imap.CopyData, error) {
+	return c.move(ctx, true, seqset, dest)
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// Compress is a COMPRESS command, as defined in RFC 4978 section 3.
+type Compress struct {
+	Mechanism string
+}
+
+func (cmd *Compress) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "COMPRESS",
+		Arguments: []interface{}{imap.RawString(cmd.Mechanism)},
+	}
+}
+
+func (cmd *Compress) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("Not enough arguments")
+	}
+
+	mech, ok := fields[0].(string)
+	if !ok {
+		return errors.New("Compression mechanism name must be a string")
+	}
+	cmd.Mechanism = strings.ToUpper(mech)
+	return nil
+}
@@ -1,16 +1,38 @@
 package commands
 
 import (
+	"errors"
+
 	"github.com/zhangdapeng520/zdpgo_imap/imap"
 )
 
 // Expunge is an EXPUNGE command, as defined in RFC 3501 section 6.4.3.
-type Expunge struct{}
+//
+// When wrapped in a Uid command, SeqSet limits the expunged messages to the
+// given UIDs (UID EXPUNGE, see RFC 4315 section 2.1). It must be nil otherwise.
+type Expunge struct {
+	SeqSet *imap.SeqSet
+}
 
 func (cmd *Expunge) Command() *imap.Command {
-	return &imap.Command{Name: "EXPUNGE"}
+	var args []interface{}
+	if cmd.SeqSet != nil {
+		args = append(args, cmd.SeqSet)
+	}
+
+	return &imap.Command{Name: "EXPUNGE", Arguments: args}
 }
 
 func (cmd *Expunge) Parse(fields []interface{}) error {
-	return nil
+	if len(fields) == 0 {
+		return nil
+	}
+
+	seqSet, ok := fields[0].(string)
+	if !ok {
+		return errors.New("Invalid sequence set")
+	}
+	var err error
+	cmd.SeqSet, err = imap.ParseSeqSet(seqSet)
+	return err
 }
@@ -8,28 +8,42 @@ import (
 )
 
 // Fetch is a FETCH command, as defined in RFC 3501 section 6.4.5.
+//
+// ChangedSince and Vanished are the CHANGEDSINCE and VANISHED modifiers
+// defined in RFC 7162. Vanished can only be used with UID FETCH.
 type Fetch struct {
 	SeqSet *imap.SeqSet
 	Items  []imap.FetchItem
+
+	ChangedSince uint64
+	Vanished     bool
 }
 
 func (cmd *Fetch) Command() *imap.Command {
+	var args []interface{}
+
 	// Handle FETCH macros separately as they should not be serialized within parentheses
 	if len(cmd.Items) == 1 && (cmd.Items[0] == imap.FetchAll || cmd.Items[0] == imap.FetchFast || cmd.Items[0] == imap.FetchFull) {
-		return &imap.Command{
-			Name:      "FETCH",
-			Arguments: []interface{}{cmd.SeqSet, imap.RawString(cmd.Items[0])},
-		}
+		args = []interface{}{cmd.SeqSet, imap.RawString(cmd.Items[0])}
 	} else {
 		items := make([]interface{}, len(cmd.Items))
 		for i, item := range cmd.Items {
 			items[i] = imap.RawString(item)
 		}
+		args = []interface{}{cmd.SeqSet, items}
+	}
 
-		return &imap.Command{
-			Name:      "FETCH",
-			Arguments: []interface{}{cmd.SeqSet, items},
+	if cmd.ChangedSince > 0 {
+		modifiers := []interface{}{imap.RawString("CHANGEDSINCE"), cmd.ChangedSince}
+		if cmd.Vanished {
+			modifiers = append(modifiers, imap.RawString("VANISHED"))
 		}
+		args = append(args, modifiers)
+	}
+
+	return &imap.Command{
+		Name:      "FETCH",
+		Arguments: args,
 	}
 }
 
@@ -59,5 +73,35 @@ func (cmd *Fetch) Parse(fields []interface{}) error {
 		return errors.New("Items must be either a string or a list")
 	}
 
+	if len(fields) < 3 {
+		return nil
+	}
+	modifiers, ok := fields[2].([]interface{})
+	if !ok {
+		return errors.New("FETCH modifiers must be a list")
+	}
+	for len(modifiers) > 0 {
+		name, _ := modifiers[0].(string)
+		modifiers = modifiers[1:]
+
+		switch strings.ToUpper(name) {
+		case "CHANGEDSINCE":
+			if len(modifiers) == 0 {
+				return errors.New("Missing CHANGEDSINCE value")
+			}
+			if cmd.ChangedSince, err = imap.ParseNumber64(modifiers[0]); err != nil {
+				return err
+			}
+			modifiers = modifiers[1:]
+		case "VANISHED":
+			cmd.Vanished = true
+		default:
+			return errors.New("Unknown FETCH modifier: " + name)
+		}
+	}
+	if cmd.Vanished && cmd.ChangedSince == 0 {
+		return errors.New("VANISHED requires CHANGEDSINCE")
+	}
+
 	return nil
 }
@@ -12,10 +12,16 @@ import (
 type Search struct {
 	Charset  string
 	Criteria *imap.SearchCriteria
+	// The RETURN options, defined in RFC 4731 section 3.1. If set, the result
+	// is sent in an ESEARCH response.
+	Return []imap.SearchReturnOption
 }
 
 func (cmd *Search) Command() *imap.Command {
 	var args []interface{}
+	if len(cmd.Return) > 0 {
+		args = append(args, imap.RawString("RETURN"), imap.FormatSearchReturnOptions(cmd.Return))
+	}
 	if cmd.Charset != "" {
 		args = append(args, imap.RawString("CHARSET"), imap.RawString(cmd.Charset))
 	}
@@ -32,6 +38,25 @@ func (cmd *Search) Parse(fields []interface{}) error {
 		return errors.New("Missing search criteria")
 	}
 
+	// Parse return options
+	if f, ok := fields[0].(string); ok && strings.EqualFold(f, "RETURN") {
+		if len(fields) < 2 {
+			return errors.New("Missing RETURN options")
+		}
+		list, ok := fields[1].([]interface{})
+		if !ok {
+			return errors.New("RETURN options must be a list")
+		}
+		var err error
+		if cmd.Return, err = imap.ParseSearchReturnOptions(list); err != nil {
+			return err
+		}
+		fields = fields[2:]
+		if len(fields) == 0 {
+			return errors.New("Missing search criteria")
+		}
+	}
+
 	// Parse charset
 	if f, ok := fields[0].(string); ok && strings.EqualFold(f, "CHARSET") {
 		if len(fields) < 2 {
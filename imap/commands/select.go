@@ -2,6 +2,7 @@ package commands
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/zhangdapeng520/zdpgo_imap/imap"
 	"github.com/zhangdapeng520/zdpgo_imap/imap/utf7"
@@ -9,9 +10,15 @@ import (
 
 // Select is a SELECT command, as defined in RFC 3501 section 6.3.1. If ReadOnly
 // is set to true, the EXAMINE command will be used instead.
+//
+// CondStore and QResync are the CONDSTORE and QRESYNC parameters defined in
+// RFC 7162.
 type Select struct {
 	Mailbox  string
 	ReadOnly bool
+
+	CondStore bool
+	QResync   *imap.QResyncParams
 }
 
 func (cmd *Select) Command() *imap.Command {
@@ -22,9 +29,20 @@ func (cmd *Select) Command() *imap.Command {
 
 	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.Mailbox)
 
+	args := []interface{}{imap.FormatMailboxName(mailbox)}
+	var params []interface{}
+	if cmd.QResync != nil {
+		params = append(params, imap.RawString("QRESYNC"), cmd.QResync.Format())
+	} else if cmd.CondStore {
+		params = append(params, imap.RawString("CONDSTORE"))
+	}
+	if params != nil {
+		args = append(args, params)
+	}
+
 	return &imap.Command{
 		Name:      name,
-		Arguments: []interface{}{imap.FormatMailboxName(mailbox)},
+		Arguments: args,
 	}
 }
 
@@ -41,5 +59,38 @@ func (cmd *Select) Parse(fields []interface{}) error {
 		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
 	}
 
+	if len(fields) < 2 {
+		return nil
+	}
+	params, ok := fields[1].([]interface{})
+	if !ok {
+		return errors.New("SELECT parameters must be a list")
+	}
+	for len(params) > 0 {
+		name, _ := params[0].(string)
+		params = params[1:]
+
+		switch strings.ToUpper(name) {
+		case "CONDSTORE":
+			cmd.CondStore = true
+		case "QRESYNC":
+			if len(params) == 0 {
+				return errors.New("Missing QRESYNC parameters")
+			}
+			list, ok := params[0].([]interface{})
+			if !ok {
+				return errors.New("QRESYNC parameters must be a list")
+			}
+			params = params[1:]
+
+			cmd.QResync = new(imap.QResyncParams)
+			if err := cmd.QResync.Parse(list); err != nil {
+				return err
+			}
+		default:
+			return errors.New("Unknown SELECT parameter: " + name)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// Sort is a SORT command, as defined in RFC 5256 section 3.
+type Sort struct {
+	SortCriteria []imap.SortCriterion
+	Charset      string
+	Criteria     *imap.SearchCriteria
+}
+
+func (cmd *Sort) Command() *imap.Command {
+	args := []interface{}{imap.FormatSortCriteria(cmd.SortCriteria), imap.RawString(cmd.Charset)}
+	args = append(args, cmd.Criteria.Format()...)
+
+	return &imap.Command{
+		Name:      "SORT",
+		Arguments: args,
+	}
+}
+
+func (cmd *Sort) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("Not enough arguments")
+	}
+
+	list, ok := fields[0].([]interface{})
+	if !ok {
+		return errors.New("Sort criteria must be a list")
+	}
+	var err error
+	if cmd.SortCriteria, err = imap.ParseSortCriteria(list); err != nil {
+		return err
+	}
+
+	if cmd.Charset, ok = fields[1].(string); !ok {
+		return errors.New("Charset must be a string")
+	}
+
+	var charsetReader func(io.Reader) io.Reader
+	charset := strings.ToLower(cmd.Charset)
+	if charset != "utf-8" && charset != "us-ascii" {
+		charsetReader = func(r io.Reader) io.Reader {
+			r, _ = imap.CharsetReader(charset, r)
+			return r
+		}
+	}
+
+	cmd.Criteria = new(imap.SearchCriteria)
+	return cmd.Criteria.ParseWithCharset(fields[2:], charsetReader)
+}
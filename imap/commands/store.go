@@ -8,16 +8,29 @@ import (
 )
 
 // Store is a STORE command, as defined in RFC 3501 section 6.4.6.
+//
+// UnchangedSince is the UNCHANGEDSINCE modifier defined in RFC 7162. Since a
+// mod-sequence of zero is valid for UNCHANGEDSINCE, the modifier is only sent
+// if HasUnchangedSince is set.
 type Store struct {
 	SeqSet *imap.SeqSet
 	Item   imap.StoreItem
 	Value  interface{}
+
+	UnchangedSince    uint64
+	HasUnchangedSince bool
 }
 
 func (cmd *Store) Command() *imap.Command {
+	args := []interface{}{cmd.SeqSet}
+	if cmd.HasUnchangedSince {
+		args = append(args, []interface{}{imap.RawString("UNCHANGEDSINCE"), cmd.UnchangedSince})
+	}
+	args = append(args, imap.RawString(cmd.Item), cmd.Value)
+
 	return &imap.Command{
 		Name:      "STORE",
-		Arguments: []interface{}{cmd.SeqSet, imap.RawString(cmd.Item), cmd.Value},
+		Arguments: args,
 	}
 }
 
@@ -34,17 +47,36 @@ func (cmd *Store) Parse(fields []interface{}) error {
 	if cmd.SeqSet, err = imap.ParseSeqSet(seqset); err != nil {
 		return err
 	}
+	fields = fields[1:]
+
+	if modifiers, ok := fields[0].([]interface{}); ok {
+		if len(modifiers) != 2 {
+			return errors.New("Invalid STORE modifiers")
+		}
+		if name, _ := modifiers[0].(string); !strings.EqualFold(name, "UNCHANGEDSINCE") {
+			return errors.New("Unknown STORE modifier: " + name)
+		}
+		if cmd.UnchangedSince, err = imap.ParseNumber64(modifiers[1]); err != nil {
+			return err
+		}
+		cmd.HasUnchangedSince = true
+
+		fields = fields[1:]
+		if len(fields) < 2 {
+			return errors.New("No enough arguments")
+		}
+	}
 
-	if item, ok := fields[1].(string); !ok {
+	if item, ok := fields[0].(string); !ok {
 		return errors.New("Item name must be a string")
 	} else {
 		cmd.Item = imap.StoreItem(strings.ToUpper(item))
 	}
 
-	if len(fields[2:]) == 1 {
-		cmd.Value = fields[2]
+	if len(fields[1:]) == 1 {
+		cmd.Value = fields[1]
 	} else {
-		cmd.Value = fields[2:]
+		cmd.Value = fields[1:]
 	}
 	return nil
 }
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// Thread is a THREAD command, as defined in RFC 5256 section 3.
+type Thread struct {
+	Algorithm imap.ThreadAlgorithm
+	Charset   string
+	Criteria  *imap.SearchCriteria
+}
+
+func (cmd *Thread) Command() *imap.Command {
+	args := []interface{}{imap.RawString(cmd.Algorithm), imap.RawString(cmd.Charset)}
+	args = append(args, cmd.Criteria.Format()...)
+
+	return &imap.Command{
+		Name:      "THREAD",
+		Arguments: args,
+	}
+}
+
+func (cmd *Thread) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("Not enough arguments")
+	}
+
+	algorithm, ok := fields[0].(string)
+	if !ok {
+		return errors.New("Thread algorithm must be a string")
+	}
+	cmd.Algorithm = imap.ThreadAlgorithm(strings.ToUpper(algorithm))
+
+	if cmd.Charset, ok = fields[1].(string); !ok {
+		return errors.New("Charset must be a string")
+	}
+
+	var charsetReader func(io.Reader) io.Reader
+	charset := strings.ToLower(cmd.Charset)
+	if charset != "utf-8" && charset != "us-ascii" {
+		charsetReader = func(r io.Reader) io.Reader {
+			r, _ = imap.CharsetReader(charset, r)
+			return r
+		}
+	}
+
+	cmd.Criteria = new(imap.SearchCriteria)
+	return cmd.Criteria.ParseWithCharset(fields[2:], charsetReader)
+}
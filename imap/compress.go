@@ -0,0 +1,59 @@
+package imap
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+)
+
+// CompressDeflate is the DEFLATE compression mechanism, defined in RFC 4978.
+const CompressDeflate = "DEFLATE"
+
+// CodeCompressionActive is returned when COMPRESS is issued on a connection
+// which is already compressed, see RFC 4978 section 3.
+const CodeCompressionActive StatusRespCode = "COMPRESSIONACTIVE"
+
+// deflateConn compresses a connection with DEFLATE. Data written to the
+// connection is only sent when Flush is called.
+type deflateConn struct {
+	net.Conn
+
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+// NewDeflateConn wraps a connection with a raw DEFLATE stream in both
+// directions, as defined in RFC 4978 section 4. Each IMAP command or response
+// is followed by a flush: Conn does it automatically.
+func NewDeflateConn(conn net.Conn) (net.Conn, error) {
+	w, err := flate.NewWriter(conn, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deflateConn{
+		Conn: conn,
+		r:    flate.NewReader(conn),
+		w:    w,
+	}, nil
+}
+
+func (c *deflateConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *deflateConn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+// Flush sends the data written so far, see RFC 4978 section 4.
+func (c *deflateConn) Flush() error {
+	return c.w.Flush()
+}
+
+func (c *deflateConn) Close() error {
+	// The stream may already be broken, always close the connection
+	c.w.Close()
+	c.r.Close()
+	return c.Conn.Close()
+}
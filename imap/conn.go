@@ -229,7 +229,12 @@ func (c *Conn) Info() *ConnInfo {
 		LocalAddr:  c.LocalAddr(),
 	}
 
-	tlsConn, ok := c.Conn.(*tls.Conn)
+	conn := c.Conn
+	if dc, ok := conn.(*deflateConn); ok {
+		conn = dc.Conn
+	}
+
+	tlsConn, ok := conn.(*tls.Conn)
 	if ok {
 		state := tlsConn.ConnectionState()
 		info.TLS = &state
@@ -0,0 +1,191 @@
+package imap
+
+import (
+	"errors"
+	"strings"
+)
+
+// A SearchReturnOption is a RETURN option of the SEARCH command, as defined in
+// RFC 4731 section 3.1.
+type SearchReturnOption string
+
+const (
+	// SearchReturnMin returns the lowest matching message number.
+	SearchReturnMin SearchReturnOption = "MIN"
+	// SearchReturnMax returns the highest matching message number.
+	SearchReturnMax SearchReturnOption = "MAX"
+	// SearchReturnAll returns all matching message numbers as a sequence set.
+	SearchReturnAll SearchReturnOption = "ALL"
+	// SearchReturnCount returns the number of matching messages.
+	SearchReturnCount SearchReturnOption = "COUNT"
+	// SearchReturnSave saves the result of the search, so that it can be
+	// referred to with SearchRes. It is defined in RFC 5182.
+	SearchReturnSave SearchReturnOption = "SAVE"
+)
+
+// ParseSearchReturnOptions parses the list of options following RETURN. An
+// empty list is equivalent to ALL.
+func ParseSearchReturnOptions(fields []interface{}) ([]SearchReturnOption, error) {
+	if len(fields) == 0 {
+		return []SearchReturnOption{SearchReturnAll}, nil
+	}
+
+	options := make([]SearchReturnOption, 0, len(fields))
+	for _, f := range fields {
+		s, ok := f.(string)
+		if !ok {
+			return nil, errors.New("Search return option must be an atom")
+		}
+
+		option := SearchReturnOption(strings.ToUpper(s))
+		switch option {
+		case SearchReturnMin, SearchReturnMax, SearchReturnAll, SearchReturnCount, SearchReturnSave:
+		default:
+			return nil, errors.New("Unknown search return option: " + s)
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// FormatSearchReturnOptions formats a list of RETURN options.
+func FormatSearchReturnOptions(options []SearchReturnOption) []interface{} {
+	fields := make([]interface{}, len(options))
+	for i, option := range options {
+		fields[i] = RawString(option)
+	}
+	return fields
+}
+
+// HasSearchReturnOption returns true if options contains option.
+func HasSearchReturnOption(options []SearchReturnOption, option SearchReturnOption) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchData is the result of a SEARCH command with RETURN options, sent in an
+// ESEARCH response. See RFC 4731 section 3.1.
+type SearchData struct {
+	// The tag of the SEARCH command.
+	Tag string
+	// True if the numbers are UIDs.
+	Uid bool
+
+	// Min and Max are zero if no message matched.
+	Min   uint32
+	Max   uint32
+	All   *SeqSet
+	Count uint32
+	// The highest mod-sequence of the matching messages, set if the search
+	// criteria contain the MODSEQ key. See RFC 7162 section 3.1.5.
+	ModSeq uint64
+}
+
+// NewSearchData computes the result returned for options from the list of
+// matching message numbers.
+func NewSearchData(ids []uint32, options []SearchReturnOption) *SearchData {
+	data := new(SearchData)
+	for _, id := range ids {
+		if data.Min == 0 || id < data.Min {
+			data.Min = id
+		}
+		if id > data.Max {
+			data.Max = id
+		}
+	}
+	if HasSearchReturnOption(options, SearchReturnAll) && len(ids) > 0 {
+		data.All = new(SeqSet)
+		data.All.AddNum(ids...)
+	}
+	data.Count = uint32(len(ids))
+	return data
+}
+
+// Parse parses the fields of an ESEARCH response.
+func (data *SearchData) Parse(fields []interface{}) error {
+	if len(fields) > 0 {
+		if list, ok := fields[0].([]interface{}); ok {
+			// The search correlator: (TAG "tag")
+			if len(list) != 2 {
+				return errors.New("Invalid ESEARCH correlator")
+			}
+			if name, _ := ParseString(list[0]); !strings.EqualFold(name, "TAG") {
+				return errors.New("Invalid ESEARCH correlator")
+			}
+			var err error
+			if data.Tag, err = ParseString(list[1]); err != nil {
+				return err
+			}
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		if name, ok := fields[0].(string); ok && strings.EqualFold(name, "UID") {
+			data.Uid = true
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields)%2 != 0 {
+		return errors.New("ESEARCH data item without value")
+	}
+	for i := 0; i < len(fields); i += 2 {
+		name, ok := fields[i].(string)
+		if !ok {
+			return errors.New("ESEARCH data item name must be an atom")
+		}
+
+		var err error
+		value := fields[i+1]
+		switch strings.ToUpper(name) {
+		case "MIN":
+			data.Min, err = ParseNumber(value)
+		case "MAX":
+			data.Max, err = ParseNumber(value)
+		case "ALL":
+			data.All, err = ParseSeqSet(maybeString(value))
+		case "COUNT":
+			data.Count, err = ParseNumber(value)
+		case "MODSEQ":
+			data.ModSeq, err = ParseNumber64(value)
+		}
+		// Unknown data items are ignored
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Format formats the data items requested by options, as sent in an ESEARCH
+// response.
+func (data *SearchData) Format(options []SearchReturnOption) []interface{} {
+	var fields []interface{}
+	if data.Tag != "" {
+		fields = append(fields, []interface{}{RawString("TAG"), data.Tag})
+	}
+	if data.Uid {
+		fields = append(fields, RawString("UID"))
+	}
+
+	if HasSearchReturnOption(options, SearchReturnMin) && data.Min > 0 {
+		fields = append(fields, RawString("MIN"), data.Min)
+	}
+	if HasSearchReturnOption(options, SearchReturnMax) && data.Max > 0 {
+		fields = append(fields, RawString("MAX"), data.Max)
+	}
+	if HasSearchReturnOption(options, SearchReturnAll) && data.All != nil && !data.All.Empty() {
+		fields = append(fields, RawString("ALL"), data.All)
+	}
+	if HasSearchReturnOption(options, SearchReturnCount) {
+		fields = append(fields, RawString("COUNT"), data.Count)
+	}
+	if data.ModSeq > 0 {
+		fields = append(fields, RawString("MODSEQ"), data.ModSeq)
+	}
+	return fields
+}
@@ -19,6 +19,10 @@ const (
 	StatusUnseen      StatusItem = "UNSEEN"
 
 	StatusAppendLimit StatusItem = "APPENDLIMIT"
+
+	// StatusHighestModSeq is the highest mod-sequence value of all messages
+	// in the mailbox, defined in RFC 7162 (CONDSTORE).
+	StatusHighestModSeq StatusItem = "HIGHESTMODSEQ"
 )
 
 // A FetchItem is a message data item that can be fetched.
@@ -42,6 +46,10 @@ const (
 	FetchRFC822Size    FetchItem = "RFC822.SIZE"
 	FetchRFC822Text    FetchItem = "RFC822.TEXT"
 	FetchUid           FetchItem = "UID"
+
+	// FetchModSeq is the mod-sequence of the message, defined in RFC 7162
+	// (CONDSTORE).
+	FetchModSeq FetchItem = "MODSEQ"
 )
 
 // Expand expands the item if it's a macro.
@@ -225,6 +225,11 @@ type MailboxStatus struct {
 	// Per-mailbox limit of message size. Set only if server supports the
 	// APPENDLIMIT extension.
 	AppendLimit uint32
+
+	// The highest mod-sequence value of all messages in the mailbox. Set only
+	// if the server supports the CONDSTORE extension and the mailbox supports
+	// persistent mod-sequences.
+	HighestModSeq uint64
 }
 
 // Create a new mailbox status that will contain the specified items.
@@ -269,6 +274,8 @@ func (status *MailboxStatus) Parse(fields []interface{}) error {
 				status.UidValidity, err = ParseNumber(f)
 			case StatusAppendLimit:
 				status.AppendLimit, err = ParseNumber(f)
+			case StatusHighestModSeq:
+				status.HighestModSeq, err = ParseNumber64(f)
 			default:
 				status.Items[k] = f
 			}
@@ -298,6 +305,8 @@ func (status *MailboxStatus) Format() []interface{} {
 			v = status.UidValidity
 		case StatusAppendLimit:
 			v = status.AppendLimit
+		case StatusHighestModSeq:
+			v = status.HighestModSeq
 		}
 
 		fields = append(fields, RawString(k), v)
@@ -0,0 +1,591 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// MatchResult is the result of evaluating a SearchCriteria against a message
+// on the client side.
+type MatchResult int
+
+const (
+	// The message doesn't match the criteria.
+	MatchFalse MatchResult = iota
+	// The message matches the criteria.
+	MatchTrue
+	// The message doesn't contain the data required to evaluate the criteria,
+	// e.g. BODY is searched but no body section has been fetched. Only the
+	// server can tell whether the message matches.
+	MatchUndecidable
+)
+
+func (r MatchResult) String() string {
+	switch r {
+	case MatchFalse:
+		return "false"
+	case MatchTrue:
+		return "true"
+	default:
+		return "undecidable"
+	}
+}
+
+func matchBool(ok bool) MatchResult {
+	if ok {
+		return MatchTrue
+	}
+	return MatchFalse
+}
+
+// and combines two results with three-valued logic: a definite false wins
+// over undecidable.
+func (r MatchResult) and(other MatchResult) MatchResult {
+	if r == MatchFalse || other == MatchFalse {
+		return MatchFalse
+	}
+	if r == MatchUndecidable || other == MatchUndecidable {
+		return MatchUndecidable
+	}
+	return MatchTrue
+}
+
+// or combines two results with three-valued logic: a definite true wins over
+// undecidable.
+func (r MatchResult) or(other MatchResult) MatchResult {
+	if r == MatchTrue || other == MatchTrue {
+		return MatchTrue
+	}
+	if r == MatchUndecidable || other == MatchUndecidable {
+		return MatchUndecidable
+	}
+	return MatchFalse
+}
+
+func (r MatchResult) not() MatchResult {
+	switch r {
+	case MatchTrue:
+		return MatchFalse
+	case MatchFalse:
+		return MatchTrue
+	default:
+		return MatchUndecidable
+	}
+}
+
+// MatchMessage evaluates the criteria against a message that has already been
+// fetched, using the semantics of RFC 3501 section 6.4.4.
+//
+// The following message data is used when present:
+//   - SeqNum and Uid for sequence sets
+//   - InternalDate for BEFORE, ON and SINCE
+//   - Envelope or a header section for SENTBEFORE, SENTSINCE and header keys
+//   - Size for LARGER and SMALLER
+//   - Flags for flag keys
+//   - BODY[] (or RFC822), or BODY[TEXT] together with a header section
+//     containing Content-Type and Content-Transfer-Encoding, for BODY and TEXT
+//
+// Partial body sections are ignored. Body parts are decoded according to their
+// Content-Transfer-Encoding and charset, non-UTF-8 charsets require
+// CharsetReader. Only text parts are searched.
+//
+// MatchUndecidable is returned if the outcome depends on data that wasn't
+// fetched. Body literals are read but remain readable afterwards.
+func (c *SearchCriteria) MatchMessage(msg *Message) MatchResult {
+	m := &messageMatcher{msg: msg}
+	return m.match(c)
+}
+
+// messageMatcher caches the parsed sections of a message while a criteria and
+// its NOT and OR sub-criteria are evaluated.
+type messageMatcher struct {
+	msg *Message
+
+	sectionsLoaded bool
+	full           []byte
+	header         textproto.MIMEHeader // The complete header, if available
+	fields         []*headerSection     // Partial header sections
+	text           []byte               // The body without the header
+	hasText        bool
+}
+
+type headerSection struct {
+	fields    []string
+	notFields bool
+	header    textproto.MIMEHeader
+}
+
+// covers returns true if the section contains the header field key.
+func (s *headerSection) covers(key string) bool {
+	found := false
+	for _, f := range s.fields {
+		if strings.EqualFold(f, key) {
+			found = true
+			break
+		}
+	}
+	return found != s.notFields
+}
+
+func (m *messageMatcher) match(c *SearchCriteria) MatchResult {
+	result := MatchTrue
+
+	if c.SeqNum != nil {
+		result = result.and(matchSeqSet(c.SeqNum, m.msg.SeqNum))
+	}
+	if c.Uid != nil {
+		result = result.and(matchSeqSet(c.Uid, m.msg.Uid))
+	}
+	if result == MatchFalse {
+		return result
+	}
+
+	if !c.Since.IsZero() || !c.Before.IsZero() {
+		if m.has(FetchInternalDate) || !m.msg.InternalDate.IsZero() {
+			result = result.and(matchBool(matchDateRange(m.msg.InternalDate, c.Since, c.Before)))
+		} else {
+			result = result.and(MatchUndecidable)
+		}
+	}
+	if !c.SentSince.IsZero() || !c.SentBefore.IsZero() {
+		result = result.and(m.matchSentDate(c.SentSince, c.SentBefore))
+	}
+
+	if c.Larger > 0 || c.Smaller > 0 {
+		if m.has(FetchRFC822Size) || m.msg.Size > 0 {
+			size := m.msg.Size
+			ok := (c.Larger == 0 || size > c.Larger) && (c.Smaller == 0 || size < c.Smaller)
+			result = result.and(matchBool(ok))
+		} else {
+			result = result.and(MatchUndecidable)
+		}
+	}
+
+	if c.ModSeq > 0 {
+		if m.has(FetchModSeq) || m.msg.ModSeq > 0 {
+			result = result.and(matchBool(m.msg.ModSeq >= c.ModSeq))
+		} else {
+			result = result.and(MatchUndecidable)
+		}
+	}
+
+	if len(c.WithFlags) > 0 || len(c.WithoutFlags) > 0 {
+		if m.has(FetchFlags) || m.msg.Flags != nil {
+			result = result.and(matchBool(matchMessageFlags(m.msg.Flags, c.WithFlags, c.WithoutFlags)))
+		} else {
+			result = result.and(MatchUndecidable)
+		}
+	}
+	if result == MatchFalse {
+		return result
+	}
+
+	for key, values := range c.Header {
+		for _, value := range values {
+			result = result.and(m.matchHeader(key, value))
+		}
+	}
+	for _, body := range c.Body {
+		result = result.and(m.matchBody(body))
+	}
+	for _, text := range c.Text {
+		result = result.and(m.matchHeaderText(text).or(m.matchBody(text)))
+	}
+	if result == MatchFalse {
+		return result
+	}
+
+	for _, not := range c.Not {
+		result = result.and(m.match(not).not())
+	}
+	for _, or := range c.Or {
+		result = result.and(m.match(or[0]).or(m.match(or[1])))
+	}
+	return result
+}
+
+func (m *messageMatcher) has(item FetchItem) bool {
+	_, ok := m.msg.Items[item]
+	return ok
+}
+
+func matchSeqSet(set *SeqSet, num uint32) MatchResult {
+	if set.IsSearchRes() {
+		// The saved search result is only known by the server
+		return MatchUndecidable
+	}
+	if num == 0 || set.Dynamic() {
+		// "*" depends on the number of messages in the mailbox
+		if num != 0 && set.Contains(num) {
+			return MatchTrue
+		}
+		return MatchUndecidable
+	}
+	return matchBool(set.Contains(num))
+}
+
+// matchDateRange compares dates ignoring time and timezone, as required by
+// RFC 3501. since is inclusive, before is exclusive.
+func matchDateRange(date, since, before time.Time) bool {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	if !since.IsZero() {
+		since = time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC)
+		if date.Before(since) {
+			return false
+		}
+	}
+	if !before.IsZero() {
+		before = time.Date(before.Year(), before.Month(), before.Day(), 0, 0, 0, 0, time.UTC)
+		if !date.Before(before) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchMessageFlags(flags, with, without []string) bool {
+	set := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		set[CanonicalFlag(f)] = true
+	}
+	for _, f := range with {
+		if !set[CanonicalFlag(f)] {
+			return false
+		}
+	}
+	for _, f := range without {
+		if set[CanonicalFlag(f)] {
+			return false
+		}
+	}
+	return true
+}
+
+func matchString(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func (m *messageMatcher) matchSentDate(since, before time.Time) MatchResult {
+	var date time.Time
+	if m.msg.Envelope != nil {
+		date = m.msg.Envelope.Date
+	} else if h, ok := m.headerFor("Date"); ok {
+		date, _ = parseMessageDateTime(h.Get("Date"))
+	} else {
+		return MatchUndecidable
+	}
+
+	// A message without a valid Date header field doesn't match
+	if date.IsZero() {
+		return MatchFalse
+	}
+	return matchBool(matchDateRange(date, since, before))
+}
+
+// envelopeHeader returns the values of a header field available in the
+// envelope.
+func envelopeHeader(env *Envelope, key string) ([]string, bool) {
+	var addrs []*Address
+	switch textproto.CanonicalMIMEHeaderKey(key) {
+	case "Subject":
+		if env.Subject == "" {
+			return nil, true
+		}
+		return []string{env.Subject}, true
+	case "Message-Id":
+		if env.MessageId == "" {
+			return nil, true
+		}
+		return []string{env.MessageId}, true
+	case "In-Reply-To":
+		if env.InReplyTo == "" {
+			return nil, true
+		}
+		return []string{env.InReplyTo}, true
+	case "From":
+		addrs = env.From
+	case "Sender":
+		addrs = env.Sender
+	case "Reply-To":
+		addrs = env.ReplyTo
+	case "To":
+		addrs = env.To
+	case "Cc":
+		addrs = env.Cc
+	case "Bcc":
+		addrs = env.Bcc
+	default:
+		return nil, false
+	}
+
+	if len(addrs) == 0 {
+		return nil, true
+	}
+	list := make([]string, len(addrs))
+	for i, addr := range addrs {
+		if addr.PersonalName != "" {
+			list[i] = addr.PersonalName + " <" + addr.Address() + ">"
+		} else {
+			list[i] = addr.Address()
+		}
+	}
+	return []string{strings.Join(list, ", ")}, true
+}
+
+func (m *messageMatcher) matchHeader(key, value string) MatchResult {
+	var values []string
+	if h, ok := m.headerFor(key); ok {
+		for _, v := range h[textproto.CanonicalMIMEHeaderKey(key)] {
+			decoded, _ := decodeHeader(v)
+			values = append(values, decoded)
+		}
+	} else if m.msg.Envelope != nil {
+		if values, ok = envelopeHeader(m.msg.Envelope, key); !ok {
+			return MatchUndecidable
+		}
+	} else {
+		return MatchUndecidable
+	}
+
+	// An empty value matches all messages that contain the header field
+	if value == "" {
+		return matchBool(len(values) > 0)
+	}
+	for _, v := range values {
+		if matchString(v, value) {
+			return MatchTrue
+		}
+	}
+	return MatchFalse
+}
+
+// matchHeaderText searches the string in all header fields, for the TEXT key.
+func (m *messageMatcher) matchHeaderText(substr string) MatchResult {
+	m.loadSections()
+	if m.header == nil {
+		return MatchUndecidable
+	}
+	for key, values := range m.header {
+		for _, v := range values {
+			decoded, _ := decodeHeader(v)
+			if matchString(key+": "+decoded, substr) {
+				return MatchTrue
+			}
+		}
+	}
+	return MatchFalse
+}
+
+func (m *messageMatcher) matchBody(substr string) MatchResult {
+	m.loadSections()
+	if !m.hasText {
+		return MatchUndecidable
+	}
+
+	// Only the fields describing the content are needed to decode the body
+	header := make(textproto.MIMEHeader)
+	for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		h, ok := m.headerFor(key)
+		if !ok {
+			return MatchUndecidable
+		}
+		if v := h.Get(key); v != "" {
+			header.Set(key, v)
+		}
+	}
+
+	found, ok := searchEntity(header, m.text, substr)
+	if found {
+		return MatchTrue
+	} else if !ok {
+		return MatchUndecidable
+	}
+	return MatchFalse
+}
+
+// headerFor returns a fetched header containing the field key.
+func (m *messageMatcher) headerFor(key string) (textproto.MIMEHeader, bool) {
+	m.loadSections()
+	if m.header != nil {
+		return m.header, true
+	}
+	for _, s := range m.fields {
+		if s.covers(key) {
+			return s.header, true
+		}
+	}
+	return nil, false
+}
+
+// loadSections parses the top-level body sections of the message.
+func (m *messageMatcher) loadSections() {
+	if m.sectionsLoaded {
+		return
+	}
+	m.sectionsLoaded = true
+
+	var text []byte
+	for section := range m.msg.Body {
+		if len(section.Path) > 0 || section.Partial != nil {
+			continue
+		}
+
+		b := literalBytes(m.msg, section)
+		switch section.Specifier {
+		case EntireSpecifier:
+			m.full = b
+		case HeaderSpecifier:
+			h, err := readMIMEHeader(b)
+			if err != nil {
+				continue
+			}
+			if len(section.Fields) == 0 {
+				m.header = h
+			} else {
+				m.fields = append(m.fields, &headerSection{
+					fields:    section.Fields,
+					notFields: section.NotFields,
+					header:    h,
+				})
+			}
+		case TextSpecifier:
+			text = b
+			m.hasText = true
+		}
+	}
+
+	if m.full != nil {
+		br := bufio.NewReader(bytes.NewReader(m.full))
+		if h, err := textproto.NewReader(br).ReadMIMEHeader(); err == nil || len(h) > 0 {
+			m.header = h
+			m.text, _ = ioutil.ReadAll(br)
+			m.hasText = true
+			return
+		}
+	}
+	m.text = text
+}
+
+// literalBytes returns the content of a body section. Literals that can't be
+// read without being consumed are replaced by a buffer.
+func literalBytes(msg *Message, section *BodySectionName) []byte {
+	l := msg.Body[section]
+	if l == nil {
+		return nil
+	}
+	if b, ok := l.(interface{ Bytes() []byte }); ok {
+		return b.Bytes()
+	}
+
+	b, _ := ioutil.ReadAll(l)
+	msg.Body[section] = bytes.NewBuffer(b)
+	return b
+}
+
+func readMIMEHeader(b []byte) (textproto.MIMEHeader, error) {
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(b))).ReadMIMEHeader()
+	if err == io.EOF && len(h) > 0 {
+		err = nil
+	}
+	return h, err
+}
+
+// searchEntity searches substr in the decoded text parts of a MIME entity. ok
+// is false if some text part couldn't be decoded and substr wasn't found
+// elsewhere.
+func searchEntity(header textproto.MIMEHeader, body []byte, substr string) (found, ok bool) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	body, err = decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return false, false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		ok = true
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return false, ok
+			} else if err != nil {
+				return false, false
+			}
+			b, err := ioutil.ReadAll(p)
+			if err != nil {
+				return false, false
+			}
+			partFound, partOk := searchEntity(p.Header, b, substr)
+			if partFound {
+				return true, true
+			}
+			ok = ok && partOk
+		}
+	case mediaType == "message/rfc822":
+		br := bufio.NewReader(bytes.NewReader(body))
+		h, err := textproto.NewReader(br).ReadMIMEHeader()
+		if err != nil && len(h) == 0 {
+			return false, false
+		}
+		b, _ := ioutil.ReadAll(br)
+		return searchEntity(h, b, substr)
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "":
+		text, err := decodeCharset(params["charset"], body)
+		if err != nil {
+			return false, false
+		}
+		return matchString(text, substr), true
+	default:
+		// Attachments and other non-text parts aren't searched
+		return false, true
+	}
+}
+
+func decodeTransferEncoding(encoding string, b []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		clean := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, b)
+		dst := make([]byte, base64.StdEncoding.DecodedLen(len(clean)))
+		n, err := base64.StdEncoding.Decode(dst, clean)
+		return dst[:n], err
+	case "quoted-printable":
+		return ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(b)))
+	default:
+		return b, nil
+	}
+}
+
+func decodeCharset(charset string, b []byte) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return string(b), nil
+	}
+	if CharsetReader == nil {
+		return "", fmt.Errorf("imap: unhandled charset %q", charset)
+	}
+	r, err := CharsetReader(charset, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	decoded, err := ioutil.ReadAll(r)
+	return string(decoded), err
+}
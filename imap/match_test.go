@@ -0,0 +1,142 @@
+package imap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMatchResult(t *testing.T) {
+	values := []MatchResult{MatchFalse, MatchTrue, MatchUndecidable}
+	and := [3][3]MatchResult{
+		{MatchFalse, MatchFalse, MatchFalse},
+		{MatchFalse, MatchTrue, MatchUndecidable},
+		{MatchFalse, MatchUndecidable, MatchUndecidable},
+	}
+	or := [3][3]MatchResult{
+		{MatchFalse, MatchTrue, MatchUndecidable},
+		{MatchTrue, MatchTrue, MatchTrue},
+		{MatchUndecidable, MatchTrue, MatchUndecidable},
+	}
+	not := [3]MatchResult{MatchTrue, MatchFalse, MatchUndecidable}
+
+	for i, a := range values {
+		if got := a.not(); got != not[i] {
+			t.Errorf("NOT %v = %v, want %v", a, got, not[i])
+		}
+		for j, b := range values {
+			if got := a.and(b); got != and[i][j] {
+				t.Errorf("%v AND %v = %v, want %v", a, b, got, and[i][j])
+			}
+			if got := a.or(b); got != or[i][j] {
+				t.Errorf("%v OR %v = %v, want %v", a, b, got, or[i][j])
+			}
+		}
+	}
+}
+
+func mustSeqSet(s string) *SeqSet {
+	set, err := ParseSeqSet(s)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+func TestSearchCriteria_MatchMessage(t *testing.T) {
+	const body = "From: Alice <alice@example.org>\r\n" +
+		"Subject: Weekly report\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Hello world\r\n"
+
+	date := time.Date(2022, 5, 24, 20, 8, 0, 0, time.UTC)
+
+	// A message with flags, UID and internal date, but no body nor envelope
+	partial := func() *Message {
+		return &Message{
+			SeqNum:       3,
+			Uid:          42,
+			InternalDate: date,
+			Flags:        []string{SeenFlag},
+			Items: map[FetchItem]interface{}{
+				FetchUid:          nil,
+				FetchFlags:        nil,
+				FetchInternalDate: nil,
+			},
+		}
+	}
+	// The same message with the whole body
+	full := func() *Message {
+		msg := partial()
+		section := &BodySectionName{}
+		msg.Body = map[*BodySectionName]Literal{section: bytes.NewBufferString(body)}
+		msg.Items[section.FetchItem()] = nil
+		return msg
+	}
+
+	seen := &SearchCriteria{WithFlags: []string{SeenFlag}}
+	unseen := &SearchCriteria{WithoutFlags: []string{SeenFlag}}
+	hello := &SearchCriteria{Body: []string{"hello"}}
+	missing := &SearchCriteria{Body: []string{"missing"}}
+
+	tests := []struct {
+		name     string
+		criteria *SearchCriteria
+		partial  MatchResult
+		full     MatchResult
+	}{
+		{"all", &SearchCriteria{}, MatchTrue, MatchTrue},
+		{"uid", &SearchCriteria{Uid: mustSeqSet("40:45")}, MatchTrue, MatchTrue},
+		{"other uid", &SearchCriteria{Uid: mustSeqSet("1:5")}, MatchFalse, MatchFalse},
+		{"seq", &SearchCriteria{SeqNum: mustSeqSet("3")}, MatchTrue, MatchTrue},
+		{"seq star", &SearchCriteria{SeqNum: mustSeqSet("5:*")}, MatchUndecidable, MatchUndecidable},
+		{"search result", &SearchCriteria{Uid: mustSeqSet("$")}, MatchUndecidable, MatchUndecidable},
+		{"flag", seen, MatchTrue, MatchTrue},
+		{"without flag", unseen, MatchFalse, MatchFalse},
+		{"since", &SearchCriteria{Since: date}, MatchTrue, MatchTrue},
+		{"before", &SearchCriteria{Before: date}, MatchFalse, MatchFalse},
+		{"size", &SearchCriteria{Larger: 10}, MatchUndecidable, MatchUndecidable},
+		{"body", hello, MatchUndecidable, MatchTrue},
+		{"body not found", missing, MatchUndecidable, MatchFalse},
+		{"text in header", &SearchCriteria{Text: []string{"alice"}}, MatchUndecidable, MatchTrue},
+		{"header", &SearchCriteria{Header: map[string][]string{"Subject": {"report"}}}, MatchUndecidable, MatchTrue},
+		{"header not found", &SearchCriteria{Header: map[string][]string{"Subject": {"invoice"}}}, MatchUndecidable, MatchFalse},
+		{"not flag", &SearchCriteria{Not: []*SearchCriteria{seen}}, MatchFalse, MatchFalse},
+		{"not body", &SearchCriteria{Not: []*SearchCriteria{hello}}, MatchUndecidable, MatchFalse},
+		{"not body not found", &SearchCriteria{Not: []*SearchCriteria{missing}}, MatchUndecidable, MatchTrue},
+		{"not not", &SearchCriteria{Not: []*SearchCriteria{{Not: []*SearchCriteria{unseen}}}}, MatchFalse, MatchFalse},
+		{"flag and body", &SearchCriteria{WithFlags: []string{SeenFlag}, Body: []string{"hello"}}, MatchUndecidable, MatchTrue},
+		{"false and undecidable", &SearchCriteria{WithoutFlags: []string{SeenFlag}, Body: []string{"hello"}}, MatchFalse, MatchFalse},
+		{"true or undecidable", &SearchCriteria{Or: [][2]*SearchCriteria{{seen, missing}}}, MatchTrue, MatchTrue},
+		{"false or undecidable", &SearchCriteria{Or: [][2]*SearchCriteria{{unseen, hello}}}, MatchUndecidable, MatchTrue},
+		{"false or false", &SearchCriteria{Or: [][2]*SearchCriteria{{unseen, missing}}}, MatchUndecidable, MatchFalse},
+		{"not or", &SearchCriteria{Not: []*SearchCriteria{{Or: [][2]*SearchCriteria{{unseen, missing}}}}}, MatchUndecidable, MatchTrue},
+	}
+
+	for _, test := range tests {
+		if got := test.criteria.MatchMessage(partial()); got != test.partial {
+			t.Errorf("%s: MatchMessage(partial) = %v, want %v", test.name, got, test.partial)
+		}
+		if got := test.criteria.MatchMessage(full()); got != test.full {
+			t.Errorf("%s: MatchMessage(full) = %v, want %v", test.name, got, test.full)
+		}
+	}
+}
+
+func TestSearchCriteria_MatchMessage_literal(t *testing.T) {
+	section := &BodySectionName{}
+	msg := &Message{
+		Body:  map[*BodySectionName]Literal{section: bytes.NewBufferString("Subject: a\r\n\r\nhello\r\n")},
+		Items: map[FetchItem]interface{}{section.FetchItem(): nil},
+	}
+	c := &SearchCriteria{Body: []string{"hello"}}
+	for i := 0; i < 2; i++ {
+		if got := c.MatchMessage(msg); got != MatchTrue {
+			t.Errorf("MatchMessage() #%d = %v, want %v", i, got, MatchTrue)
+		}
+	}
+	if b := msg.Body[section].(*bytes.Buffer).String(); b != "Subject: a\r\n\r\nhello\r\n" {
+		t.Errorf("body literal = %q after matching", b)
+	}
+}
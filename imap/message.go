@@ -174,6 +174,8 @@ type Message struct {
 	Size uint32
 	// The message unique identifier. It must be greater than or equal to 1.
 	Uid uint32
+	// The message mod-sequence, see RFC 7162 (CONDSTORE).
+	ModSeq uint64
 	// The message body sections.
 	Body map[*BodySectionName]Literal
 
@@ -259,6 +261,16 @@ func (m *Message) Parse(fields []interface{}) error {
 				m.Size, _ = ParseNumber(f)
 			case FetchUid:
 				m.Uid, _ = ParseNumber(f)
+			case FetchModSeq:
+				// The mod-sequence is a parenthesized list with a single value
+				list, ok := f.([]interface{})
+				if !ok || len(list) != 1 {
+					return fmt.Errorf("cannot parse message: MODSEQ is not a list with one value")
+				}
+				var err error
+				if m.ModSeq, err = ParseNumber64(list[0]); err != nil {
+					return err
+				}
 			default:
 				// Likely to be a section of the body
 				// First check that the section name is correct
@@ -298,6 +310,8 @@ func (m *Message) formatItem(k FetchItem) []interface{} {
 		v = m.Size
 	case FetchUid:
 		v = m.Uid
+	case FetchModSeq:
+		v = []interface{}{m.ModSeq}
 	default:
 		for section, literal := range m.Body {
 			if section.value == k {
@@ -0,0 +1,78 @@
+package imap
+
+import (
+	"errors"
+)
+
+// QResyncParams contains the parameters of the QRESYNC parameter to SELECT
+// and EXAMINE, as defined in RFC 7162 section 3.2.5.
+type QResyncParams struct {
+	// The last known UIDVALIDITY of the mailbox.
+	UidValidity uint32
+	// The last known mod-sequence of the mailbox.
+	ModSeq uint64
+	// The optional set of UIDs known to the client.
+	KnownUids *SeqSet
+	// Optional sequence match data: the message sequence numbers in
+	// SeqMatchSeqNums correspond to the UIDs in SeqMatchUids.
+	SeqMatchSeqNums *SeqSet
+	SeqMatchUids    *SeqSet
+}
+
+// Parse parses QRESYNC parameters from fields.
+func (p *QResyncParams) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("imap: QRESYNC parameters need a UIDVALIDITY and a mod-sequence")
+	}
+
+	var err error
+	if p.UidValidity, err = ParseNumber(fields[0]); err != nil {
+		return err
+	}
+	if p.ModSeq, err = ParseNumber64(fields[1]); err != nil {
+		return err
+	}
+	fields = fields[2:]
+
+	if len(fields) > 0 {
+		if _, ok := fields[0].([]interface{}); !ok {
+			if p.KnownUids, err = ParseSeqSet(maybeString(fields[0])); err != nil {
+				return err
+			}
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) > 0 {
+		match, ok := fields[0].([]interface{})
+		if !ok || len(match) != 2 {
+			return errors.New("imap: invalid QRESYNC sequence match data")
+		}
+		if p.SeqMatchSeqNums, err = ParseSeqSet(maybeString(match[0])); err != nil {
+			return err
+		}
+		if p.SeqMatchUids, err = ParseSeqSet(maybeString(match[1])); err != nil {
+			return err
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) > 0 {
+		return errors.New("imap: too many QRESYNC parameters")
+	}
+	return nil
+}
+
+// Format formats QRESYNC parameters to fields.
+func (p *QResyncParams) Format() []interface{} {
+	fields := []interface{}{p.UidValidity, p.ModSeq}
+	if p.KnownUids != nil {
+		fields = append(fields, p.KnownUids)
+
+		// Sequence match data can only follow known UIDs
+		if p.SeqMatchSeqNums != nil && p.SeqMatchUids != nil {
+			fields = append(fields, []interface{}{p.SeqMatchSeqNums, p.SeqMatchUids})
+		}
+	}
+	return fields
+}
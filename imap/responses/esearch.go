@@ -0,0 +1,37 @@
+package responses
+
+import (
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+const esearchName = "ESEARCH"
+
+// An ESEARCH response.
+// See RFC 4731 section 3.1
+type ESearch struct {
+	Data *imap.SearchData
+	// The data items to write, as requested in the SEARCH command.
+	Return []imap.SearchReturnOption
+}
+
+func (r *ESearch) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != esearchName {
+		return ErrUnhandled
+	}
+
+	data := new(imap.SearchData)
+	if err := data.Parse(fields); err != nil {
+		return err
+	}
+	r.Data = data
+	return nil
+}
+
+func (r *ESearch) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{imap.RawString(esearchName)}
+	fields = append(fields, r.Data.Format(r.Return)...)
+
+	resp := imap.NewUntaggedResp(fields)
+	return resp.WriteTo(w)
+}
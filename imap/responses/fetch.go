@@ -50,7 +50,9 @@ func (r *Fetch) Handle(resp imap.Resp) error {
 	// In case we requested UIDs with a dynamic sequence (i.e. * or n:*) and the maximum UID of the mailbox
 	// is less then our n, the server will supply us with the max UID (cf. RFC 3501 §6.4.8 and §9 `seq-range`).
 	// Thus, such a result is correct and has to be returned by us.
-	if !r.SeqSet.Contains(num) && (!r.Uid || !r.SeqSet.Dynamic()) {
+	// The saved search result "$" is only known by the server: all results are
+	// accepted.
+	if !r.SeqSet.IsSearchRes() && !r.SeqSet.Contains(num) && (!r.Uid || !r.SeqSet.Dynamic()) {
 		return ErrUnhandled
 	}
 
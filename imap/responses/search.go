@@ -1,6 +1,9 @@
 package responses
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/zhangdapeng520/zdpgo_imap/imap"
 )
 
@@ -10,6 +13,9 @@ const searchName = "SEARCH"
 // See RFC 3501 section 7.2.5
 type Search struct {
 	Ids []uint32
+	// The highest mod-sequence of the returned messages, set if the search
+	// criteria contain the MODSEQ key. See RFC 7162 section 3.1.5.
+	ModSeq uint64
 }
 
 func (r *Search) Handle(resp imap.Resp) error {
@@ -18,6 +24,23 @@ func (r *Search) Handle(resp imap.Resp) error {
 		return ErrUnhandled
 	}
 
+	// A (MODSEQ n) list can follow the message numbers
+	if n := len(fields); n > 0 {
+		if list, ok := fields[n-1].([]interface{}); ok {
+			if len(list) != 2 {
+				return errors.New("imap: invalid SEARCH response modifier")
+			}
+			if name, _ := imap.ParseString(list[0]); !strings.EqualFold(name, "MODSEQ") {
+				return errors.New("imap: invalid SEARCH response modifier")
+			}
+			var err error
+			if r.ModSeq, err = imap.ParseNumber64(list[1]); err != nil {
+				return err
+			}
+			fields = fields[:n-1]
+		}
+	}
+
 	r.Ids = make([]uint32, len(fields))
 	for i, f := range fields {
 		if id, err := imap.ParseNumber(f); err != nil {
@@ -35,6 +58,9 @@ func (r *Search) WriteTo(w *imap.Writer) (err error) {
 	for _, id := range r.Ids {
 		fields = append(fields, id)
 	}
+	if r.ModSeq > 0 {
+		fields = append(fields, []interface{}{imap.RawString("MODSEQ"), r.ModSeq})
+	}
 
 	resp := imap.NewUntaggedResp(fields)
 	return resp.WriteTo(w)
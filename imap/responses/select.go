@@ -29,6 +29,11 @@ func (r *Select) Handle(resp imap.Resp) error {
 		flags, _ := fields[0].([]interface{})
 		mbox.Flags, _ = imap.ParseStringList(flags)
 	case *imap.StatusResp:
+		if resp.Code == imap.CodeNoModSeq {
+			// The mailbox doesn't support persistent mod-sequences
+			mbox.HighestModSeq = 0
+			return nil
+		}
 		if len(resp.Arguments) < 1 {
 			return ErrUnhandled
 		}
@@ -46,6 +51,9 @@ func (r *Select) Handle(resp imap.Resp) error {
 		case "UIDVALIDITY":
 			mbox.UidValidity, _ = imap.ParseNumber(resp.Arguments[0])
 			item = imap.StatusUidValidity
+		case "HIGHESTMODSEQ":
+			mbox.HighestModSeq, _ = imap.ParseNumber64(resp.Arguments[0])
+			item = imap.StatusHighestModSeq
 		default:
 			return ErrUnhandled
 		}
@@ -135,6 +143,21 @@ func (r *Select) WriteTo(w *imap.Writer) error {
 			if err := statusRes.WriteTo(w); err != nil {
 				return err
 			}
+		case imap.StatusHighestModSeq:
+			statusRes := &imap.StatusResp{
+				Type:      imap.StatusRespOk,
+				Code:      imap.CodeHighestModSeq,
+				Arguments: []interface{}{mbox.HighestModSeq},
+				Info:      "Highest",
+			}
+			if mbox.HighestModSeq == 0 {
+				statusRes.Code = imap.CodeNoModSeq
+				statusRes.Arguments = nil
+				statusRes.Info = "Sorry, this mailbox format doesn't support modsequences"
+			}
+			if err := statusRes.WriteTo(w); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -0,0 +1,40 @@
+package responses
+
+import (
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+const sortName = "SORT"
+
+// A SORT response.
+// See RFC 5256 section 4
+type Sort struct {
+	Ids []uint32
+}
+
+func (r *Sort) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != sortName {
+		return ErrUnhandled
+	}
+
+	for _, f := range fields {
+		id, err := imap.ParseNumber(f)
+		if err != nil {
+			return err
+		}
+		r.Ids = append(r.Ids, id)
+	}
+
+	return nil
+}
+
+func (r *Sort) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{imap.RawString(sortName)}
+	for _, id := range r.Ids {
+		fields = append(fields, id)
+	}
+
+	resp := imap.NewUntaggedResp(fields)
+	return resp.WriteTo(w)
+}
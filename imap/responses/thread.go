@@ -0,0 +1,37 @@
+package responses
+
+import (
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+const threadName = "THREAD"
+
+// A THREAD response.
+// See RFC 5256 section 4
+type Thread struct {
+	Threads []*imap.Thread
+}
+
+func (r *Thread) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != threadName {
+		return ErrUnhandled
+	}
+
+	threads, err := imap.ParseThreads(fields)
+	if err != nil {
+		return err
+	}
+	r.Threads = append(r.Threads, threads...)
+	return nil
+}
+
+func (r *Thread) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{imap.RawString(threadName)}
+	if len(r.Threads) > 0 {
+		fields = append(fields, imap.RawString(imap.FormatThreads(r.Threads)))
+	}
+
+	resp := imap.NewUntaggedResp(fields)
+	return resp.WriteTo(w)
+}
@@ -0,0 +1,58 @@
+package responses
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+const vanishedName = "VANISHED"
+
+// A VANISHED response, defined in RFC 7162 section 3.2.10. It replaces EXPUNGE
+// responses once QRESYNC has been enabled.
+type Vanished struct {
+	// True if the response describes messages expunged before the current
+	// command, e.g. in reply to SELECT (QRESYNC ...) or UID FETCH ... VANISHED.
+	Earlier bool
+	Uids    *imap.SeqSet
+}
+
+func (r *Vanished) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != vanishedName {
+		return ErrUnhandled
+	}
+
+	if len(fields) > 0 {
+		if list, ok := fields[0].([]interface{}); ok {
+			if len(list) != 1 {
+				return errors.New("imap: invalid VANISHED response tag")
+			}
+			if tag, _ := imap.ParseString(list[0]); !strings.EqualFold(tag, "EARLIER") {
+				return errors.New("imap: unknown VANISHED response tag: " + tag)
+			}
+			r.Earlier = true
+			fields = fields[1:]
+		}
+	}
+	if len(fields) == 0 {
+		return errNotEnoughFields
+	}
+
+	s, err := imap.ParseString(fields[0])
+	if err != nil {
+		return err
+	}
+	r.Uids, err = imap.ParseSeqSet(s)
+	return err
+}
+
+func (r *Vanished) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{imap.RawString(vanishedName)}
+	if r.Earlier {
+		fields = append(fields, []interface{}{imap.RawString("EARLIER")})
+	}
+	fields = append(fields, r.Uids)
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
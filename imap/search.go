@@ -78,6 +78,10 @@ type SearchCriteria struct {
 	Larger  uint32 // Size is larger than this number
 	Smaller uint32 // Size is smaller than this number
 
+	// Mod-sequence is greater than or equal to this number, see RFC 7162
+	// (CONDSTORE). The optional metadata entry name and type are ignored.
+	ModSeq uint64
+
 	Not []*SearchCriteria    // Each criteria doesn't match
 	Or  [][2]*SearchCriteria // Each criteria pair has at least one match of two
 }
@@ -159,6 +163,23 @@ func (c *SearchCriteria) parseField(fields []interface{}, charsetReader func(io.
 		} else if c.Larger == 0 || n > c.Larger {
 			c.Larger = n
 		}
+	case "MODSEQ":
+		if f, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		}
+		if _, err := ParseNumber64(f); err != nil {
+			// An entry name and an entry type precede the value
+			if _, fields, err = popSearchField(fields); err != nil {
+				return nil, err
+			} else if f, fields, err = popSearchField(fields); err != nil {
+				return nil, err
+			}
+		}
+		if n, err := ParseNumber64(f); err != nil {
+			return nil, err
+		} else if n > c.ModSeq {
+			c.ModSeq = n
+		}
 	case "NEW":
 		c.WithFlags = append(c.WithFlags, RecentFlag)
 		c.WithoutFlags = append(c.WithoutFlags, SeenFlag)
@@ -353,6 +374,9 @@ func (c *SearchCriteria) Format() []interface{} {
 	if c.Smaller > 0 {
 		fields = append(fields, RawString("SMALLER"), c.Smaller)
 	}
+	if c.ModSeq > 0 {
+		fields = append(fields, RawString("MODSEQ"), c.ModSeq)
+	}
 
 	for _, not := range c.Not {
 		fields = append(fields, RawString("NOT"), not.Format())
@@ -120,14 +120,32 @@ func (s Seq) String() string {
 // sequence-set ABNF rule). The zero value is an empty set.
 type SeqSet struct {
 	Set []Seq
+
+	searchRes bool
+}
+
+// SearchRes returns a set referring to the result of the last SEARCH command
+// saved with the SAVE return option. It is written as "$", see RFC 5182.
+func SearchRes() *SeqSet {
+	return &SeqSet{searchRes: true}
 }
 
 // ParseSeqSet returns a new SeqSet instance after parsing the set string.
 func ParseSeqSet(set string) (s *SeqSet, err error) {
+	if set == "$" {
+		return SearchRes(), nil
+	}
 	s = new(SeqSet)
 	return s, s.Add(set)
 }
 
+// IsSearchRes returns true if the set refers to the saved search result, see
+// SearchRes. Such a set contains no values: it must be replaced with the saved
+// result before use.
+func (s SeqSet) IsSearchRes() bool {
+	return s.searchRes
+}
+
 // Add inserts new sequence values into the set. The string format is described
 // by RFC 3501 sequence-set ABNF rule. If an error is encountered, all values
 // inserted successfully prior to the error remain in the set.
@@ -194,6 +212,9 @@ func (s SeqSet) Contains(q uint32) bool {
 
 // String returns a sorted representation of all contained sequence values.
 func (s SeqSet) String() string {
+	if s.searchRes {
+		return "$"
+	}
 	if len(s.Set) == 0 {
 		return ""
 	}
@@ -32,10 +32,20 @@ func (cmd *Select) Handle(conn Conn) error {
 	// server doesn't announce the UNSELECT capability.
 	ctx.Mailbox = nil
 	ctx.MailboxReadOnly = false
+	ctx.SearchRes = nil
 
 	if ctx.User == nil {
 		return ErrNotAuthenticated
 	}
+	if cmd.CondStore || cmd.QResync != nil {
+		if !conn.Server().supportModSeq() {
+			return ErrModSeqUnsupported
+		}
+		if cmd.QResync != nil && !ctx.QResync {
+			return ErrQResyncDisabled
+		}
+		ctx.CondStore = true
+	}
 	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
 	if err != nil {
 		return err
@@ -46,10 +56,21 @@ func (cmd *Select) Handle(conn Conn) error {
 		imap.StatusUidNext, imap.StatusUidValidity,
 	}
 
+	modSeqMbox, hasModSeq := mbox.(backend.ModSeqMailbox)
+	hasModSeq = hasModSeq && conn.Server().supportModSeq()
+	if hasModSeq {
+		items = append(items, imap.StatusHighestModSeq)
+	}
+
 	status, err := mbox.Status(items)
 	if err != nil {
 		return err
 	}
+	if !hasModSeq && ctx.CondStore {
+		// Reply with NOMODSEQ
+		status.Items[imap.StatusHighestModSeq] = nil
+		status.HighestModSeq = 0
+	}
 
 	ctx.Mailbox = mbox
 	ctx.MailboxReadOnly = cmd.ReadOnly || status.ReadOnly
@@ -59,6 +80,13 @@ func (cmd *Select) Handle(conn Conn) error {
 		return err
 	}
 
+	// The client has to resynchronize from scratch if UIDVALIDITY changed
+	if cmd.QResync != nil && hasModSeq && cmd.QResync.UidValidity == status.UidValidity {
+		if err := resync(conn, modSeqMbox, cmd.QResync); err != nil {
+			return err
+		}
+	}
+
 	var code imap.StatusRespCode = imap.CodeReadWrite
 	if ctx.MailboxReadOnly {
 		code = imap.CodeReadOnly
@@ -254,7 +282,13 @@ func (cmd *Append) Handle(conn Conn) error {
 		return err
 	}
 
-	if err := mbox.CreateMessage(cmd.Flags, cmd.Date, cmd.Message); err != nil {
+	var data *imap.AppendData
+	if m, ok := mbox.(backend.UidPlusMailbox); ok && conn.Server().supportUidPlus() {
+		data, err = m.CreateMessageUid(cmd.Flags, cmd.Date, cmd.Message)
+	} else {
+		err = mbox.CreateMessage(cmd.Flags, cmd.Date, cmd.Message)
+	}
+	if err != nil {
 		if err == backend.ErrTooBig {
 			return ErrStatusResp(&imap.StatusResp{
 				Type: imap.StatusRespNo,
@@ -282,9 +316,51 @@ func (cmd *Append) Handle(conn Conn) error {
 		}
 	}
 
+	if data != nil {
+		return ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeAppendUid,
+			Arguments: data.Format(),
+			Info:      "APPEND completed",
+		})
+	}
 	return nil
 }
 
+type Enable struct {
+	commands.Enable
+}
+
+func (cmd *Enable) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	if ctx.Mailbox != nil {
+		return errors.New("ENABLE is not allowed when a mailbox is selected")
+	}
+
+	var enabled []string
+	for _, cap := range cmd.Caps {
+		switch strings.ToUpper(cap) {
+		case "CONDSTORE":
+			if conn.Server().supportModSeq() {
+				ctx.CondStore = true
+				enabled = append(enabled, "CONDSTORE")
+			}
+		case "QRESYNC":
+			// QRESYNC implies CONDSTORE
+			if conn.Server().supportModSeq() {
+				ctx.CondStore = true
+				ctx.QResync = true
+				enabled = append(enabled, "QRESYNC")
+			}
+		}
+	}
+
+	return conn.WriteResp(&responses.Enabled{Caps: enabled})
+}
+
 type Unselect struct {
 	commands.Unselect
 }
@@ -297,6 +373,7 @@ func (cmd *Unselect) Handle(conn Conn) error {
 
 	ctx.Mailbox = nil
 	ctx.MailboxReadOnly = false
+	ctx.SearchRes = nil
 	return nil
 }
 
@@ -52,6 +52,7 @@ func (cmd *Close) Handle(conn Conn) error {
 	mailbox := ctx.Mailbox
 	ctx.Mailbox = nil
 	ctx.MailboxReadOnly = false
+	ctx.SearchRes = nil
 
 	// No need to send expunge updates here, since the mailbox is already unselected
 	return mailbox.Expunge()
@@ -61,7 +62,7 @@ type Expunge struct {
 	commands.Expunge
 }
 
-func (cmd *Expunge) Handle(conn Conn) error {
+func (cmd *Expunge) handle(uid bool, conn Conn) error {
 	ctx := conn.Context()
 	if ctx.Mailbox == nil {
 		return ErrNoMailboxSelected
@@ -70,60 +71,118 @@ func (cmd *Expunge) Handle(conn Conn) error {
 		return ErrMailboxReadOnly
 	}
 
-	// Get a list of messages that will be deleted
-	// That will allow us to send expunge updates if the backend doesn't support it
-	var seqnums []uint32
-	if conn.Server().Updates == nil {
-		criteria := &imap.SearchCriteria{
-			WithFlags: []string{imap.DeletedFlag},
-		}
+	var err error
+	if cmd.SeqSet, err = resolveSeqSet(conn, uid, cmd.SeqSet); err != nil {
+		return err
+	}
 
-		var err error
-		seqnums, err = ctx.Mailbox.SearchMessages(false, criteria)
-		if err != nil {
-			return err
+	criteria := &imap.SearchCriteria{
+		WithFlags: []string{imap.DeletedFlag},
+	}
+
+	var mbox backend.UidPlusMailbox
+	if uid {
+		var ok bool
+		mbox, ok = ctx.Mailbox.(backend.UidPlusMailbox)
+		if !ok || !conn.Server().supportUidPlus() {
+			return ErrUidPlusUnsupported
 		}
+		criteria.Uid = cmd.SeqSet
 	}
 
-	if err := ctx.Mailbox.Expunge(); err != nil {
+	// Get a list of messages that will be deleted
+	// That will allow us to send expunge updates if the backend doesn't support it
+	ids, err := expungedIds(conn, criteria)
+	if err != nil {
 		return err
 	}
 
-	// If the backend doesn't support expunge updates, let's do it ourselves
-	if conn.Server().Updates == nil {
-		done := make(chan error, 1)
+	if uid {
+		err = mbox.ExpungeUids(cmd.SeqSet)
+	} else {
+		err = ctx.Mailbox.Expunge()
+	}
+	if err != nil {
+		return err
+	}
 
-		ch := make(chan uint32)
-		res := &responses.Expunge{SeqNums: ch}
+	return writeExpunged(conn, ids)
+}
 
-		go (func() {
-			done <- conn.WriteResp(res)
-			// Don't need to drain 'ch', sender will stop sending when error written to 'done.
-		})()
+func (cmd *Expunge) Handle(conn Conn) error {
+	if cmd.SeqSet != nil {
+		return errors.New("EXPUNGE takes a sequence set only with UID")
+	}
+	return cmd.handle(false, conn)
+}
 
-		// Iterate sequence numbers from the last one to the first one, as deleting
-		// messages changes their respective numbers
-		for i := len(seqnums) - 1; i >= 0; i-- {
-			// Send sequence numbers to channel, and check if conn.WriteResp() finished early.
-			select {
-			case ch <- seqnums[i]: // Send next seq. number
-			case err := <-done: // Check for errors
-				close(ch)
-				return err
-			}
-		}
-		close(ch)
+func (cmd *Expunge) UidHandle(conn Conn) error {
+	if cmd.SeqSet == nil {
+		return errors.New("UID EXPUNGE needs a sequence set")
+	}
+	return cmd.handle(true, conn)
+}
+
+// expungedIds returns the messages matching criteria, which are about to be
+// expunged. They are UIDs once QRESYNC is enabled and sequence numbers
+// otherwise. Nothing is returned if the backend sends updates itself.
+func expungedIds(conn Conn, criteria *imap.SearchCriteria) ([]uint32, error) {
+	if conn.Server().Updates != nil {
+		return nil, nil
+	}
+
+	ctx := conn.Context()
+	return ctx.Mailbox.SearchMessages(ctx.QResync, criteria)
+}
+
+// writeExpunged sends EXPUNGE responses, or a VANISHED response once QRESYNC
+// is enabled, for messages returned by expungedIds.
+func writeExpunged(conn Conn, ids []uint32) error {
+	// If the backend supports expunge updates, there is nothing to do
+	if conn.Server().Updates != nil || len(ids) == 0 {
+		return nil
+	}
 
-		if err := <-done; err != nil {
+	if conn.Context().QResync {
+		uids := new(imap.SeqSet)
+		uids.AddNum(ids...)
+		return conn.WriteResp(&responses.Vanished{Uids: uids})
+	}
+
+	done := make(chan error, 1)
+
+	ch := make(chan uint32)
+	res := &responses.Expunge{SeqNums: ch}
+
+	go (func() {
+		done <- conn.WriteResp(res)
+		// Don't need to drain 'ch', sender will stop sending when error written to 'done.
+	})()
+
+	// Iterate sequence numbers from the last one to the first one, as deleting
+	// messages changes their respective numbers
+	for i := len(ids) - 1; i >= 0; i-- {
+		// Send sequence numbers to channel, and check if conn.WriteResp() finished early.
+		select {
+		case ch <- ids[i]: // Send next seq. number
+		case err := <-done: // Check for errors
+			close(ch)
 			return err
 		}
 	}
+	close(ch)
 
-	return nil
+	return <-done
 }
 
 type Search struct {
 	commands.Search
+
+	tag string
+}
+
+func (cmd *Search) setTag(tag string) {
+	cmd.tag = tag
 }
 
 func (cmd *Search) handle(uid bool, conn Conn) error {
@@ -132,13 +191,55 @@ func (cmd *Search) handle(uid bool, conn Conn) error {
 		return ErrNoMailboxSelected
 	}
 
+	if err := resolveCriteria(conn, cmd.Criteria); err != nil {
+		return err
+	}
+	save := imap.HasSearchReturnOption(cmd.Return, imap.SearchReturnSave)
+	if save {
+		// If the search fails, the saved result is empty
+		ctx.SearchRes = new(imap.SeqSet)
+	}
+
+	var mbox backend.ModSeqMailbox
+	if hasModSeqCriteria(cmd.Criteria) {
+		var err error
+		if mbox, err = modSeqMailbox(conn); err != nil {
+			return err
+		}
+	}
+
 	ids, err := ctx.Mailbox.SearchMessages(uid, cmd.Criteria)
 	if err != nil {
 		return err
 	}
 
-	res := &responses.Search{Ids: ids}
-	return conn.WriteResp(res)
+	var modSeq uint64
+	if mbox != nil {
+		// Return the highest mod-sequence of the found messages
+		if modSeq, err = highestModSeq(mbox, uid, ids); err != nil {
+			return err
+		}
+	}
+
+	if len(cmd.Return) == 0 {
+		return conn.WriteResp(&responses.Search{Ids: ids, ModSeq: modSeq})
+	}
+
+	if save {
+		if err := saveSearchResult(conn, uid, ids, cmd.Return); err != nil {
+			return err
+		}
+		if len(cmd.Return) == 1 {
+			// No ESEARCH response if SAVE is the only option
+			return nil
+		}
+	}
+
+	data := imap.NewSearchData(ids, cmd.Return)
+	data.Tag = cmd.tag
+	data.Uid = uid
+	data.ModSeq = modSeq
+	return conn.WriteResp(&responses.ESearch{Data: data, Return: cmd.Return})
 }
 
 func (cmd *Search) Handle(conn Conn) error {
@@ -149,8 +250,73 @@ func (cmd *Search) UidHandle(conn Conn) error {
 	return cmd.handle(true, conn)
 }
 
+type Sort struct {
+	commands.Sort
+}
+
+func (cmd *Sort) handle(uid bool, conn Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return ErrNoMailboxSelected
+	}
+
+	mbox, ok := ctx.Mailbox.(backend.SortMailbox)
+	if !ok || !conn.Server().supportSort() {
+		return ErrSortUnsupported
+	}
+
+	ids, err := mbox.SortMessages(uid, cmd.SortCriteria, cmd.Criteria)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteResp(&responses.Sort{Ids: ids})
+}
+
+func (cmd *Sort) Handle(conn Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Sort) UidHandle(conn Conn) error {
+	return cmd.handle(true, conn)
+}
+
+type Thread struct {
+	commands.Thread
+}
+
+func (cmd *Thread) handle(uid bool, conn Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return ErrNoMailboxSelected
+	}
+
+	mbox, ok := ctx.Mailbox.(backend.ThreadMailbox)
+	if !ok || !conn.Server().supportThread(cmd.Algorithm) {
+		return ErrThreadAlgorithmUnsupported
+	}
+
+	threads, err := mbox.ThreadMessages(uid, cmd.Algorithm, cmd.Criteria)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteResp(&responses.Thread{Threads: threads})
+}
+
+func (cmd *Thread) Handle(conn Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Thread) UidHandle(conn Conn) error {
+	return cmd.handle(true, conn)
+}
+
 type Fetch struct {
 	commands.Fetch
+
+	// Messages not to return, used by STORE with UNCHANGEDSINCE
+	exclude *imap.SeqSet
 }
 
 func (cmd *Fetch) handle(uid bool, conn Conn) error {
@@ -159,6 +325,60 @@ func (cmd *Fetch) handle(uid bool, conn Conn) error {
 		return ErrNoMailboxSelected
 	}
 
+	var err error
+	if cmd.SeqSet, err = resolveSeqSet(conn, uid, cmd.SeqSet); err != nil {
+		return err
+	}
+
+	hasModSeq := false
+	for _, item := range cmd.Items {
+		if item == imap.FetchModSeq {
+			hasModSeq = true
+			break
+		}
+	}
+
+	var mbox backend.ModSeqMailbox
+	if cmd.ChangedSince > 0 || hasModSeq {
+		if mbox, err = modSeqMailbox(conn); err != nil {
+			return err
+		}
+	} else if ctx.CondStore {
+		// Once CONDSTORE is enabled, MODSEQ is returned along with FLAGS
+		mbox, _ = ctx.Mailbox.(backend.ModSeqMailbox)
+		if mbox != nil {
+			for _, item := range cmd.Items {
+				if item == imap.FetchFlags {
+					cmd.Items = append(cmd.Items, imap.FetchModSeq)
+					hasModSeq = true
+					break
+				}
+			}
+		}
+	}
+	if cmd.ChangedSince > 0 && !hasModSeq {
+		cmd.Items = append(cmd.Items, imap.FetchModSeq)
+	}
+
+	if cmd.Vanished {
+		if !uid {
+			return errors.New("VANISHED can only be used with UID FETCH")
+		}
+		if !ctx.QResync {
+			return ErrQResyncDisabled
+		}
+
+		vanished, err := mbox.ExpungedSince(cmd.ChangedSince, cmd.SeqSet)
+		if err != nil {
+			return err
+		}
+		if !vanished.Empty() {
+			if err := conn.WriteResp(&responses.Vanished{Earlier: true, Uids: vanished}); err != nil {
+				return err
+			}
+		}
+	}
+
 	ch := make(chan *imap.Message)
 	res := &responses.Fetch{Messages: ch}
 
@@ -170,8 +390,28 @@ func (cmd *Fetch) handle(uid bool, conn Conn) error {
 		}
 	})()
 
-	err := ctx.Mailbox.ListMessages(uid, cmd.SeqSet, cmd.Items, ch)
-	if err != nil {
+	list := ch
+	if cmd.ChangedSince > 0 || cmd.exclude != nil {
+		list = make(chan *imap.Message)
+		go (func() {
+			defer close(ch)
+			for msg := range list {
+				id := msg.SeqNum
+				if uid {
+					id = msg.Uid
+				}
+				if cmd.ChangedSince > 0 && msg.ModSeq <= cmd.ChangedSince {
+					continue
+				}
+				if cmd.exclude != nil && cmd.exclude.Contains(id) {
+					continue
+				}
+				ch <- msg
+			}
+		})()
+	}
+
+	if err := ctx.Mailbox.ListMessages(uid, cmd.SeqSet, cmd.Items, list); err != nil {
 		return err
 	}
 
@@ -211,6 +451,11 @@ func (cmd *Store) handle(uid bool, conn Conn) error {
 		return ErrMailboxReadOnly
 	}
 
+	var err error
+	if cmd.SeqSet, err = resolveSeqSet(conn, uid, cmd.SeqSet); err != nil {
+		return err
+	}
+
 	// Only flags operations are supported
 	op, silent, err := imap.ParseFlagsOp(cmd.Item)
 	if err != nil {
@@ -238,22 +483,45 @@ func (cmd *Store) handle(uid bool, conn Conn) error {
 		flags[i] = imap.CanonicalFlag(flag)
 	}
 
-	// If the backend supports message updates, this will prevent this connection
-	// from receiving them
-	// TODO: find a better way to do this, without conn.silent
-	*conn.silent() = silent
-	err = ctx.Mailbox.UpdateMessagesFlags(uid, cmd.SeqSet, op, flags)
-	*conn.silent() = false
-	if err != nil {
-		return err
+	var modified *imap.SeqSet
+	if cmd.HasUnchangedSince {
+		mbox, err := modSeqMailbox(conn)
+		if err != nil {
+			return err
+		}
+
+		*conn.silent() = silent
+		modified, err = mbox.UpdateMessagesFlagsUnchangedSince(uid, cmd.SeqSet, cmd.UnchangedSince, op, flags)
+		*conn.silent() = false
+		if err != nil {
+			return err
+		}
+	} else {
+		// If the backend supports message updates, this will prevent this connection
+		// from receiving them
+		// TODO: find a better way to do this, without conn.silent
+		*conn.silent() = silent
+		err = ctx.Mailbox.UpdateMessagesFlags(uid, cmd.SeqSet, op, flags)
+		*conn.silent() = false
+		if err != nil {
+			return err
+		}
 	}
 
+	// Once CONDSTORE is enabled, the new mod-sequences are sent even if silent
+	_, hasModSeq := ctx.Mailbox.(backend.ModSeqMailbox)
+	condStore := ctx.CondStore && hasModSeq
+
 	// Not silent: send FETCH updates if the backend doesn't support message
 	// updates
-	if conn.Server().Updates == nil && !silent {
-		inner := &Fetch{}
+	if conn.Server().Updates == nil && (!silent || condStore) {
+		inner := &Fetch{exclude: modified}
 		inner.SeqSet = cmd.SeqSet
-		inner.Items = []imap.FetchItem{imap.FetchFlags}
+		if silent {
+			inner.Items = []imap.FetchItem{imap.FetchModSeq}
+		} else {
+			inner.Items = []imap.FetchItem{imap.FetchFlags}
+		}
 		if uid {
 			inner.Items = append(inner.Items, "UID")
 		}
@@ -263,6 +531,14 @@ func (cmd *Store) handle(uid bool, conn Conn) error {
 		}
 	}
 
+	if modified != nil {
+		return ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeModified,
+			Arguments: []interface{}{modified},
+			Info:      "Conditional STORE failed",
+		})
+	}
 	return nil
 }
 
@@ -284,7 +560,29 @@ func (cmd *Copy) handle(uid bool, conn Conn) error {
 		return ErrNoMailboxSelected
 	}
 
-	return ctx.Mailbox.CopyMessages(uid, cmd.SeqSet, cmd.Mailbox)
+	var err error
+	if cmd.SeqSet, err = resolveSeqSet(conn, uid, cmd.SeqSet); err != nil {
+		return err
+	}
+
+	mbox, ok := ctx.Mailbox.(backend.UidPlusMailbox)
+	if !ok || !conn.Server().supportUidPlus() {
+		return ctx.Mailbox.CopyMessages(uid, cmd.SeqSet, cmd.Mailbox)
+	}
+
+	data, err := mbox.CopyMessagesUid(uid, cmd.SeqSet, cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+	if data == nil || data.SourceUids.Empty() {
+		return nil
+	}
+	return ErrStatusResp(&imap.StatusResp{
+		Type:      imap.StatusRespOk,
+		Code:      imap.CodeCopyUid,
+		Arguments: data.Format(),
+		Info:      "COPY completed",
+	})
 }
 
 func (cmd *Copy) Handle(conn Conn) error {
@@ -305,10 +603,52 @@ func (h *Move) handle(uid bool, conn Conn) error {
 		return ErrNoMailboxSelected
 	}
 
-	if m, ok := mailbox.(backend.MoveMailbox); ok {
-		return m.MoveMessages(uid, h.SeqSet, h.Mailbox)
+	m, ok := mailbox.(backend.MoveMailbox)
+	if !ok {
+		return errors.New("MOVE extension not supported")
+	}
+
+	var err error
+	if h.SeqSet, err = resolveSeqSet(conn, uid, h.SeqSet); err != nil {
+		return err
+	}
+
+	// The moved messages are expunged from the selected mailbox
+	criteria := new(imap.SearchCriteria)
+	if uid {
+		criteria.Uid = h.SeqSet
+	} else {
+		criteria.SeqNum = h.SeqSet
+	}
+	ids, err := expungedIds(conn, criteria)
+	if err != nil {
+		return err
+	}
+
+	var data *imap.CopyData
+	if um, ok := mailbox.(backend.UidPlusMoveMailbox); ok && conn.Server().supportUidPlus() {
+		data, err = um.MoveMessagesUid(uid, h.SeqSet, h.Mailbox)
+	} else {
+		err = m.MoveMessages(uid, h.SeqSet, h.Mailbox)
 	}
-	return errors.New("MOVE extension not supported")
+	if err != nil {
+		return err
+	}
+
+	// COPYUID is sent before the expunge updates, see RFC 6851 section 4.3
+	if data != nil && !data.SourceUids.Empty() {
+		res := &imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeCopyUid,
+			Arguments: data.Format(),
+			Info:      "Moved UIDs.",
+		}
+		if err := conn.WriteResp(res); err != nil {
+			return err
+		}
+	}
+
+	return writeExpunged(conn, ids)
 }
 
 func (h *Move) Handle(conn Conn) error {
@@ -321,10 +661,17 @@ func (h *Move) UidHandle(conn Conn) error {
 
 type Uid struct {
 	commands.Uid
+
+	tag string
+}
+
+func (cmd *Uid) setTag(tag string) {
+	cmd.tag = tag
 }
 
 func (cmd *Uid) Handle(conn Conn) error {
 	inner := cmd.Cmd.Command()
+	inner.Tag = cmd.tag
 	hdlr, err := conn.commandHandler(inner)
 	if err != nil {
 		return err
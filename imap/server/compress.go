@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/commands"
+)
+
+// This file implements the COMPRESS extension, defined in RFC 4978. It isn't
+// enabled by default since compression uses memory for each connection:
+//
+//	s.Enable(server.NewCompressExtension())
+
+type Compress struct {
+	commands.Compress
+}
+
+func (cmd *Compress) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.State&imap.AuthenticatedState == 0 {
+		return ErrNotAuthenticated
+	}
+	if cmd.Mechanism != imap.CompressDeflate {
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespBad,
+			Info: "Unsupported compression mechanism",
+		})
+	}
+	if ctx.Compressed {
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: imap.CodeCompressionActive,
+			Info: "Compression is already enabled",
+		})
+	}
+
+	// The OK response is the last one sent uncompressed
+	return ErrStatusResp(&imap.StatusResp{
+		Type: imap.StatusRespOk,
+		Info: "DEFLATE active",
+	})
+}
+
+func (cmd *Compress) Upgrade(conn Conn) error {
+	err := conn.Upgrade(func(sock net.Conn) (net.Conn, error) {
+		conn.WaitReady()
+		return imap.NewDeflateConn(sock)
+	})
+	if err != nil {
+		return err
+	}
+
+	conn.Context().Compressed = true
+	return nil
+}
+
+type compressExtension struct{}
+
+// NewCompressExtension returns an extension which allows authenticated clients
+// to compress their connection with the COMPRESS DEFLATE command.
+func NewCompressExtension() Extension {
+	return &compressExtension{}
+}
+
+func (ext *compressExtension) Capabilities(c Conn) []string {
+	ctx := c.Context()
+	if ctx.State&imap.AuthenticatedState == 0 || ctx.Compressed {
+		return nil
+	}
+	return []string{"COMPRESS=" + imap.CompressDeflate}
+}
+
+func (ext *compressExtension) Command(name string) HandlerFactory {
+	if name != "COMPRESS" {
+		return nil
+	}
+	return func() Handler {
+		return &Compress{}
+	}
+}
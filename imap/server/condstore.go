@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/responses"
+)
+
+// This file implements the CONDSTORE and QRESYNC extensions, defined in
+// RFC 7162.
+
+var (
+	ErrModSeqUnsupported = errors.New("CONDSTORE extension not supported")
+	ErrQResyncDisabled   = errors.New("QRESYNC extension not enabled")
+)
+
+// supportModSeq returns true if the backend supports CONDSTORE and QRESYNC.
+func (s *Server) supportModSeq() bool {
+	be, ok := s.Backend.(backend.ModSeqBackend)
+	return ok && be.SupportModSeq()
+}
+
+// modSeqMailbox returns the selected mailbox if it supports mod-sequences.
+// Since every command using mod-sequences is a CONDSTORE enabling command,
+// CONDSTORE is enabled for the connection.
+func modSeqMailbox(conn Conn) (backend.ModSeqMailbox, error) {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return nil, ErrNoMailboxSelected
+	}
+
+	mbox, ok := ctx.Mailbox.(backend.ModSeqMailbox)
+	if !ok || !conn.Server().supportModSeq() {
+		return nil, ErrModSeqUnsupported
+	}
+
+	ctx.CondStore = true
+	return mbox, nil
+}
+
+// hasModSeqCriteria returns true if the MODSEQ key is used in c.
+func hasModSeqCriteria(c *imap.SearchCriteria) bool {
+	if c.ModSeq > 0 {
+		return true
+	}
+	for _, not := range c.Not {
+		if hasModSeqCriteria(not) {
+			return true
+		}
+	}
+	for _, or := range c.Or {
+		if hasModSeqCriteria(or[0]) || hasModSeqCriteria(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// highestModSeq returns the highest mod-sequence of the messages in ids.
+func highestModSeq(mbox backend.ModSeqMailbox, uid bool, ids []uint32) (uint64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(ids...)
+
+	ch := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		done <- mbox.ListMessages(uid, seqset, []imap.FetchItem{imap.FetchModSeq}, ch)
+	}()
+
+	var modSeq uint64
+	for msg := range ch {
+		if msg.ModSeq > modSeq {
+			modSeq = msg.ModSeq
+		}
+	}
+	return modSeq, <-done
+}
+
+// resync sends the changes of the selected mailbox since the state described
+// in params, as defined in RFC 7162 section 3.2.5.1.
+func resync(conn Conn, mbox backend.ModSeqMailbox, params *imap.QResyncParams) error {
+	vanished, err := mbox.ExpungedSince(params.ModSeq, params.KnownUids)
+	if err != nil {
+		return err
+	}
+	if !vanished.Empty() {
+		if err := conn.WriteResp(&responses.Vanished{Earlier: true, Uids: vanished}); err != nil {
+			return err
+		}
+	}
+
+	uids := params.KnownUids
+	if uids == nil {
+		uids, _ = imap.ParseSeqSet("1:*")
+	}
+
+	fetch := &Fetch{}
+	fetch.SeqSet = uids
+	fetch.Items = []imap.FetchItem{imap.FetchUid, imap.FetchFlags}
+	fetch.ChangedSince = params.ModSeq
+	return fetch.handle(true, conn)
+}
@@ -54,6 +54,14 @@ type Context struct {
 	Mailbox backend.Mailbox
 	// True if the currently selected mailbox has been opened in read-only mode.
 	MailboxReadOnly bool
+	// True if the client has enabled CONDSTORE or QRESYNC, see RFC 7162.
+	CondStore bool
+	QResync   bool
+	// True if the connection is compressed, see RFC 4978.
+	Compressed bool
+	// The UIDs saved by the last SEARCH command with the SAVE option, see
+	// RFC 5182. Reset when the mailbox is closed.
+	SearchRes *imap.SeqSet
 	// Responses to send to the client.
 	Responses chan<- imap.WriterTo
 	// Closed when the client is logged out.
@@ -197,6 +205,20 @@ func (c *conn) Capabilities() []string {
 		}
 	}
 
+	if c.s.supportUidPlus() {
+		caps = append(caps, "UIDPLUS")
+	}
+	if c.s.supportModSeq() {
+		caps = append(caps, "ENABLE", "CONDSTORE", "QRESYNC")
+	}
+	caps = append(caps, "ESEARCH", "SEARCHRES")
+	if c.s.supportSort() {
+		caps = append(caps, "SORT")
+	}
+	for _, algorithm := range c.s.threadAlgorithms() {
+		caps = append(caps, "THREAD="+string(algorithm))
+	}
+
 	for _, ext := range c.s.extensions {
 		caps = append(caps, ext.Capabilities(c)...)
 	}
@@ -384,6 +406,9 @@ func (c *conn) commandHandler(cmd *imap.Command) (hdlr Handler, err error) {
 	}
 
 	hdlr = newHandler()
+	if tagged, ok := hdlr.(taggedHandler); ok {
+		tagged.setTag(cmd.Tag)
+	}
 	err = hdlr.Parse(cmd.Arguments)
 	return
 }
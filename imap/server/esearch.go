@@ -0,0 +1,104 @@
+package server
+
+import (
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+// This file implements the ESEARCH extension, defined in RFC 4731, and the
+// SEARCHRES extension, defined in RFC 5182. Both are handled by the SEARCH
+// handler on top of backend.Mailbox.SearchMessages. Handlers taking a sequence
+// set replace "$" with the saved result.
+
+// A taggedHandler is a handler which needs the tag of its command.
+type taggedHandler interface {
+	setTag(tag string)
+}
+
+// saveSearchResult saves the result of a SEARCH command with the SAVE option.
+// The result is saved as UIDs, so that it remains valid after expunges.
+func saveSearchResult(conn Conn, uid bool, ids []uint32, options []imap.SearchReturnOption) error {
+	ctx := conn.Context()
+
+	// If MIN or MAX is specified without ALL or COUNT, only the corresponding
+	// messages are saved, see RFC 5182 section 2.4
+	hasMin := imap.HasSearchReturnOption(options, imap.SearchReturnMin)
+	hasMax := imap.HasSearchReturnOption(options, imap.SearchReturnMax)
+	if (hasMin || hasMax) && !imap.HasSearchReturnOption(options, imap.SearchReturnAll) &&
+		!imap.HasSearchReturnOption(options, imap.SearchReturnCount) {
+		data := imap.NewSearchData(ids, nil)
+		ids = nil
+		if hasMin && data.Min > 0 {
+			ids = append(ids, data.Min)
+		}
+		if hasMax && data.Max > 0 {
+			ids = append(ids, data.Max)
+		}
+	}
+
+	saved := new(imap.SeqSet)
+	saved.AddNum(ids...)
+	if !uid && !saved.Empty() {
+		uids, err := ctx.Mailbox.SearchMessages(true, &imap.SearchCriteria{SeqNum: saved})
+		if err != nil {
+			return err
+		}
+		saved = new(imap.SeqSet)
+		saved.AddNum(uids...)
+	}
+
+	ctx.SearchRes = saved
+	return nil
+}
+
+// resolveSeqSet replaces the saved search result "$" with the saved UIDs, or
+// the corresponding sequence numbers if uid is false. Other sets are returned
+// unchanged.
+func resolveSeqSet(conn Conn, uid bool, set *imap.SeqSet) (*imap.SeqSet, error) {
+	if set == nil || !set.IsSearchRes() {
+		return set, nil
+	}
+
+	// Without a saved result, "$" is an empty set
+	ctx := conn.Context()
+	resolved := new(imap.SeqSet)
+	if ctx.SearchRes == nil || ctx.SearchRes.Empty() {
+		return resolved, nil
+	}
+	if uid {
+		resolved.AddSet(ctx.SearchRes)
+		return resolved, nil
+	}
+
+	seqNums, err := ctx.Mailbox.SearchMessages(false, &imap.SearchCriteria{Uid: ctx.SearchRes})
+	if err != nil {
+		return nil, err
+	}
+	resolved.AddNum(seqNums...)
+	return resolved, nil
+}
+
+// resolveCriteria replaces the saved search result "$" in search criteria.
+func resolveCriteria(conn Conn, c *imap.SearchCriteria) error {
+	var err error
+	if c.SeqNum, err = resolveSeqSet(conn, false, c.SeqNum); err != nil {
+		return err
+	}
+	if c.Uid, err = resolveSeqSet(conn, true, c.Uid); err != nil {
+		return err
+	}
+
+	for _, not := range c.Not {
+		if err := resolveCriteria(conn, not); err != nil {
+			return err
+		}
+	}
+	for _, or := range c.Or {
+		if err := resolveCriteria(conn, or[0]); err != nil {
+			return err
+		}
+		if err := resolveCriteria(conn, or[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -178,11 +178,14 @@ func New(bkd backend.Backend) *Server {
 		"APPEND":   func() Handler { return &Append{} },
 		"UNSELECT": func() Handler { return &Unselect{} },
 		"IDLE":     func() Handler { return &Idle{} },
+		"ENABLE":   func() Handler { return &Enable{} },
 
 		"CHECK":   func() Handler { return &Check{} },
 		"CLOSE":   func() Handler { return &Close{} },
 		"EXPUNGE": func() Handler { return &Expunge{} },
 		"SEARCH":  func() Handler { return &Search{} },
+		"SORT":    func() Handler { return &Sort{} },
+		"THREAD":  func() Handler { return &Thread{} },
 		"FETCH":   func() Handler { return &Fetch{} },
 		"STORE":   func() Handler { return &Store{} },
 		"COPY":    func() Handler { return &Copy{} },
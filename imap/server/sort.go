@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend"
+)
+
+// This file implements the SORT and THREAD extensions, defined in RFC 5256.
+
+var (
+	ErrSortUnsupported            = errors.New("SORT extension not supported")
+	ErrThreadAlgorithmUnsupported = errors.New("Threading algorithm not supported")
+)
+
+// supportSort returns true if the backend supports SORT.
+func (s *Server) supportSort() bool {
+	be, ok := s.Backend.(backend.SortBackend)
+	return ok && be.SupportSort()
+}
+
+// threadAlgorithms returns the threading algorithms supported by the backend.
+func (s *Server) threadAlgorithms() []imap.ThreadAlgorithm {
+	if be, ok := s.Backend.(backend.ThreadBackend); ok {
+		return be.ThreadAlgorithms()
+	}
+	return nil
+}
+
+// supportThread returns true if the backend supports the threading algorithm.
+func (s *Server) supportThread(algorithm imap.ThreadAlgorithm) bool {
+	for _, supported := range s.threadAlgorithms() {
+		if supported == algorithm {
+			return true
+		}
+	}
+	return false
+}
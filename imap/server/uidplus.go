@@ -0,0 +1,18 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend"
+)
+
+// The UIDPLUS extension is defined in RFC 4315. It is handled by the APPEND,
+// COPY, MOVE and UID EXPUNGE handlers.
+
+var ErrUidPlusUnsupported = errors.New("UIDPLUS extension not supported")
+
+// supportUidPlus returns true if the backend supports UIDPLUS.
+func (s *Server) supportUidPlus() bool {
+	be, ok := s.Backend.(backend.UidPlusBackend)
+	return ok && be.SupportUidPlus()
+}
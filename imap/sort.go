@@ -0,0 +1,84 @@
+package imap
+
+import (
+	"errors"
+	"strings"
+)
+
+// A SortField is a key used to sort messages, as defined in RFC 5256 section
+// 3.
+type SortField string
+
+const (
+	// SortArrival sorts by internal date and time.
+	SortArrival SortField = "ARRIVAL"
+	// SortCc sorts by the mailbox of the first "cc" address.
+	SortCc SortField = "CC"
+	// SortDate sorts by the sent date, or by the internal date if the message
+	// has no valid Date header field.
+	SortDate SortField = "DATE"
+	// SortFrom sorts by the mailbox of the first "From" address.
+	SortFrom SortField = "FROM"
+	// SortSize sorts by size.
+	SortSize SortField = "SIZE"
+	// SortSubject sorts by base subject, see RFC 5256 section 2.1.
+	SortSubject SortField = "SUBJECT"
+	// SortTo sorts by the mailbox of the first "To" address.
+	SortTo SortField = "TO"
+)
+
+// A SortCriterion is a sort key. If Reverse is set, the order of the key is
+// reversed.
+type SortCriterion struct {
+	Field   SortField
+	Reverse bool
+}
+
+// ParseSortCriteria parses a list of sort criteria.
+func ParseSortCriteria(fields []interface{}) ([]SortCriterion, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("Empty sort criteria")
+	}
+
+	var criteria []SortCriterion
+	reverse := false
+	for _, f := range fields {
+		s, ok := f.(string)
+		if !ok {
+			return nil, errors.New("Sort criterion must be an atom")
+		}
+
+		field := SortField(strings.ToUpper(s))
+		switch field {
+		case "REVERSE":
+			if reverse {
+				return nil, errors.New("Duplicate REVERSE sort criterion")
+			}
+			reverse = true
+			continue
+		case SortArrival, SortCc, SortDate, SortFrom, SortSize, SortSubject, SortTo:
+		default:
+			return nil, errors.New("Unknown sort criterion: " + s)
+		}
+
+		criteria = append(criteria, SortCriterion{Field: field, Reverse: reverse})
+		reverse = false
+	}
+	if reverse {
+		return nil, errors.New("REVERSE must be followed by a sort key")
+	}
+
+	return criteria, nil
+}
+
+// FormatSortCriteria formats a list of sort criteria.
+func FormatSortCriteria(criteria []SortCriterion) []interface{} {
+	var fields []interface{}
+	for _, c := range criteria {
+		if c.Reverse {
+			fields = append(fields, RawString("REVERSE"))
+		}
+		fields = append(fields, RawString(c.Field))
+	}
+	return fields
+}
@@ -56,6 +56,14 @@ const (
 	CodeUnseen         StatusRespCode = "UNSEEN"
 )
 
+// Status response codes defined in RFC 7162 (CONDSTORE and QRESYNC).
+const (
+	CodeHighestModSeq StatusRespCode = "HIGHESTMODSEQ"
+	CodeNoModSeq      StatusRespCode = "NOMODSEQ"
+	CodeModified      StatusRespCode = "MODIFIED"
+	CodeClosed        StatusRespCode = "CLOSED"
+)
+
 // A status response.
 // See RFC 3501 section 7.1
 type StatusResp struct {
@@ -74,8 +82,8 @@ type StatusResp struct {
 
 func (r *StatusResp) resp() {}
 
-// If this status is NO or BAD, returns an error with the status info.
-// Otherwise, returns nil.
+// If this status is NO or BAD, returns an *ErrStatusResp containing the status.
+// The error message is the status info. Otherwise, returns nil.
 func (r *StatusResp) Err() error {
 	if r == nil {
 		// No status response, connection closed before we get one
@@ -83,7 +91,7 @@ func (r *StatusResp) Err() error {
 	}
 
 	if r.Type == StatusRespNo || r.Type == StatusRespBad {
-		return errors.New(r.Info)
+		return &ErrStatusResp{Resp: r}
 	}
 	return nil
 }
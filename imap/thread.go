@@ -0,0 +1,117 @@
+package imap
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A ThreadAlgorithm is a threading algorithm, as defined in RFC 5256 section
+// 3.
+type ThreadAlgorithm string
+
+const (
+	// OrderedSubjectThreading groups messages by base subject and orders them by
+	// sent date.
+	OrderedSubjectThreading ThreadAlgorithm = "ORDEREDSUBJECT"
+	// ReferencesThreading groups messages using the In-Reply-To and References
+	// header fields, as described in RFC 5256 section 3.
+	ReferencesThreading ThreadAlgorithm = "REFERENCES"
+)
+
+// A Thread is a node of a thread tree returned by the THREAD command. Id is a
+// message sequence number or a UID. It is zero for a dummy node, which groups
+// siblings whose parent is not in the mailbox.
+type Thread struct {
+	Id       uint32
+	Children []*Thread
+}
+
+// ParseThreads parses a list of threads, as sent in a THREAD response.
+func ParseThreads(fields []interface{}) ([]*Thread, error) {
+	threads := make([]*Thread, 0, len(fields))
+	for _, f := range fields {
+		list, ok := f.([]interface{})
+		if !ok {
+			return nil, errors.New("Thread is not a list")
+		}
+
+		thread, err := parseThread(list)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, thread)
+	}
+	return threads, nil
+}
+
+func parseThread(fields []interface{}) (*Thread, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("Empty thread")
+	}
+
+	var root, cur *Thread
+	for i, f := range fields {
+		if _, ok := f.([]interface{}); ok {
+			// The remaining fields are the branches of the current node
+			if cur == nil {
+				root = &Thread{}
+				cur = root
+			}
+			children, err := ParseThreads(fields[i:])
+			if err != nil {
+				return nil, err
+			}
+			cur.Children = append(cur.Children, children...)
+			break
+		}
+
+		id, err := ParseNumber(f)
+		if err != nil {
+			return nil, err
+		}
+		node := &Thread{Id: id}
+		if cur == nil {
+			root = node
+		} else {
+			cur.Children = append(cur.Children, node)
+		}
+		cur = node
+	}
+
+	return root, nil
+}
+
+// FormatThreads formats a list of threads, as sent in a THREAD response.
+// Nested thread lists are not separated by spaces, see RFC 5256 section 4.
+func FormatThreads(threads []*Thread) string {
+	var b strings.Builder
+	for _, thread := range threads {
+		formatThread(&b, thread)
+	}
+	return b.String()
+}
+
+func formatThread(b *strings.Builder, thread *Thread) {
+	b.WriteByte('(')
+
+	var ids []string
+	if thread.Id != 0 {
+		ids = append(ids, strconv.FormatUint(uint64(thread.Id), 10))
+	}
+	// A chain of single children is written as a flat list of ids
+	for len(thread.Children) == 1 && thread.Children[0].Id != 0 {
+		thread = thread.Children[0]
+		ids = append(ids, strconv.FormatUint(uint64(thread.Id), 10))
+	}
+	b.WriteString(strings.Join(ids, " "))
+
+	if len(ids) > 0 && len(thread.Children) > 0 {
+		b.WriteByte(' ')
+	}
+	for _, child := range thread.Children {
+		formatThread(b, child)
+	}
+
+	b.WriteByte(')')
+}
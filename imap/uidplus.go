@@ -0,0 +1,110 @@
+package imap
+
+import (
+	"errors"
+)
+
+// Status response codes defined in RFC 4315 (UIDPLUS).
+const (
+	CodeAppendUid    StatusRespCode = "APPENDUID"
+	CodeCopyUid      StatusRespCode = "COPYUID"
+	CodeUidNotSticky StatusRespCode = "UIDNOTSTICKY"
+)
+
+// AppendData is the data of an APPENDUID response code, returned when a
+// message is appended to a mailbox. See RFC 4315 section 3.
+type AppendData struct {
+	// The UIDVALIDITY of the destination mailbox.
+	UidValidity uint32
+	// The UID assigned to the appended message.
+	Uid uint32
+}
+
+// Parse parses APPENDUID response code arguments.
+func (data *AppendData) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("imap: APPENDUID needs a UIDVALIDITY and a UID")
+	}
+
+	var err error
+	if data.UidValidity, err = ParseNumber(fields[0]); err != nil {
+		return err
+	}
+	data.Uid, err = ParseNumber(fields[1])
+	return err
+}
+
+// Format formats APPENDUID response code arguments.
+func (data *AppendData) Format() []interface{} {
+	return []interface{}{data.UidValidity, data.Uid}
+}
+
+// CopyData is the data of a COPYUID response code, returned when messages are
+// copied or moved to another mailbox. See RFC 4315 section 3.
+type CopyData struct {
+	// The UIDVALIDITY of the destination mailbox.
+	UidValidity uint32
+	// The UIDs of the source messages and the UIDs assigned to their copies,
+	// in the same order.
+	SourceUids *SeqSet
+	DestUids   *SeqSet
+}
+
+// Parse parses COPYUID response code arguments.
+func (data *CopyData) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("imap: COPYUID needs a UIDVALIDITY and two UID sets")
+	}
+
+	var err error
+	if data.UidValidity, err = ParseNumber(fields[0]); err != nil {
+		return err
+	}
+	if data.SourceUids, err = ParseSeqSet(maybeString(fields[1])); err != nil {
+		return err
+	}
+	data.DestUids, err = ParseSeqSet(maybeString(fields[2]))
+	return err
+}
+
+// Format formats COPYUID response code arguments.
+func (data *CopyData) Format() []interface{} {
+	return []interface{}{data.UidValidity, data.SourceUids, data.DestUids}
+}
+
+// Map returns the UID of the copy of each source message.
+func (data *CopyData) Map() map[uint32]uint32 {
+	src := expandSeqSet(data.SourceUids)
+	dst := expandSeqSet(data.DestUids)
+
+	m := make(map[uint32]uint32, len(src))
+	for i, uid := range src {
+		if i >= len(dst) {
+			break
+		}
+		m[uid] = dst[i]
+	}
+	return m
+}
+
+// expandSeqSet returns the numbers in a static sequence set, in order.
+func expandSeqSet(set *SeqSet) []uint32 {
+	if set == nil {
+		return nil
+	}
+
+	var nums []uint32
+	for _, seq := range set.Set {
+		if seq.Start == 0 || seq.Stop == 0 {
+			// Dynamic sets can't be expanded
+			return nil
+		}
+		for num := seq.Start; ; num++ {
+			nums = append(nums, num)
+			if num == seq.Stop {
+				break
+			}
+		}
+	}
+	return nums
+}
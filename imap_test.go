@@ -1,6 +1,18 @@
 package zdpgo_imap
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend/memory"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/server"
+)
 
 func getImap() *Imap {
 	ic := NewWithConfig(&Config{
@@ -36,3 +48,130 @@ func TestImap_SearchByContent(t *testing.T) {
 		panic(err)
 	}
 }
+
+// asciiSearch 模拟不支持UTF-8的服务器，SEARCH只接受US-ASCII字符集，搜索非ASCII的内容时返回BAD
+type asciiSearch struct{}
+
+func (asciiSearch) Capabilities(c server.Conn) []string {
+	return nil
+}
+
+func (asciiSearch) Command(name string) server.HandlerFactory {
+	if name != "SEARCH" {
+		return nil
+	}
+	return func() server.Handler {
+		return &asciiSearchHandler{}
+	}
+}
+
+type asciiSearchHandler struct {
+	server.Search
+}
+
+func (cmd *asciiSearchHandler) check() error {
+	if cmd.Charset != "" && !strings.EqualFold(cmd.Charset, "US-ASCII") {
+		return &imap.ErrStatusResp{Resp: &imap.StatusResp{
+			Type:      imap.StatusRespNo,
+			Code:      imap.CodeBadCharset,
+			Arguments: []interface{}{"US-ASCII"},
+			Info:      "Unsupported charset",
+		}}
+	}
+	if !criteriaASCII(cmd.Criteria) {
+		return errors.New("Invalid characters in US-ASCII search")
+	}
+	return nil
+}
+
+func criteriaASCII(c *imap.SearchCriteria) bool {
+	for _, text := range append(c.Body, c.Text...) {
+		if !isASCII(text) {
+			return false
+		}
+	}
+	for _, not := range c.Not {
+		if !criteriaASCII(not) {
+			return false
+		}
+	}
+	for _, or := range c.Or {
+		if !criteriaASCII(or[0]) || !criteriaASCII(or[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cmd *asciiSearchHandler) Handle(conn server.Conn) error {
+	if err := cmd.check(); err != nil {
+		return err
+	}
+	return cmd.Search.Handle(conn)
+}
+
+func (cmd *asciiSearchHandler) UidHandle(conn server.Conn) error {
+	if err := cmd.check(); err != nil {
+		return err
+	}
+	return cmd.Search.UidHandle(conn)
+}
+
+func TestImap_SearchByContentBadCharset(t *testing.T) {
+	i := newTestImap(t, memory.New(), asciiSearch{})
+	appendTestMessages(t, i, "INBOX",
+		"Subject: greeting\nContent-Type: text/plain; charset=utf-8\nContent-Transfer-Encoding: base64\n\n"+
+			base64.StdEncoding.EncodeToString([]byte("你好，世界"))+"\n",
+		"Subject: hello\nContent-Type: text/plain\n\nhello world\n",
+		"Subject: other\nContent-Type: text/plain\n\nnothing here\n",
+	)
+
+	tests := []struct {
+		content string
+		titles  []string
+	}{
+		{"你好", []string{"greeting"}},
+		{"世界", []string{"greeting"}},
+		{"hello", []string{"hello"}},
+		{"再见", nil},
+	}
+
+	for _, test := range tests {
+		results, err := i.SearchByContentIn(context.Background(), "INBOX", test.content)
+		if err != nil {
+			t.Errorf("SearchByContentIn(%q) = %v", test.content, err)
+			continue
+		}
+		var titles []string
+		for _, result := range results {
+			titles = append(titles, result.Title)
+		}
+		if !reflect.DeepEqual(titles, test.titles) {
+			t.Errorf("SearchByContentIn(%q) = %q, want %q", test.content, titles, test.titles)
+		}
+	}
+}
+
+func TestImap_FetchRawByUid(t *testing.T) {
+	i := newTestImap(t, memory.New())
+	appendTestMessages(t, i, "INBOX", "Subject: raw\n\nhello\n")
+	const raw = "Subject: raw\r\n\r\nhello\r\n"
+	// memory后端中已有一封UID为6的邮件
+	const uid = 7
+
+	var buf bytes.Buffer
+	if err := i.FetchRawByUid(context.Background(), "INBOX", uid, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != raw {
+		t.Errorf("FetchRawByUid() wrote %q, want %q", buf.String(), raw)
+	}
+
+	buf.Reset()
+	if err := i.FetchRawByUid(context.Background(), "INBOX", uid+1, &buf); err == nil || buf.Len() > 0 {
+		t.Errorf("FetchRawByUid() of a missing message = %v, wrote %q", err, buf.String())
+	}
+	if err := i.FetchRawByUid(context.Background(), "Missing", uid, &buf); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("FetchRawByUid() in a missing mailbox = %v, want ErrMailboxNotFound", err)
+	}
+}
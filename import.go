@@ -0,0 +1,377 @@
+package zdpgo_imap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+	"github.com/zhangdapeng520/zdpgo_imap/message/mail"
+	"github.com/zhangdapeng520/zdpgo_imap/message/textproto"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : import.go
+@Software: Goland2021.3.1
+@Description: 将本地的EML文件、mbox文件或者Maildir目录导入到邮箱
+*/
+
+// ImportResult 一次导入的结果
+type ImportResult struct {
+	Mailbox    string `json:"mailbox"`
+	Format     string `json:"format"`
+	Src        string `json:"src"`
+	Created    bool   `json:"created"`    // 邮箱不存在，导入时创建了邮箱
+	Imported   int    `json:"imported"`   // 导入的邮件数量
+	Duplicates int    `json:"duplicates"` // Message-ID已经存在，跳过的邮件数量
+	TooLarge   int    `json:"too_large"`  // 超过服务器APPENDLIMIT，跳过的邮件数量
+}
+
+// importMessage 从本地读取的一封邮件
+type importMessage struct {
+	name     string    // 来源的文件名，用于日志
+	data     []byte    // 邮件内容，换行为CRLF
+	flags    []string  // Maildir文件名中的标志
+	fromDate time.Time // mbox的"From "行中的时间
+	modTime  time.Time // 文件的修改时间
+}
+
+// date 邮件在服务器上的到达时间：优先使用mbox的"From "行，其次是Date头，最后是文件的修改时间
+func (m *importMessage) date(h *mail.Header) time.Time {
+	if !m.fromDate.IsZero() {
+		return m.fromDate
+	}
+	if date, err := h.Date(); err == nil && !date.IsZero() {
+		return date
+	}
+	if !m.modTime.IsZero() {
+		return m.modTime
+	}
+	return time.Now()
+}
+
+// Import 将src中的邮件导入到mailbox，mailbox不存在时会自动创建
+// format为ExportFormatEML时src是包含.eml文件的目录或者一个.eml文件，为ExportFormatMbox时src是mbox文件，
+// 为ExportFormatMaildir时src是Maildir目录，文件名中的标志会转换为IMAP标志。
+// Message-ID已经存在于mailbox中的邮件会被跳过，超过服务器APPENDLIMIT的邮件也会被跳过
+func (i *Imap) Import(mailbox, format, src string) (*ImportResult, error) {
+	return i.ImportContext(context.Background(), mailbox, format, src)
+}
+
+// ImportContext 和Import相同，ctx结束时中止导入
+func (i *Imap) ImportContext(ctx context.Context, mailbox, format, src string) (*ImportResult, error) {
+	var walk func(src string, fn func(m *importMessage) error) error
+	switch format {
+	case ExportFormatEML:
+		walk = walkEML
+	case ExportFormatMbox:
+		walk = walkMbox
+	case ExportFormatMaildir:
+		walk = walkMaildir
+	default:
+		return nil, fmt.Errorf("unknown import format: %q", format)
+	}
+
+	result := &ImportResult{Mailbox: mailbox, Format: format, Src: src}
+	err := i.withClient(ctx, func(c *client.Client) error {
+		created, err := i.ensureMailbox(ctx, c, mailbox)
+		if err != nil {
+			return err
+		}
+		result.Created = created
+
+		limit := i.appendLimit(c, mailbox)
+		ids, err := i.messageIDs(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		return walk(src, func(m *importMessage) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if limit > 0 && uint32(len(m.data)) > limit {
+				i.Log.Warning("邮件超过服务器的APPENDLIMIT，跳过", "file", m.name, "size", len(m.data), "limit", limit)
+				result.TooLarge++
+				return nil
+			}
+
+			header := readImportHeader(m.data)
+			id, _ := header.MessageID()
+			if id != "" && ids[id] {
+				result.Duplicates++
+				return nil
+			}
+
+			literal := bytes.NewBuffer(m.data)
+			if err := c.AppendContext(ctx, mailbox, m.flags, m.date(header), literal); err != nil {
+				i.Log.Error("导入邮件失败", "error", err, "file", m.name)
+				return commandError(c, "APPEND "+mailbox, err)
+			}
+			if id != "" {
+				ids[id] = true
+			}
+			result.Imported++
+			return nil
+		})
+	})
+	return result, err
+}
+
+// ensureMailbox 以只读方式打开邮箱，邮箱不存在时先创建邮箱
+func (i *Imap) ensureMailbox(ctx context.Context, c *client.Client, mailbox string) (bool, error) {
+	_, err := i.selectMailbox(ctx, c, mailbox)
+	if err == nil || !errors.Is(err, ErrMailboxNotFound) {
+		return false, err
+	}
+
+	if err = c.Create(mailbox); err != nil {
+		i.Log.Error("创建邮箱失败", "error", err, "mailbox", mailbox)
+		return false, commandError(c, "CREATE "+mailbox, err)
+	}
+	_, err = i.selectMailbox(ctx, c, mailbox)
+	return true, err
+}
+
+// appendLimit 服务器允许APPEND的最大邮件大小，0表示没有限制
+// 优先使用APPENDLIMIT=能力中的值，否则通过STATUS查询邮箱的APPENDLIMIT，参考RFC 7889
+func (i *Imap) appendLimit(c *client.Client, mailbox string) uint32 {
+	caps, err := c.Capability()
+	if err != nil {
+		return 0
+	}
+
+	perMailbox := false
+	for name, ok := range caps {
+		if !ok {
+			continue
+		}
+		name = strings.ToUpper(name)
+		if strings.HasPrefix(name, "APPENDLIMIT=") {
+			limit, err := strconv.ParseUint(strings.TrimPrefix(name, "APPENDLIMIT="), 10, 32)
+			if err == nil {
+				return uint32(limit)
+			}
+		} else if name == "APPENDLIMIT" {
+			perMailbox = true
+		}
+	}
+	if !perMailbox {
+		return 0
+	}
+
+	status, err := c.Status(mailbox, []imap.StatusItem{imap.StatusAppendLimit})
+	if err != nil {
+		i.Log.Warning("查询邮箱的APPENDLIMIT失败", "error", err, "mailbox", mailbox)
+		return 0
+	}
+	return status.AppendLimit
+}
+
+// messageIDs 返回当前打开的邮箱中所有邮件的Message-ID
+func (i *Imap) messageIDs(ctx context.Context, c *client.Client) (map[string]bool, error) {
+	uids, err := c.UidSearchContext(ctx, imap.NewSearchCriteria())
+	if err != nil {
+		i.Log.Error("搜索邮件失败", "error", err)
+		return nil, commandError(c, "UID SEARCH", err)
+	}
+
+	section := &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{
+			Specifier: imap.HeaderSpecifier,
+			Fields:    []string{"Message-Id"},
+		},
+		Peek: true,
+	}
+	messages, err := i.fetchByUids(ctx, c, uids, []imap.FetchItem{section.FetchItem()})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		if h := messageHeader(msg); h != nil {
+			if id, err := h.MessageID(); err == nil && id != "" {
+				ids[id] = true
+			}
+		}
+	}
+	return ids, nil
+}
+
+// readImportHeader 解析邮件头，解析失败时返回空的邮件头
+func readImportHeader(data []byte) *mail.Header {
+	header := &mail.Header{}
+	h, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(data)))
+	if err == nil {
+		header.Header.Header = h
+	}
+	return header
+}
+
+// toCRLF 将换行统一为CRLF，IMAP要求邮件使用CRLF换行
+func toCRLF(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// readImportFile 读取一个邮件文件
+func readImportFile(path string) (*importMessage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &importMessage{name: path, data: toCRLF(data), modTime: info.ModTime()}, nil
+}
+
+// walkEML 依次读取src目录中的.eml文件，src也可以是一个.eml文件
+func walkEML(src string, fn func(m *importMessage) error) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	paths := []string{src}
+	if info.IsDir() {
+		if paths, err = filepath.Glob(filepath.Join(src, "*.eml")); err != nil {
+			return err
+		}
+		sort.Strings(paths)
+	}
+
+	for _, path := range paths {
+		m, err := readImportFile(path)
+		if err != nil {
+			return err
+		}
+		if err = fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkMaildir 依次读取Maildir中new和cur目录的邮件，文件名中":2,"之后的标志转换为IMAP标志
+func walkMaildir(src string, fn func(m *importMessage) error) error {
+	for _, sub := range []string{"new", "cur"} {
+		files, err := ioutil.ReadDir(filepath.Join(src, sub))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			m, err := readImportFile(filepath.Join(src, sub, file.Name()))
+			if err != nil {
+				return err
+			}
+			if parts := strings.SplitN(file.Name(), ":2,", 2); len(parts) == 2 {
+				m.flags = maildirFlagsOf(parts[1])
+			}
+			if err = fn(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// maildirFlagsOf 将Maildir文件名中的标志转换为IMAP标志
+func maildirFlagsOf(info string) []string {
+	var flags []string
+	for _, f := range maildirFlags {
+		if strings.IndexByte(info, f.char) >= 0 {
+			flags = append(flags, f.flag)
+		}
+	}
+	return flags
+}
+
+// walkMbox 依次读取mbox文件中的邮件
+// 按照mboxrd格式，去掉以">+From "开头的行的第一个">"，"From "行中的时间作为邮件的到达时间
+func walkMbox(src string, fn func(m *importMessage) error) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		m    *importMessage
+		buf  bytes.Buffer
+		prev []byte // 上一行，"From "行之前必须是空行
+	)
+	flush := func() error {
+		if m == nil {
+			return nil
+		}
+		// 去掉邮件之间的空行
+		data := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+		m.data = toCRLF(data)
+		buf.Reset()
+		return fn(m)
+	}
+
+	r := bufio.NewReader(f)
+	n := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			text := bytes.TrimRight(line, "\r\n")
+			if bytes.HasPrefix(text, []byte("From ")) && (m == nil || len(prev) == 0) {
+				if err := flush(); err != nil {
+					return err
+				}
+				n++
+				m = &importMessage{name: fmt.Sprintf("%s#%d", src, n), fromDate: mboxFromDate(string(text))}
+			} else if m != nil {
+				if bytes.HasPrefix(bytes.TrimLeft(text, ">"), []byte("From ")) && text[0] == '>' {
+					text = text[1:]
+				}
+				buf.Write(text)
+				buf.WriteByte('\n')
+			}
+			prev = text
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return flush()
+}
+
+// mboxFromDate 解析"From sender Mon Jan  2 15:04:05 2006"中的时间，失败时返回零值
+func mboxFromDate(line string) time.Time {
+	fields := strings.Fields(line)
+	if len(fields) < 7 {
+		return time.Time{}
+	}
+	date, err := time.Parse(time.ANSIC, strings.Join(fields[2:7], " "))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
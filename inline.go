@@ -0,0 +1,144 @@
+package zdpgo_imap
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/message"
+	"github.com/zhangdapeng520/zdpgo_imap/message/mail"
+)
+
+/*
+@Time : 2022/5/24 20:46
+@Author : 张大鹏
+@File : inline.go
+@Software: Goland2021.3.1
+@Description: 正文和内嵌内容的处理
+*/
+
+// cidRegexp 匹配HTML中的cid:引用，例如<img src="cid:image001@example.com">
+var cidRegexp = regexp.MustCompile(`(?i)cid:([^"'\s)>]+)`)
+
+// isUnknownCharset 判断是否是无法识别字符集的错误
+func isUnknownCharset(err error) bool {
+	return err != nil && message.IsUnknownCharset(err)
+}
+
+// joinBody 拼接同一种类型的多个正文
+func joinBody(body, part string) string {
+	if body == "" {
+		return part
+	}
+	return body + "\n" + part
+}
+
+// isInlinePart 判断附件是否是被正文引用的内嵌内容：没有文件名并且有Content-ID
+func isInlinePart(h *mail.AttachmentHeader, filename string) bool {
+	disp, _, _ := h.ContentDisposition()
+	return filename == "" && disp != "attachment" && h.Get("Content-Id") != ""
+}
+
+// addInlinePart 保存内嵌的内容，磁盘模式下保存到TmpDir，否则保存在内存中
+func (i *Imap) addInlinePart(result *Result, h partHeader, filename string, r io.Reader) error {
+	contentID := strings.Trim(h.Get("Content-Id"), "<> ")
+	contentType, params, _ := h.ContentType()
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	inline := &InlinePart{
+		ContentID:   contentID,
+		ContentType: contentType,
+		Filename:    filename,
+	}
+
+	if i.Config.AttachmentMode == AttachmentModeDisk {
+		name := filename
+		if name == "" {
+			name = contentID + inlineExtension(contentType)
+		}
+		file, err := i.saveAttachment(h, name, r)
+		if err != nil {
+			i.Log.Error("保存内嵌内容失败", "error", err, "contentID", contentID)
+			i.RemoveAttachments(result)
+			return err
+		}
+		inline.Path = file.Path
+		inline.Size = file.Size
+	} else {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			i.Log.Warning("读取内嵌内容失败", "error", err, "contentID", contentID)
+		}
+		inline.Data = data
+		inline.Size = int64(len(data))
+	}
+
+	result.InlineParts = append(result.InlineParts, inline)
+	return nil
+}
+
+// inlineExtension 根据内容类型获取文件扩展名
+func inlineExtension(contentType string) string {
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// InlinePart 根据Content-ID查找内嵌的内容，不区分大小写
+func (r *Result) InlinePart(contentID string) *InlinePart {
+	contentID = strings.Trim(contentID, "<> ")
+	for _, part := range r.InlineParts {
+		if strings.EqualFold(part.ContentID, contentID) {
+			return part
+		}
+	}
+	return nil
+}
+
+// RewriteCID 将HTMLBody中的cid:引用替换为replace的返回值
+// replace返回空字符串时保留原来的引用，找不到对应内嵌内容的引用也保持不变
+func (r *Result) RewriteCID(replace func(part *InlinePart) string) string {
+	return cidRegexp.ReplaceAllStringFunc(r.HTMLBody, func(ref string) string {
+		contentID := ref[len("cid:"):]
+		if unescaped, err := url.PathUnescape(contentID); err == nil {
+			contentID = unescaped
+		}
+
+		part := r.InlinePart(contentID)
+		if part == nil {
+			return ref
+		}
+		if s := replace(part); s != "" {
+			return s
+		}
+		return ref
+	})
+}
+
+// HTMLWithDataURIs 将HTMLBody中的cid:引用替换为data URI，可以直接在浏览器中显示
+func (r *Result) HTMLWithDataURIs() string {
+	return r.RewriteCID(func(part *InlinePart) string {
+		data := part.Data
+		if data == nil && part.Path != "" {
+			var err error
+			if data, err = ioutil.ReadFile(part.Path); err != nil {
+				return ""
+			}
+		}
+		return "data:" + part.ContentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	})
+}
+
+// HTMLWithFilePaths 将HTMLBody中的cid:引用替换为磁盘模式下保存的文件路径
+func (r *Result) HTMLWithFilePaths() string {
+	return r.RewriteCID(func(part *InlinePart) string {
+		return part.Path
+	})
+}
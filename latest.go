@@ -0,0 +1,85 @@
+package zdpgo_imap
+
+import (
+	"context"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : latest.go
+@Software: Goland2021.3.1
+@Description: 按发送时间获取最新的邮件，服务器支持SORT时由服务器排序
+*/
+
+// latestSortCriteria 按发送时间从新到旧排序，时间相同时按到达时间排序
+var latestSortCriteria = []imap.SortCriterion{
+	{Field: imap.SortDate, Reverse: true},
+	{Field: imap.SortArrival, Reverse: true},
+}
+
+// SearchLatest 在mailbox匹配的每个邮箱中搜索满足criteria的邮件，返回按发送时间最新的limit封，只获取邮件头、标志和大小等信息
+// 服务器支持SORT时使用UID SORT (REVERSE DATE)，否则按UID从大到小排序。criteria为nil时搜索所有的邮件，limit为0时不限制数量
+func (i *Imap) SearchLatest(ctx context.Context, mailbox string, criteria *imap.SearchCriteria, limit int) ([]*Result, error) {
+	if criteria == nil {
+		criteria = imap.NewSearchCriteria()
+	}
+	return i.searchMailboxes(ctx, mailbox, func(c *client.Client, name string) ([]*Result, error) {
+		return i.searchLatest(ctx, c, name, criteria, limit)
+	})
+}
+
+func (i *Imap) searchLatest(ctx context.Context, c *client.Client, mailbox string, criteria *imap.SearchCriteria, limit int) ([]*Result, error) {
+	if _, err := i.selectMailbox(ctx, c, mailbox); err != nil {
+		return nil, err
+	}
+
+	uids, err := i.sortedUids(ctx, c, criteria)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	infos, err := i.fetchByUids(ctx, c, uids, i.infoItems())
+	if err != nil {
+		i.Log.Error("抓取邮件信息失败", "error", err)
+		return nil, err
+	}
+
+	var results []*Result
+	for _, uid := range uids {
+		if message, ok := infos[uid]; ok {
+			results = append(results, i.GetBasicResult(message))
+		}
+	}
+	return results, nil
+}
+
+// sortedUids 返回当前邮箱中满足criteria的邮件的UID，按发送时间从新到旧排序
+func (i *Imap) sortedUids(ctx context.Context, c *client.Client, criteria *imap.SearchCriteria) ([]uint32, error) {
+	ok, err := c.Support("SORT")
+	if err != nil {
+		return nil, commandError(c, "CAPABILITY", err)
+	}
+	if ok {
+		uids, err := c.UidSortContext(ctx, latestSortCriteria, criteria)
+		if err != nil {
+			i.Log.Error("排序邮件失败", "error", err)
+			return nil, commandError(c, "UID SORT", err)
+		}
+		return uids, nil
+	}
+
+	uids, err := c.UidSearchContext(ctx, criteria)
+	if err != nil {
+		i.Log.Error("搜索邮件失败", "error", err)
+		return nil, commandError(c, "UID SEARCH", err)
+	}
+	sortUidsDesc(uids)
+	return uids, nil
+}
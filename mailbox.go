@@ -0,0 +1,161 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:07
+@Author : 张大鹏
+@File : mailbox.go
+@Software: Goland2021.3.1
+@Description: 解析和遍历邮箱
+*/
+
+// ListMailboxes 列出pattern匹配的所有可以打开的邮箱名称
+// pattern可以是邮箱名称，也可以是包含通配符*和%的LIST模式
+func (i *Imap) ListMailboxes(ctx context.Context, pattern string) ([]string, error) {
+	var names []string
+	err := i.withClientRetry(ctx, func(c *client.Client) (err error) {
+		names, err = i.resolveMailboxes(c, pattern)
+		return err
+	})
+	return names, err
+}
+
+// MailboxStatus 使用STATUS获取邮箱的状态，不会打开邮箱，items为空时获取邮件数量、未读邮件数量和UIDNEXT
+func (i *Imap) MailboxStatus(ctx context.Context, mailbox string, items ...imap.StatusItem) (*imap.MailboxStatus, error) {
+	if len(items) == 0 {
+		items = []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen, imap.StatusUidNext}
+	}
+
+	var status *imap.MailboxStatus
+	err := i.withClientRetry(ctx, func(c *client.Client) (err error) {
+		if status, err = c.StatusContext(ctx, mailbox, items); err != nil {
+			return i.openMailboxError(c, "STATUS "+mailbox, mailbox, err)
+		}
+		return nil
+	})
+	return status, err
+}
+
+// resolveMailboxes 使用LIST命令将pattern解析为邮箱名称，跳过不能打开(\Noselect)的邮箱
+func (i *Imap) resolveMailboxes(c *client.Client, pattern string) ([]string, error) {
+	if pattern == "" {
+		pattern = imap.InboxName
+	}
+	if !strings.ContainsAny(pattern, "*%") {
+		return []string{pattern}, nil
+	}
+
+	ch := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", pattern, ch)
+	}()
+
+	var names []string
+	for info := range ch {
+		if hasAttr(info.Attributes, imap.NoSelectAttr) {
+			continue
+		}
+		names = append(names, info.Name)
+	}
+	if err := <-done; err != nil {
+		i.Log.Error("列出邮箱失败", "error", err, "pattern", pattern)
+		return nil, commandError(c, "LIST "+pattern, err)
+	}
+	if len(names) == 0 {
+		return nil, newError(ErrMailboxNotFound, "LIST "+pattern, fmt.Errorf("no mailbox matches %q", pattern))
+	}
+	return names, nil
+}
+
+// selectMailbox 以只读方式(EXAMINE)打开邮箱，服务器返回NO时为ErrMailboxNotFound错误
+func (i *Imap) selectMailbox(ctx context.Context, c *client.Client, mailbox string) (*imap.MailboxStatus, error) {
+	return i.openMailbox(ctx, c, mailbox, true)
+}
+
+// openMailbox 打开邮箱，readOnly为false时使用SELECT，可以修改邮件的标志和删除邮件
+func (i *Imap) openMailbox(ctx context.Context, c *client.Client, mailbox string, readOnly bool) (*imap.MailboxStatus, error) {
+	op := "SELECT " + mailbox
+	if readOnly {
+		op = "EXAMINE " + mailbox
+	}
+
+	mbox, err := c.SelectContext(ctx, mailbox, readOnly)
+	if err != nil {
+		return nil, i.openMailboxError(c, op, mailbox, err)
+	}
+	return mbox, nil
+}
+
+// examineCondStore 以只读方式打开邮箱并启用CONDSTORE，返回的状态中包含HIGHESTMODSEQ
+// 服务器不支持CONDSTORE时和selectMailbox相同
+func (i *Imap) examineCondStore(ctx context.Context, c *client.Client, mailbox string) (*imap.MailboxStatus, error) {
+	if ok, _ := c.Support("CONDSTORE"); !ok {
+		return i.selectMailbox(ctx, c, mailbox)
+	}
+
+	mbox, err := c.SelectCondStore(ctx, mailbox, true)
+	if err != nil {
+		return nil, i.openMailboxError(c, "EXAMINE "+mailbox, mailbox, err)
+	}
+	return mbox, nil
+}
+
+// openMailboxError 将打开邮箱的错误转换为Error，服务器返回NO时为ErrMailboxNotFound错误
+func (i *Imap) openMailboxError(c *client.Client, op, mailbox string, err error) error {
+	i.Log.Error("打开邮箱失败", "error", err, "mailbox", mailbox)
+
+	var statusErr *imap.ErrStatusResp
+	if errors.As(err, &statusErr) && statusErr.Resp.Type == imap.StatusRespNo {
+		return newError(ErrMailboxNotFound, op, err)
+	}
+	return commandError(c, op, err)
+}
+
+// searchMailboxes 在pattern匹配的每个邮箱中执行search，并记录结果所在的邮箱
+func (i *Imap) searchMailboxes(ctx context.Context, pattern string, search func(c *client.Client, mailbox string) ([]*Result, error)) ([]*Result, error) {
+	var results []*Result
+	err := i.withClientRetry(ctx, func(c *client.Client) error {
+		results = nil
+
+		mailboxes, err := i.resolveMailboxes(c, pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, mailbox := range mailboxes {
+			found, err := search(c, mailbox)
+			if err != nil {
+				// 删除之前的邮箱的结果已经保存到临时目录的附件
+				i.RemoveAttachments(results...)
+				results = nil
+				return err
+			}
+			for _, result := range found {
+				result.Mailbox = mailbox
+			}
+			results = append(results, found...)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// hasAttr 判断邮箱属性中是否包含attr，属性不区分大小写
+func hasAttr(attrs []string, attr string) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend/memory"
+)
+
+func TestImap_MailboxStatus(t *testing.T) {
+	i := newTestImap(t, memory.New())
+	appendTestMessages(t, i, "INBOX", "Subject: a\n\na\n", "Subject: b\n\nb\n")
+
+	// memory后端中已有一封邮件，它没有实现STATUS UNSEEN，所以只检查邮件数和UIDNEXT
+	status, err := i.MailboxStatus(context.Background(), "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Messages != 3 || status.UidNext != 9 {
+		t.Errorf("MailboxStatus() = %d messages, UIDNEXT %d, want 3, 9", status.Messages, status.UidNext)
+	}
+
+	if _, err = i.MailboxStatus(context.Background(), "Missing"); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("MailboxStatus(Missing) = %v, want ErrMailboxNotFound", err)
+	}
+}
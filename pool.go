@@ -0,0 +1,219 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/commands"
+)
+
+/*
+@Time : 2022/5/24 20:07
+@Author : 张大鹏
+@File : pool.go
+@Software: Goland2021.3.1
+@Description: 已登录的IMAP会话池
+*/
+
+// Pool 已登录的IMAP会话池，按照账号区分会话，可以被多个goroutine同时使用
+type Pool struct {
+	MaxConns      int           // 每个账号最多同时打开的连接数量
+	CheckInterval time.Duration // 空闲超过该时间的会话在复用前先使用NOOP检查是否可用
+
+	locker   sync.Mutex
+	accounts map[string]*accountPool
+	closed   bool
+}
+
+// accountPool 一个账号的会话
+type accountPool struct {
+	sem  chan struct{} // 正在使用的会话，容量为MaxConns
+	idle []*session    // 空闲的会话
+}
+
+type session struct {
+	client   *client.Client
+	lastUsed time.Time
+}
+
+// NewPool 创建会话池，maxConns为每个账号最多同时打开的连接数量
+func NewPool(maxConns int) *Pool {
+	if maxConns <= 0 {
+		maxConns = 1
+	}
+	return &Pool{
+		MaxConns:      maxConns,
+		CheckInterval: 30 * time.Second,
+		accounts:      make(map[string]*accountPool),
+	}
+}
+
+// account 获取账号对应的会话，不存在时创建
+func (p *Pool) account(key string) *accountPool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	a, ok := p.accounts[key]
+	if !ok {
+		a = &accountPool{sem: make(chan struct{}, p.MaxConns)}
+		p.accounts[key] = a
+	}
+	return a
+}
+
+// Get 获取账号key的一个已登录会话，没有空闲会话时使用dial创建新的会话
+// 已经达到最大连接数量时，等待其他goroutine归还会话或者ctx结束。使用完毕后必须调用Put归还会话
+func (p *Pool) Get(ctx context.Context, key string, dial func(ctx context.Context) (*client.Client, error)) (*client.Client, error) {
+	a := p.account(key)
+
+	select {
+	case a.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		p.locker.Lock()
+		if p.closed {
+			p.locker.Unlock()
+			<-a.sem
+			return nil, newError(ErrConnection, "", fmt.Errorf("pool closed"))
+		}
+		if len(a.idle) == 0 {
+			p.locker.Unlock()
+			break
+		}
+		s := a.idle[len(a.idle)-1]
+		a.idle = a.idle[:len(a.idle)-1]
+		p.locker.Unlock()
+
+		if p.healthy(ctx, s) {
+			return s.client, nil
+		}
+		closeClient(s.client)
+	}
+
+	c, err := dial(ctx)
+	if err != nil {
+		if c != nil {
+			closeClient(c)
+		}
+		<-a.sem
+		return nil, err
+	}
+	return c, nil
+}
+
+// Put 归还账号key的会话，已经断开(例如收到了服务器的BYE)的会话会被丢弃
+func (p *Pool) Put(key string, c *client.Client) {
+	a := p.account(key)
+	defer func() { <-a.sem }()
+
+	p.locker.Lock()
+	if p.closed || c.State() == imap.LogoutState {
+		p.locker.Unlock()
+		closeClient(c)
+		return
+	}
+	a.idle = append(a.idle, &session{client: c, lastUsed: time.Now()})
+	p.locker.Unlock()
+}
+
+// Close 注销所有空闲的会话，正在使用的会话在归还时注销
+func (p *Pool) Close() error {
+	p.locker.Lock()
+	p.closed = true
+	var sessions []*session
+	for _, a := range p.accounts {
+		sessions = append(sessions, a.idle...)
+		a.idle = nil
+	}
+	p.locker.Unlock()
+
+	for _, s := range sessions {
+		closeClient(s.client)
+	}
+	return nil
+}
+
+// healthy 检查会话是否可用，最近使用过的会话不需要发送NOOP
+func (p *Pool) healthy(ctx context.Context, s *session) bool {
+	select {
+	case <-s.client.LoggedOut():
+		return false
+	default:
+	}
+	if s.client.State() == imap.LogoutState {
+		return false
+	}
+	if time.Since(s.lastUsed) < p.CheckInterval {
+		return true
+	}
+	return noop(ctx, s.client) == nil
+}
+
+// noop 发送NOOP命令，ctx结束时中止
+func noop(ctx context.Context, c *client.Client) error {
+	status, err := c.ExecuteContext(ctx, &commands.Noop{}, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// closeClient 注销并关闭会话
+func closeClient(c *client.Client) {
+	if c.State() != imap.LogoutState {
+		if err := c.Logout(); err == nil {
+			return
+		}
+	}
+	c.Terminate()
+}
+
+// accountKey 会话池中区分账号的键
+func (i *Imap) accountKey() string {
+	return fmt.Sprintf("%s@%s:%d", i.Config.Username, i.Config.Host, i.Config.Port)
+}
+
+// withClient 从会话池获取会话执行fn，执行完毕后归还会话
+// 连接断开时不会重新执行fn，因为无法知道fn中的命令是否已经被服务器执行，用于会修改邮箱的操作
+func (i *Imap) withClient(ctx context.Context, fn func(c *client.Client) error) error {
+	return i.runClient(ctx, false, fn)
+}
+
+// withClientRetry 和withClient相同，但是执行过程中连接被服务器断开(例如收到了BYE)时，重新连接后再执行一次
+// fn必须可以安全地重复执行，例如只读取邮箱的操作
+func (i *Imap) withClientRetry(ctx context.Context, fn func(c *client.Client) error) error {
+	return i.runClient(ctx, true, fn)
+}
+
+// runClient 从会话池获取会话执行fn，retry为true时连接断开后重新执行一次
+func (i *Imap) runClient(ctx context.Context, retry bool, fn func(c *client.Client) error) error {
+	key := i.accountKey()
+	for attempt := 0; ; attempt++ {
+		c, err := i.Pool.Get(ctx, key, i.dial)
+		if err != nil {
+			i.Log.Error("获取IMAP会话失败", "error", err)
+			return err
+		}
+
+		err = commandError(c, "", fn(c))
+		broken := c.State() == imap.LogoutState
+		i.Pool.Put(key, c)
+
+		if err == nil || !broken || !retry || ctx.Err() != nil || attempt > 0 {
+			return err
+		}
+		i.Log.Warning("IMAP连接已断开，重新连接", "error", err)
+	}
+}
+
+// Close 关闭会话池中的所有会话
+func (i *Imap) Close() error {
+	return i.Pool.Close()
+}
@@ -0,0 +1,722 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : query.go
+@Software: Goland2021.3.1
+@Description: 查询语句，和imap.SearchCriteria互相转换
+
+查询语句由空格分隔的条件组成，所有条件都要满足，例如：
+	from:alice subject:"周报" since:2022-05-01 -is:seen larger:1M (to:bob OR cc:bob)
+
+条件：
+	from: to: cc: bcc: subject:   邮件头包含指定的内容
+	header:名称:内容               任意邮件头包含指定的内容，例如header:X-Priority:1
+	body:                         邮件正文包含指定的内容
+	text: 或者不带前缀的内容        邮件头或者正文包含指定的内容
+	is:                           seen(read)、unseen(unread)、flagged(starred)、unflagged、
+	                              answered(replied)、unanswered、deleted、undeleted、draft、recent
+	keyword:                      邮件有指定的标志，例如keyword:$Forwarded
+	since: before: on:            到达时间，格式为2006-01-02、2006/01/02或者2-Jan-2006
+	sentsince: sentbefore: senton: Date邮件头中的时间
+	newer_than: older_than:       到达时间在指定的时间之内或者之前，例如7d、12h
+	larger: smaller:              邮件大小，可以使用K、M、G后缀，例如1M
+	uid: seq:                     UID或者序号，例如uid:1:100,200
+	modseq:                       MODSEQ不小于指定的值，服务器需要支持CONDSTORE
+组合：
+	-条件 或者 NOT 条件            不满足条件
+	条件 OR 条件                   满足其中一个，OR比空格的优先级高，"a b OR c"等价于"a (b OR c)"
+	(条件 ...)                     分组
+内容中有空格、括号、引号或者冒号时使用双引号，引号内使用\"和\\转义
+*/
+
+// QueryError 查询语句的语法错误，Pos是出错的位置，按字符从0开始计算
+type QueryError struct {
+	Query string
+	Pos   int
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("imap: query: %s at position %d", e.Msg, e.Pos)
+}
+
+// queryFlags is:后面的名称对应的标志，negative表示邮件没有这个标志
+var queryFlags = map[string]struct {
+	flag     string
+	negative bool
+}{
+	"seen":       {imap.SeenFlag, false},
+	"read":       {imap.SeenFlag, false},
+	"unseen":     {imap.SeenFlag, true},
+	"unread":     {imap.SeenFlag, true},
+	"flagged":    {imap.FlaggedFlag, false},
+	"starred":    {imap.FlaggedFlag, false},
+	"unflagged":  {imap.FlaggedFlag, true},
+	"unstarred":  {imap.FlaggedFlag, true},
+	"answered":   {imap.AnsweredFlag, false},
+	"replied":    {imap.AnsweredFlag, false},
+	"unanswered": {imap.AnsweredFlag, true},
+	"deleted":    {imap.DeletedFlag, false},
+	"undeleted":  {imap.DeletedFlag, true},
+	"draft":      {imap.DraftFlag, false},
+	"recent":     {imap.RecentFlag, false},
+}
+
+// queryFlagNames 格式化时标志对应的is:名称
+var queryFlagNames = map[string]string{
+	imap.SeenFlag:     "seen",
+	imap.FlaggedFlag:  "flagged",
+	imap.AnsweredFlag: "answered",
+	imap.DeletedFlag:  "deleted",
+	imap.DraftFlag:    "draft",
+	imap.RecentFlag:   "recent",
+}
+
+// queryHeaders 可以直接作为条件名称的邮件头
+var queryHeaders = map[string]string{
+	"from":    "From",
+	"to":      "To",
+	"cc":      "Cc",
+	"bcc":     "Bcc",
+	"subject": "Subject",
+}
+
+// queryDateLayouts 支持的日期格式
+var queryDateLayouts = []string{"2006-01-02", "2006/01/02", imap.DateLayout}
+
+const (
+	queryWord = iota
+	queryLParen
+	queryRParen
+	queryNot
+	queryOr
+	queryAnd
+	queryEOF
+)
+
+// queryToken 词法分析得到的一个单元
+type queryToken struct {
+	kind   int
+	pos    int
+	key    string // 小写的条件名称，没有前缀的内容为空
+	value  string
+	quoted bool
+}
+
+// queryParser 查询语句的解析器
+type queryParser struct {
+	query  string
+	runes  []rune
+	tokens []*queryToken
+	next   int
+	now    time.Time
+}
+
+// ParseQuery 将查询语句解析为imap.SearchCriteria，空的查询语句匹配所有邮件
+func ParseQuery(query string) (*imap.SearchCriteria, error) {
+	p := &queryParser{query: query, runes: []rune(query), now: time.Now()}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+
+	criteria, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != queryEOF {
+		return nil, p.errorf(tok.pos, "unexpected %q", p.text(tok))
+	}
+	return criteria, nil
+}
+
+// SearchQuery 使用查询语句搜索mailbox中的邮件，只获取邮件头、标志和大小等信息
+func (i *Imap) SearchQuery(ctx context.Context, mailbox, query string) ([]*Result, error) {
+	criteria, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return i.SearchHeaders(ctx, mailbox, criteria)
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...interface{}) error {
+	return &QueryError{Query: p.query, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// text 用于错误信息的原始内容
+func (p *queryParser) text(tok *queryToken) string {
+	switch tok.kind {
+	case queryLParen:
+		return "("
+	case queryRParen:
+		return ")"
+	case queryEOF:
+		return ""
+	}
+	end := tok.pos
+	for end < len(p.runes) && !isQuerySpace(p.runes[end]) && p.runes[end] != '(' && p.runes[end] != ')' {
+		end++
+	}
+	return string(p.runes[tok.pos:end])
+}
+
+func isQuerySpace(r rune) bool {
+	return unicode.IsSpace(r)
+}
+
+// isQueryKeyRune 条件名称中可以使用的字符
+func isQueryKeyRune(r rune) bool {
+	return r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// lex 将查询语句分割为单元
+func (p *queryParser) lex() error {
+	runes := p.runes
+	pos := 0
+	for {
+		for pos < len(runes) && isQuerySpace(runes[pos]) {
+			pos++
+		}
+		if pos >= len(runes) {
+			p.tokens = append(p.tokens, &queryToken{kind: queryEOF, pos: pos})
+			return nil
+		}
+
+		switch r := runes[pos]; {
+		case r == '(':
+			p.tokens = append(p.tokens, &queryToken{kind: queryLParen, pos: pos})
+			pos++
+			continue
+		case r == ')':
+			p.tokens = append(p.tokens, &queryToken{kind: queryRParen, pos: pos})
+			pos++
+			continue
+		case r == '-':
+			if pos+1 >= len(runes) || isQuerySpace(runes[pos+1]) || runes[pos+1] == ')' {
+				return p.errorf(pos, "missing search term after -")
+			}
+			p.tokens = append(p.tokens, &queryToken{kind: queryNot, pos: pos})
+			pos++
+			continue
+		}
+
+		tok := &queryToken{kind: queryWord, pos: pos}
+		start := pos
+		for pos < len(runes) && isQueryKeyRune(runes[pos]) {
+			pos++
+		}
+		if pos > start && pos < len(runes) && runes[pos] == ':' {
+			tok.key = strings.ToLower(string(runes[start:pos]))
+			pos++
+		} else {
+			pos = start
+		}
+
+		value, end, quoted, err := p.lexValue(pos)
+		if err != nil {
+			return err
+		}
+		tok.value, tok.quoted = value, quoted
+		pos = end
+
+		if tok.key == "" && !quoted {
+			switch value {
+			case "OR":
+				tok.kind = queryOr
+			case "AND":
+				tok.kind = queryAnd
+			case "NOT":
+				tok.kind = queryNot
+			}
+		}
+		p.tokens = append(p.tokens, tok)
+	}
+}
+
+// lexValue 读取从pos开始的内容，内容以空白字符或者括号结束，双引号中的内容可以包含这些字符
+func (p *queryParser) lexValue(pos int) (string, int, bool, error) {
+	runes := p.runes
+	if pos < len(runes) && runes[pos] == '"' {
+		var b strings.Builder
+		start := pos
+		pos++
+		for {
+			if pos >= len(runes) {
+				return "", 0, false, p.errorf(start, "unterminated quoted string")
+			}
+			r := runes[pos]
+			pos++
+			if r == '"' {
+				break
+			}
+			if r == '\\' && pos < len(runes) {
+				r = runes[pos]
+				pos++
+			}
+			b.WriteRune(r)
+		}
+		if pos < len(runes) && !isQuerySpace(runes[pos]) && runes[pos] != '(' && runes[pos] != ')' {
+			return "", 0, false, p.errorf(pos, "missing space after quoted string")
+		}
+		return b.String(), pos, true, nil
+	}
+
+	start := pos
+	for pos < len(runes) && !isQuerySpace(runes[pos]) && runes[pos] != '(' && runes[pos] != ')' {
+		if runes[pos] == '"' {
+			return "", 0, false, p.errorf(pos, "unexpected quote")
+		}
+		pos++
+	}
+	return string(runes[start:pos]), pos, false, nil
+}
+
+func (p *queryParser) peek() *queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) pop() *queryToken {
+	tok := p.tokens[p.next]
+	if tok.kind != queryEOF {
+		p.next++
+	}
+	return tok
+}
+
+// parseAnd 解析空格分隔的条件，直到查询语句或者分组结束
+func (p *queryParser) parseAnd() (*imap.SearchCriteria, error) {
+	criteria := imap.NewSearchCriteria()
+	for {
+		switch tok := p.peek(); tok.kind {
+		case queryEOF, queryRParen:
+			return criteria, nil
+		case queryAnd:
+			p.pop()
+			continue
+		case queryOr:
+			return nil, p.errorf(tok.pos, "missing search term before OR")
+		}
+
+		sub, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		mergeCriteria(criteria, sub)
+	}
+}
+
+// parseOr 解析"条件 OR 条件 ..."
+func (p *queryParser) parseOr() (*imap.SearchCriteria, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == queryOr {
+		p.pop()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		or := imap.NewSearchCriteria()
+		or.Or = append(or.Or, [2]*imap.SearchCriteria{left, right})
+		left = or
+	}
+	return left, nil
+}
+
+// parseUnary 解析一个条件或者分组，前面可以有-或者NOT
+func (p *queryParser) parseUnary() (*imap.SearchCriteria, error) {
+	tok := p.pop()
+	switch tok.kind {
+	case queryNot:
+		sub, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negateCriteria(sub), nil
+	case queryLParen:
+		sub, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if p.pop().kind != queryRParen {
+			return nil, p.errorf(tok.pos, "missing )")
+		}
+		return sub, nil
+	case queryWord:
+		return p.parseTerm(tok)
+	case queryEOF:
+		return nil, p.errorf(tok.pos, "missing search term at end of query")
+	default:
+		return nil, p.errorf(tok.pos, "unexpected %q", p.text(tok))
+	}
+}
+
+// parseTerm 将一个条件转换为SearchCriteria
+func (p *queryParser) parseTerm(tok *queryToken) (*imap.SearchCriteria, error) {
+	criteria := imap.NewSearchCriteria()
+	if tok.key == "" {
+		criteria.Text = append(criteria.Text, tok.value)
+		return criteria, nil
+	}
+
+	// 条件名称之后的位置，用于内容错误的提示
+	valuePos := tok.pos + len([]rune(tok.key)) + 1
+	if tok.value == "" && !tok.quoted {
+		return nil, p.errorf(valuePos, "missing value for %s:", tok.key)
+	}
+
+	switch key := tok.key; key {
+	case "from", "to", "cc", "bcc", "subject":
+		criteria.Header.Add(queryHeaders[key], tok.value)
+	case "header":
+		parts := strings.SplitN(tok.value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, p.errorf(valuePos, "header: requires name:value")
+		}
+		criteria.Header.Add(parts[0], parts[1])
+	case "body":
+		criteria.Body = append(criteria.Body, tok.value)
+	case "text":
+		criteria.Text = append(criteria.Text, tok.value)
+	case "is":
+		f, ok := queryFlags[strings.ToLower(tok.value)]
+		if !ok {
+			return nil, p.errorf(valuePos, "unknown is: value %q", tok.value)
+		}
+		if f.negative {
+			criteria.WithoutFlags = append(criteria.WithoutFlags, f.flag)
+		} else {
+			criteria.WithFlags = append(criteria.WithFlags, f.flag)
+		}
+	case "keyword":
+		criteria.WithFlags = append(criteria.WithFlags, imap.CanonicalFlag(tok.value))
+	case "since", "before", "on", "sentsince", "sentbefore", "senton":
+		date, ok := parseQueryDate(tok.value)
+		if !ok {
+			return nil, p.errorf(valuePos, "invalid date %q, expected 2006-01-02", tok.value)
+		}
+		switch key {
+		case "since":
+			criteria.Since = date
+		case "before":
+			criteria.Before = date
+		case "on":
+			criteria.Since, criteria.Before = date, date.AddDate(0, 0, 1)
+		case "sentsince":
+			criteria.SentSince = date
+		case "sentbefore":
+			criteria.SentBefore = date
+		case "senton":
+			criteria.SentSince, criteria.SentBefore = date, date.AddDate(0, 0, 1)
+		}
+	case "newer_than", "older_than":
+		age, err := parseAge(tok.value)
+		if err != nil || age <= 0 {
+			return nil, p.errorf(valuePos, "invalid duration %q, expected e.g. 7d", tok.value)
+		}
+		date := p.now.Add(-age)
+		date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+		if key == "newer_than" {
+			criteria.Since = date
+		} else {
+			criteria.Before = date
+		}
+	case "larger", "smaller":
+		size, ok := parseQuerySize(tok.value)
+		if !ok {
+			return nil, p.errorf(valuePos, "invalid size %q, expected e.g. 1M", tok.value)
+		}
+		if key == "larger" {
+			criteria.Larger = size
+		} else {
+			criteria.Smaller = size
+		}
+	case "modseq":
+		modSeq, err := strconv.ParseUint(tok.value, 10, 64)
+		if err != nil || modSeq == 0 {
+			return nil, p.errorf(valuePos, "invalid mod-sequence %q", tok.value)
+		}
+		criteria.ModSeq = modSeq
+	case "uid", "seq":
+		set, err := imap.ParseSeqSet(tok.value)
+		if err != nil {
+			return nil, p.errorf(valuePos, "invalid sequence set %q", tok.value)
+		}
+		if key == "uid" {
+			criteria.Uid = set
+		} else {
+			criteria.SeqNum = set
+		}
+	default:
+		return nil, p.errorf(tok.pos, "unknown search key %q", tok.key+":")
+	}
+	return criteria, nil
+}
+
+// parseQueryDate 解析日期，时间按UTC计算
+func parseQueryDate(s string) (time.Time, bool) {
+	for _, layout := range queryDateLayouts {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseQuerySize 解析大小，K、M、G分别表示1024、1024*1024、1024*1024*1024字节
+func parseQuerySize(s string) (uint32, bool) {
+	s = strings.TrimSuffix(strings.ToUpper(s), "B")
+	unit := uint64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n*unit > 1<<32-1 {
+		return 0, false
+	}
+	return uint32(n * unit), true
+}
+
+// negateCriteria 对条件取反，只有一个标志的条件直接转换为WithFlags和WithoutFlags
+func negateCriteria(c *imap.SearchCriteria) *imap.SearchCriteria {
+	negated := imap.NewSearchCriteria()
+	only := *c
+	only.WithFlags, only.WithoutFlags = nil, nil
+	if isEmptyCriteria(&only) && len(c.WithFlags)+len(c.WithoutFlags) == 1 {
+		negated.WithFlags = append(negated.WithFlags, c.WithoutFlags...)
+		negated.WithoutFlags = append(negated.WithoutFlags, c.WithFlags...)
+		return negated
+	}
+	negated.Not = append(negated.Not, c)
+	return negated
+}
+
+// isEmptyCriteria 条件是否匹配所有邮件
+func isEmptyCriteria(c *imap.SearchCriteria) bool {
+	return c.SeqNum == nil && c.Uid == nil &&
+		c.Since.IsZero() && c.Before.IsZero() && c.SentSince.IsZero() && c.SentBefore.IsZero() &&
+		len(c.Header) == 0 && len(c.Body) == 0 && len(c.Text) == 0 &&
+		len(c.WithFlags) == 0 && len(c.WithoutFlags) == 0 &&
+		c.Larger == 0 && c.Smaller == 0 && c.ModSeq == 0 && len(c.Not) == 0 && len(c.Or) == 0
+}
+
+// mergeCriteria 将src合并到dst，合并后的条件要求同时满足dst和src
+func mergeCriteria(dst, src *imap.SearchCriteria) {
+	for key, values := range src.Header {
+		for _, value := range values {
+			dst.Header.Add(key, value)
+		}
+	}
+	dst.Body = append(dst.Body, src.Body...)
+	dst.Text = append(dst.Text, src.Text...)
+	dst.WithFlags = append(dst.WithFlags, src.WithFlags...)
+	dst.WithoutFlags = append(dst.WithoutFlags, src.WithoutFlags...)
+	dst.Not = append(dst.Not, src.Not...)
+	dst.Or = append(dst.Or, src.Or...)
+
+	// 时间和大小取范围的交集
+	if src.Since.After(dst.Since) {
+		dst.Since = src.Since
+	}
+	if !src.Before.IsZero() && (dst.Before.IsZero() || src.Before.Before(dst.Before)) {
+		dst.Before = src.Before
+	}
+	if src.SentSince.After(dst.SentSince) {
+		dst.SentSince = src.SentSince
+	}
+	if !src.SentBefore.IsZero() && (dst.SentBefore.IsZero() || src.SentBefore.Before(dst.SentBefore)) {
+		dst.SentBefore = src.SentBefore
+	}
+	if src.Larger > dst.Larger {
+		dst.Larger = src.Larger
+	}
+	if src.Smaller != 0 && (dst.Smaller == 0 || src.Smaller < dst.Smaller) {
+		dst.Smaller = src.Smaller
+	}
+	if src.ModSeq > dst.ModSeq {
+		dst.ModSeq = src.ModSeq
+	}
+
+	// SearchCriteria只能保存一个UID范围，其他范围使用NOT NOT表示
+	if src.Uid != nil {
+		if dst.Uid == nil {
+			dst.Uid = src.Uid
+		} else {
+			dst.Not = append(dst.Not, negateCriteria(&imap.SearchCriteria{Uid: src.Uid}))
+		}
+	}
+	if src.SeqNum != nil {
+		if dst.SeqNum == nil {
+			dst.SeqNum = src.SeqNum
+		} else {
+			dst.Not = append(dst.Not, negateCriteria(&imap.SearchCriteria{SeqNum: src.SeqNum}))
+		}
+	}
+}
+
+// FormatQuery 将imap.SearchCriteria转换为查询语句，ParseQuery解析结果和criteria等价
+func FormatQuery(criteria *imap.SearchCriteria) string {
+	if criteria == nil {
+		return ""
+	}
+	return strings.Join(formatQueryTerms(criteria), " ")
+}
+
+// formatQueryTerms 将条件转换为需要同时满足的多个条件
+func formatQueryTerms(c *imap.SearchCriteria) []string {
+	var terms []string
+	if c.SeqNum != nil {
+		terms = append(terms, "seq:"+c.SeqNum.String())
+	}
+	if c.Uid != nil {
+		terms = append(terms, "uid:"+c.Uid.String())
+	}
+
+	dates := []struct {
+		key  string
+		date time.Time
+	}{
+		{"since", c.Since},
+		{"before", c.Before},
+		{"sentsince", c.SentSince},
+		{"sentbefore", c.SentBefore},
+	}
+	for _, d := range dates {
+		if !d.date.IsZero() {
+			terms = append(terms, d.key+":"+d.date.Format("2006-01-02"))
+		}
+	}
+
+	keys := make([]string, 0, len(c.Header))
+	for key := range c.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := strings.ToLower(key)
+		_, short := queryHeaders[name]
+		for _, value := range c.Header[key] {
+			if short {
+				terms = append(terms, name+":"+quoteQueryValue(value))
+			} else {
+				terms = append(terms, "header:"+quoteQueryValue(textproto.CanonicalMIMEHeaderKey(key)+":"+value))
+			}
+		}
+	}
+
+	for _, value := range c.Body {
+		terms = append(terms, "body:"+quoteQueryValue(value))
+	}
+	for _, value := range c.Text {
+		terms = append(terms, quoteQueryText(value))
+	}
+	for _, flag := range c.WithFlags {
+		terms = append(terms, formatQueryFlag(flag))
+	}
+	for _, flag := range c.WithoutFlags {
+		terms = append(terms, "-"+formatQueryFlag(flag))
+	}
+
+	if c.Larger > 0 {
+		terms = append(terms, "larger:"+formatQuerySize(c.Larger))
+	}
+	if c.Smaller > 0 {
+		terms = append(terms, "smaller:"+formatQuerySize(c.Smaller))
+	}
+	if c.ModSeq > 0 {
+		terms = append(terms, "modseq:"+strconv.FormatUint(c.ModSeq, 10))
+	}
+
+	for _, not := range c.Not {
+		group := formatQueryGroup(not)
+		if strings.HasPrefix(group, "-") {
+			// 两次取反，例如合并多个uid:条件时产生的NOT NOT
+			terms = append(terms, group[1:])
+		} else {
+			terms = append(terms, "-"+group)
+		}
+	}
+	for _, or := range c.Or {
+		terms = append(terms, "("+formatQueryGroup(or[0])+" OR "+formatQueryGroup(or[1])+")")
+	}
+	return terms
+}
+
+// formatQueryGroup 将条件转换为一个单元，有多个条件时使用括号
+func formatQueryGroup(c *imap.SearchCriteria) string {
+	terms := formatQueryTerms(c)
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " ") + ")"
+}
+
+// formatQueryFlag 将标志转换为is:或者keyword:条件
+func formatQueryFlag(flag string) string {
+	if name, ok := queryFlagNames[imap.CanonicalFlag(flag)]; ok {
+		return "is:" + name
+	}
+	return "keyword:" + quoteQueryValue(flag)
+}
+
+// formatQuerySize 大小是1024的整数倍时使用K、M、G后缀
+func formatQuerySize(size uint32) string {
+	for _, unit := range []struct {
+		suffix string
+		n      uint32
+	}{{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}} {
+		if size%unit.n == 0 {
+			return strconv.FormatUint(uint64(size/unit.n), 10) + unit.suffix
+		}
+	}
+	return strconv.FormatUint(uint64(size), 10)
+}
+
+// quoteQueryValue 内容为空或者包含空白字符、括号、引号时加上双引号
+func quoteQueryValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, "()\"") &&
+		strings.IndexFunc(value, isQuerySpace) < 0 {
+		return value
+	}
+	return quoteQueryString(value)
+}
+
+// quoteQueryText 不带前缀的内容，除了quoteQueryValue的情况，还要避免被解析为条件名称、-或者OR等关键字
+func quoteQueryText(value string) string {
+	switch {
+	case strings.HasPrefix(value, "-"), strings.Contains(value, ":"),
+		value == "OR", value == "AND", value == "NOT":
+		return quoteQueryString(value)
+	}
+	return quoteQueryValue(value)
+}
+
+func quoteQueryString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
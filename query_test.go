@@ -0,0 +1,131 @@
+package zdpgo_imap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+)
+
+func TestFormatQuery(t *testing.T) {
+	tests := []struct {
+		query     string
+		canonical string
+	}{
+		{"", ""},
+		{"()", ""},
+		{"hello", "hello"},
+		{"a AND b", "a b"},
+		{"a b OR c", "a (b OR c)"},
+		{"(a OR b) OR c", "((a OR b) OR c)"},
+		{"-(a b)", "-(a b)"},
+		{"NOT a", "-a"},
+		{"-is:seen", "-is:seen"},
+		{"NOT -is:seen", "is:seen"},
+		{"--is:seen", "is:seen"},
+		{"-is:unread", "is:seen"},
+		{"is:starred -is:replied", "is:flagged -is:answered"},
+		{"keyword:Junk", "keyword:junk"},
+		{"from:alice subject:\"周报\" since:2022-05-01 -is:seen larger:1M (to:bob OR cc:bob)",
+			"since:2022-05-01 from:alice subject:周报 -is:seen larger:1M (to:bob OR cc:bob)"},
+		{"subject:\"a b\"", "subject:\"a b\""},
+		{"text:\"a b\" body:\"c\\\"d\"", "body:\"c\\\"d\" \"a b\""},
+		{"\"-x\" \"a:b\" \"OR\"", "\"-x\" \"a:b\" \"OR\""},
+		{"header:x-priority:1", "header:X-Priority:1"},
+		{"since:2022/05/01 before:2-Jun-2022", "since:2022-05-01 before:2022-06-02"},
+		{"on:2022-05-01", "since:2022-05-01 before:2022-05-02"},
+		{"senton:2022-05-01", "sentsince:2022-05-01 sentbefore:2022-05-02"},
+		{"since:2022-05-01 since:2022-04-01", "since:2022-05-01"},
+		{"larger:1500 smaller:2K larger:1k", "larger:1500 smaller:2K"},
+		{"larger:1G", "larger:1G"},
+		{"seq:1,3:5 modseq:7", "seq:1,3:5 modseq:7"},
+		{"uid:5:1", "uid:1:5"},
+		{"uid:1:5 uid:3:9", "uid:1:5 uid:3:9"},
+		{"uid:1 uid:2 uid:3", "uid:1 uid:2 uid:3"},
+		{"seq:1 seq:2", "seq:1 seq:2"},
+		{"-uid:1:5 -uid:7", "-uid:1:5 -uid:7"},
+		{"-(uid:1 uid:2)", "-(uid:1 uid:2)"},
+	}
+
+	for _, test := range tests {
+		criteria, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) = %v", test.query, err)
+			continue
+		}
+		got := FormatQuery(criteria)
+		if got != test.canonical {
+			t.Errorf("FormatQuery(ParseQuery(%q)) = %q, want %q", test.query, got, test.canonical)
+			continue
+		}
+
+		// 规范形式再解析和格式化后不变
+		criteria, err = ParseQuery(got)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) = %v", got, err)
+		} else if again := FormatQuery(criteria); again != got {
+			t.Errorf("FormatQuery(ParseQuery(%q)) = %q, not canonical", got, again)
+		}
+	}
+}
+
+func TestParseQueryUid(t *testing.T) {
+	criteria, err := ParseQuery("uid:1:5 uid:3:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid := uint32(1); uid <= 10; uid++ {
+		want := imap.MatchFalse
+		if uid >= 3 && uid <= 5 {
+			want = imap.MatchTrue
+		}
+		msg := &imap.Message{Uid: uid, Items: map[imap.FetchItem]interface{}{imap.FetchUid: nil}}
+		if got := criteria.MatchMessage(msg); got != want {
+			t.Errorf("uid %d: MatchMessage() = %v, want %v", uid, got, want)
+		}
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"- a", 0},
+		{"a -", 2},
+		{"(a", 0},
+		{"a (b (c)", 2},
+		{"a)", 1},
+		{"from:", 5},
+		{"a from:", 7},
+		{"\"abc", 0},
+		{"a \"b", 2},
+		{"\"a\"b", 3},
+		{"ab\"c", 2},
+		{"foo:bar", 0},
+		{"a Foo:bar", 2},
+		{"is:foo", 3},
+		{"since:2022-13-01", 6},
+		{"larger:1T", 7},
+		{"older_than:soon", 11},
+		{"modseq:0", 7},
+		{"uid:x", 4},
+		{"header:abc", 7},
+		{"OR a", 0},
+		{"a OR", 4},
+		{"a OR OR b", 5},
+		{"主题 from:", 8},
+	}
+
+	for _, test := range tests {
+		_, err := ParseQuery(test.query)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("ParseQuery(%q) = %v, want a *QueryError", test.query, err)
+			continue
+		}
+		if queryErr.Pos != test.pos || queryErr.Query != test.query {
+			t.Errorf("ParseQuery(%q): error at %d (%v), want %d", test.query, queryErr.Pos, err, test.pos)
+		}
+	}
+}
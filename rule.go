@@ -0,0 +1,669 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : rule.go
+@Software: Goland2021.3.1
+@Description: 声明式的邮件处理规则
+规则由匹配条件和动作组成，可以从JSON或者YAML文件加载
+*/
+
+// 规则的动作
+const (
+	RuleActionMove            = "move"             // 移动到Mailbox
+	RuleActionCopy            = "copy"             // 复制到Mailbox
+	RuleActionAddFlags        = "add_flags"        // 添加Flags
+	RuleActionRemoveFlags     = "remove_flags"     // 去掉Flags
+	RuleActionFlag            = "flag"             // 标记为星标邮件
+	RuleActionSeen            = "seen"             // 标记为已读
+	RuleActionDelete          = "delete"           // 永久删除
+	RuleActionSaveAttachments = "save_attachments" // 保存附件到Dir
+	RuleActionCallback        = "callback"         // 调用RuleEngine.Handle注册的Callback
+)
+
+// RuleCondition 规则的匹配条件，所有设置的条件都满足时才匹配
+// 正则表达式的内容是普通字符串时，会先使用服务器的SEARCH过滤，再在本地使用正则表达式确认
+type RuleCondition struct {
+	From          string            `json:"from,omitempty" yaml:"from,omitempty"`                     // 发件人的正则表达式，匹配"名称 <地址>"
+	To            string            `json:"to,omitempty" yaml:"to,omitempty"`                         // 收件人或抄送人的正则表达式
+	Subject       string            `json:"subject,omitempty" yaml:"subject,omitempty"`               // 标题的正则表达式
+	Header        map[string]string `json:"header,omitempty" yaml:"header,omitempty"`                 // 邮件头名称到值的正则表达式，值为空时只要求包含该邮件头
+	HasAttachment *bool             `json:"has_attachment,omitempty" yaml:"has_attachment,omitempty"` // 是否包含附件
+	MinSize       uint32            `json:"min_size,omitempty" yaml:"min_size,omitempty"`             // 邮件的最小字节数
+	MaxSize       uint32            `json:"max_size,omitempty" yaml:"max_size,omitempty"`             // 邮件的最大字节数
+	OlderThan     string            `json:"older_than,omitempty" yaml:"older_than,omitempty"`         // 到达时间早于多久之前，例如"720h"、"30d"
+	NewerThan     string            `json:"newer_than,omitempty" yaml:"newer_than,omitempty"`         // 到达时间晚于多久之前
+	Flags         []string          `json:"flags,omitempty" yaml:"flags,omitempty"`                   // 必须有的标志
+	NoFlags       []string          `json:"no_flags,omitempty" yaml:"no_flags,omitempty"`             // 不能有的标志
+}
+
+// RuleAction 规则匹配后执行的动作
+type RuleAction struct {
+	Type     string   `json:"type" yaml:"type"`                             // 动作类型，RuleActionMove等
+	Mailbox  string   `json:"mailbox,omitempty" yaml:"mailbox,omitempty"`   // move和copy的目标邮箱
+	Flags    []string `json:"flags,omitempty" yaml:"flags,omitempty"`       // add_flags和remove_flags的标志
+	Dir      string   `json:"dir,omitempty" yaml:"dir,omitempty"`           // save_attachments保存附件的目录
+	Callback string   `json:"callback,omitempty" yaml:"callback,omitempty"` // callback调用的函数名称
+}
+
+// Rule 一条处理规则
+type Rule struct {
+	Name    string        `json:"name" yaml:"name"`
+	Match   RuleCondition `json:"match" yaml:"match"`
+	Actions []*RuleAction `json:"actions" yaml:"actions"`               // 按顺序执行，move和delete只能是最后一个动作
+	Stop    bool          `json:"stop,omitempty" yaml:"stop,omitempty"` // 匹配后不再对这些邮件执行后面的规则
+
+	from, to, subject *regexp.Regexp
+	header            map[string]*regexp.Regexp
+	olderThan         time.Duration
+	newerThan         time.Duration
+}
+
+// RuleSet 规则文件的内容
+type RuleSet struct {
+	Rules []*Rule `json:"rules" yaml:"rules"`
+}
+
+// RuleCallback callback动作调用的函数，result包含邮件的完整内容
+type RuleCallback func(ctx context.Context, rule *Rule, result *Result) error
+
+// RuleResult 一条规则的执行结果
+type RuleResult struct {
+	Rule    string   `json:"rule"`
+	Mailbox string   `json:"mailbox"`
+	Uids    []uint32 `json:"uids"` // 匹配并执行了动作的邮件
+}
+
+var (
+	ruleFormatsLocker sync.RWMutex
+	ruleFormats       = map[string]func(data []byte, v interface{}) error{
+		"json": json.Unmarshal,
+		"yaml": yaml.Unmarshal,
+	}
+)
+
+// RegisterRuleFormat 注册规则文件的解析函数，format是文件的扩展名(不包含".")
+// 内置了"json"和"yaml"，其他格式(例如TOML)需要先注册
+func RegisterRuleFormat(format string, unmarshal func(data []byte, v interface{}) error) {
+	ruleFormatsLocker.Lock()
+	ruleFormats[strings.ToLower(format)] = unmarshal
+	ruleFormatsLocker.Unlock()
+}
+
+// ParseRules 解析规则，format是"json"、"yaml"或者使用RegisterRuleFormat注册的格式
+func ParseRules(data []byte, format string) ([]*Rule, error) {
+	ruleFormatsLocker.RLock()
+	unmarshal, ok := ruleFormats[strings.ToLower(format)]
+	ruleFormatsLocker.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("imap: unknown rule format %q, use RegisterRuleFormat to register it", format)
+	}
+
+	var set RuleSet
+	if err := unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	for _, rule := range set.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return set.Rules, nil
+}
+
+// LoadRules 从文件加载规则，根据扩展名选择解析函数，".yml"和".yaml"相同
+func LoadRules(path string) ([]*Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if format == "yml" {
+		format = "yaml"
+	}
+	return ParseRules(data, format)
+}
+
+// compile 编译正则表达式并检查动作
+func (r *Rule) compile() error {
+	var err error
+	compile := func(expr string) *regexp.Regexp {
+		if expr == "" || err != nil {
+			return nil
+		}
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(expr); err != nil {
+			err = fmt.Errorf("imap: rule %q: %v", r.Name, err)
+		}
+		return re
+	}
+
+	r.from = compile(r.Match.From)
+	r.to = compile(r.Match.To)
+	r.subject = compile(r.Match.Subject)
+	// 值为空字符串的邮件头保存为nil，只要求邮件包含该邮件头
+	r.header = make(map[string]*regexp.Regexp, len(r.Match.Header))
+	for key, expr := range r.Match.Header {
+		r.header[key] = compile(expr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.olderThan, err = parseAge(r.Match.OlderThan); err != nil {
+		return fmt.Errorf("imap: rule %q: older_than: %v", r.Name, err)
+	}
+	if r.newerThan, err = parseAge(r.Match.NewerThan); err != nil {
+		return fmt.Errorf("imap: rule %q: newer_than: %v", r.Name, err)
+	}
+
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("imap: rule %q has no action", r.Name)
+	}
+	for n, action := range r.Actions {
+		switch action.Type {
+		case RuleActionMove, RuleActionDelete:
+			if n != len(r.Actions)-1 {
+				return fmt.Errorf("imap: rule %q: %s must be the last action", r.Name, action.Type)
+			}
+			if action.Type == RuleActionMove && action.Mailbox == "" {
+				return fmt.Errorf("imap: rule %q: move requires a mailbox", r.Name)
+			}
+		case RuleActionCopy:
+			if action.Mailbox == "" {
+				return fmt.Errorf("imap: rule %q: copy requires a mailbox", r.Name)
+			}
+		case RuleActionAddFlags, RuleActionRemoveFlags:
+			if len(action.Flags) == 0 {
+				return fmt.Errorf("imap: rule %q: %s requires flags", r.Name, action.Type)
+			}
+		case RuleActionSaveAttachments:
+			if action.Dir == "" {
+				return fmt.Errorf("imap: rule %q: save_attachments requires a dir", r.Name)
+			}
+		case RuleActionCallback:
+			if action.Callback == "" {
+				return fmt.Errorf("imap: rule %q: callback requires a name", r.Name)
+			}
+		case RuleActionFlag, RuleActionSeen:
+		default:
+			return fmt.Errorf("imap: rule %q: unknown action %q", r.Name, action.Type)
+		}
+	}
+	return nil
+}
+
+// parseAge 解析时间间隔，除了time.ParseDuration的格式，还支持以"d"结尾的天数
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// regexpLiteral 正则表达式只包含普通字符时返回这些字符，否则返回空字符串
+func regexpLiteral(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	prefix, complete := re.LiteralPrefix()
+	if !complete {
+		return ""
+	}
+	return prefix
+}
+
+// criteria 可以使用服务器的SEARCH表示的条件，服务器的匹配结果是本地匹配结果的超集
+func (r *Rule) criteria(now time.Time) *imap.SearchCriteria {
+	criteria := imap.NewSearchCriteria()
+	if s := regexpLiteral(r.from); s != "" {
+		criteria.Header.Add("From", s)
+	}
+	if s := regexpLiteral(r.subject); s != "" {
+		criteria.Header.Add("Subject", s)
+	}
+	if s := regexpLiteral(r.to); s != "" {
+		to := imap.NewSearchCriteria()
+		to.Header.Add("To", s)
+		cc := imap.NewSearchCriteria()
+		cc.Header.Add("Cc", s)
+		criteria.Or = append(criteria.Or, [2]*imap.SearchCriteria{to, cc})
+	}
+	for key, re := range r.header {
+		// 空字符串匹配所有包含该邮件头的邮件
+		if s := regexpLiteral(re); s != "" || re == nil {
+			criteria.Header.Add(key, s)
+		}
+	}
+	if r.Match.MinSize > 0 {
+		criteria.Larger = r.Match.MinSize - 1
+	}
+	if r.Match.MaxSize > 0 {
+		criteria.Smaller = r.Match.MaxSize + 1
+	}
+	// BEFORE和SINCE只精确到天，放宽一天，本地再精确比较
+	if r.olderThan > 0 {
+		criteria.Before = now.Add(-r.olderThan).Add(24 * time.Hour)
+	}
+	if r.newerThan > 0 {
+		criteria.Since = now.Add(-r.newerThan).Add(-24 * time.Hour)
+	}
+	criteria.WithFlags = r.Match.Flags
+	criteria.WithoutFlags = r.Match.NoFlags
+	return criteria
+}
+
+// headerFields 规则中需要抓取的邮件头
+func (r *Rule) headerFields() []string {
+	var fields []string
+	for key := range r.header {
+		fields = append(fields, key)
+	}
+	return fields
+}
+
+// formatAddresses 将地址格式化为"名称 <地址>"
+func formatAddresses(addrs ...[]*imap.Address) []string {
+	var list []string
+	for _, l := range addrs {
+		for _, addr := range l {
+			if addr.PersonalName != "" {
+				list = append(list, fmt.Sprintf("%s <%s>", addr.PersonalName, addr.Address()))
+			} else {
+				list = append(list, addr.Address())
+			}
+		}
+	}
+	return list
+}
+
+// matchAny 判断是否有值匹配正则表达式
+func matchAny(re *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAttachment 根据BODYSTRUCTURE判断邮件是否包含附件
+func hasAttachment(bs *imap.BodyStructure) bool {
+	found := false
+	bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if strings.EqualFold(part.Disposition, "attachment") {
+			found = true
+		} else if filename, _ := part.Filename(); filename != "" && !strings.EqualFold(part.MIMEType, "multipart") {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// match 在本地判断邮件是否匹配所有的条件
+func (r *Rule) match(msg *imap.Message, now time.Time) bool {
+	if msg.Envelope == nil {
+		return false
+	}
+	if r.from != nil && !matchAny(r.from, formatAddresses(msg.Envelope.From)) {
+		return false
+	}
+	if r.to != nil && !matchAny(r.to, formatAddresses(msg.Envelope.To, msg.Envelope.Cc)) {
+		return false
+	}
+	if r.subject != nil && !r.subject.MatchString(msg.Envelope.Subject) {
+		return false
+	}
+
+	if len(r.header) > 0 {
+		h := messageHeader(msg)
+		if h == nil {
+			return false
+		}
+		for key, re := range r.header {
+			var values []string
+			fields := h.FieldsByKey(key)
+			for fields.Next() {
+				value, err := fields.Text()
+				if err != nil {
+					value = fields.Value()
+				}
+				values = append(values, value)
+			}
+			if len(values) == 0 || (re != nil && !matchAny(re, values)) {
+				return false
+			}
+		}
+	}
+
+	if r.Match.HasAttachment != nil {
+		if msg.BodyStructure == nil || hasAttachment(msg.BodyStructure) != *r.Match.HasAttachment {
+			return false
+		}
+	}
+	if r.Match.MinSize > 0 && msg.Size < r.Match.MinSize {
+		return false
+	}
+	if r.Match.MaxSize > 0 && msg.Size > r.Match.MaxSize {
+		return false
+	}
+	if r.olderThan > 0 && !msg.InternalDate.Before(now.Add(-r.olderThan)) {
+		return false
+	}
+	if r.newerThan > 0 && !msg.InternalDate.After(now.Add(-r.newerThan)) {
+		return false
+	}
+	for _, flag := range r.Match.Flags {
+		if !hasAttr(msg.Flags, flag) {
+			return false
+		}
+	}
+	for _, flag := range r.Match.NoFlags {
+		if hasAttr(msg.Flags, flag) {
+			return false
+		}
+	}
+	return true
+}
+
+// needResults 是否有动作需要邮件的完整内容
+func (r *Rule) needResults() bool {
+	for _, action := range r.Actions {
+		if action.Type == RuleActionSaveAttachments || action.Type == RuleActionCallback {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleEngine 对邮箱执行处理规则
+type RuleEngine struct {
+	imap      *Imap
+	rules     []*Rule
+	callbacks map[string]RuleCallback
+	locker    sync.Mutex
+}
+
+// NewRuleEngine 创建规则引擎，rules可以使用LoadRules或者ParseRules加载，也可以直接创建
+func (i *Imap) NewRuleEngine(rules []*Rule) (*RuleEngine, error) {
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return &RuleEngine{
+		imap:      i,
+		rules:     rules,
+		callbacks: make(map[string]RuleCallback),
+	}, nil
+}
+
+// Handle 注册callback动作调用的函数
+func (e *RuleEngine) Handle(name string, fn RuleCallback) {
+	e.locker.Lock()
+	e.callbacks[name] = fn
+	e.locker.Unlock()
+}
+
+// Run 对mailbox中的所有邮件执行一次规则，规则按顺序执行
+func (e *RuleEngine) Run(ctx context.Context, mailbox string) ([]*RuleResult, error) {
+	return e.run(ctx, mailbox, nil)
+}
+
+// Watch 使用IDLE监听mailbox的新邮件，并对新邮件执行规则，直到ctx结束
+// onResult 不为nil时，每次执行规则后调用
+func (e *RuleEngine) Watch(ctx context.Context, mailbox string, onResult func(results []*RuleResult, err error)) error {
+	// 只监听新邮件的UID，需要邮件内容的规则在执行时再抓取
+	ch, err := e.imap.watchUids(ctx, mailbox)
+	if err != nil {
+		return err
+	}
+
+	for newUids := range ch {
+		// 合并同时到达的新邮件
+		uids := new(imap.SeqSet)
+		uids.AddNum(newUids...)
+	more:
+		for {
+			select {
+			case more, ok := <-ch:
+				if !ok {
+					break more
+				}
+				uids.AddNum(more...)
+			default:
+				break more
+			}
+		}
+
+		results, err := e.run(ctx, mailbox, uids)
+		if err != nil {
+			e.imap.Log.Error("执行邮件处理规则失败", "error", err, "mailbox", mailbox)
+		}
+		if onResult != nil {
+			onResult(results, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// run 对mailbox中的邮件执行规则，only不为nil时只处理其中的UID
+func (e *RuleEngine) run(ctx context.Context, mailbox string, only *imap.SeqSet) ([]*RuleResult, error) {
+	var (
+		results []*RuleResult
+		stopped = make(map[uint32]bool)
+	)
+
+	for _, rule := range e.rules {
+		var (
+			matched []uint32
+			full    []*Result
+		)
+		err := e.imap.withClientRetry(ctx, func(c *client.Client) (err error) {
+			matched, full, err = e.search(ctx, c, mailbox, rule, only, stopped)
+			return err
+		})
+		if err != nil {
+			return results, err
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		err = e.apply(ctx, mailbox, rule, matched, full)
+		// 附件模式为AttachmentModeDisk时删除保存附件的临时文件
+		e.imap.RemoveAttachments(full...)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, &RuleResult{Rule: rule.Name, Mailbox: mailbox, Uids: matched})
+
+		if rule.Stop {
+			for _, uid := range matched {
+				stopped[uid] = true
+			}
+		}
+	}
+	return results, nil
+}
+
+// search 使用服务器的SEARCH预先过滤，再在本地确认匹配的邮件
+func (e *RuleEngine) search(ctx context.Context, c *client.Client, mailbox string, rule *Rule, only *imap.SeqSet, stopped map[uint32]bool) ([]uint32, []*Result, error) {
+	i := e.imap
+	if _, err := i.selectMailbox(ctx, c, mailbox); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	criteria := rule.criteria(now)
+	criteria.Uid = only
+	uids, err := c.UidSearchContext(ctx, criteria)
+	if err != nil {
+		i.Log.Error("搜索邮件失败", "error", err, "rule", rule.Name)
+		return nil, nil, commandError(c, "UID SEARCH", err)
+	}
+
+	var candidates []uint32
+	for _, uid := range uids {
+		if !stopped[uid] {
+			candidates = append(candidates, uid)
+		}
+	}
+	sortUidsAsc(candidates)
+
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size, imap.FetchInternalDate}
+	if rule.Match.HasAttachment != nil {
+		items = append(items, imap.FetchBodyStructure)
+	}
+	if fields := rule.headerFields(); len(fields) > 0 {
+		section := &imap.BodySectionName{
+			BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier, Fields: fields},
+			Peek:         true,
+		}
+		items = append(items, section.FetchItem())
+	}
+	infos, err := i.fetchByUids(ctx, c, candidates, items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var matched []uint32
+	for _, uid := range candidates {
+		if msg, ok := infos[uid]; ok && rule.match(msg, now) {
+			matched = append(matched, uid)
+		}
+	}
+	if len(matched) == 0 || !rule.needResults() {
+		return matched, nil, nil
+	}
+
+	results, err := i.fetchResults(ctx, c, matched, infos, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, result := range results {
+		result.Mailbox = mailbox
+	}
+	return matched, results, nil
+}
+
+// apply 按顺序执行规则的动作
+func (e *RuleEngine) apply(ctx context.Context, mailbox string, rule *Rule, uids []uint32, results []*Result) error {
+	i := e.imap
+	for _, action := range rule.Actions {
+		var err error
+		switch action.Type {
+		case RuleActionMove:
+			err = i.MoveByUid(ctx, mailbox, uids, action.Mailbox)
+		case RuleActionCopy:
+			err = i.CopyByUid(ctx, mailbox, uids, action.Mailbox)
+		case RuleActionAddFlags:
+			err = i.AddFlagsByUid(ctx, mailbox, uids, action.Flags...)
+		case RuleActionRemoveFlags:
+			err = i.RemoveFlagsByUid(ctx, mailbox, uids, action.Flags...)
+		case RuleActionFlag:
+			err = i.AddFlagsByUid(ctx, mailbox, uids, imap.FlaggedFlag)
+		case RuleActionSeen:
+			err = i.AddFlagsByUid(ctx, mailbox, uids, imap.SeenFlag)
+		case RuleActionDelete:
+			err = i.DeleteByUid(ctx, mailbox, uids)
+		case RuleActionSaveAttachments:
+			for _, result := range results {
+				if _, err = i.SaveAttachments(result, action.Dir); err != nil {
+					break
+				}
+			}
+		case RuleActionCallback:
+			e.locker.Lock()
+			fn := e.callbacks[action.Callback]
+			e.locker.Unlock()
+			if fn == nil {
+				return fmt.Errorf("imap: rule %q: callback %q is not registered", rule.Name, action.Callback)
+			}
+			for _, result := range results {
+				if err = fn(ctx, rule, result); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			i.Log.Error("执行规则的动作失败", "error", err, "rule", rule.Name, "action", action.Type)
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveAttachments 将结果中的附件保存到dir，返回保存的文件路径
+// 同名的文件不会被覆盖，而是在文件名后面添加序号
+func (i *Imap) SaveAttachments(result *Result, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	save := func(filename string, r io.Reader) error {
+		f, err := createUniqueFile(dir, sanitizeFilename(filename))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+		paths = append(paths, f.Name())
+		return nil
+	}
+
+	for _, attachment := range result.Attachments {
+		for filename, data := range attachment {
+			if err := save(filename, strings.NewReader(string(data))); err != nil {
+				return paths, err
+			}
+		}
+	}
+	for _, file := range result.Files {
+		src, err := os.Open(file.Path)
+		if err != nil {
+			return paths, err
+		}
+		err = save(file.Filename, src)
+		src.Close()
+		if err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
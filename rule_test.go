@@ -0,0 +1,192 @@
+package zdpgo_imap
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend/memory"
+)
+
+const rulesJSON = `{
+	"rules": [
+		{
+			"name": "newsletter",
+			"match": {"from": "@news\\.example\\.org", "has_attachment": false, "older_than": "30d"},
+			"actions": [{"type": "seen"}, {"type": "move", "mailbox": "Archive"}],
+			"stop": true
+		},
+		{
+			"name": "invoice",
+			"match": {"subject": "(?i)invoice", "header": {"X-Priority": "1"}, "no_flags": ["\\Seen"]},
+			"actions": [{"type": "add_flags", "flags": ["\\Flagged"]}, {"type": "save_attachments", "dir": "invoices"}]
+		}
+	]
+}`
+
+const rulesYAML = `
+rules:
+  - name: newsletter
+    match:
+      from: '@news\.example\.org'
+      has_attachment: false
+      older_than: 30d
+    actions:
+      - type: seen
+      - type: move
+        mailbox: Archive
+    stop: true
+  - name: invoice
+    match:
+      subject: (?i)invoice
+      header:
+        X-Priority: "1"
+      no_flags: ['\Seen']
+    actions:
+      - type: add_flags
+        flags: ['\Flagged']
+      - type: save_attachments
+        dir: invoices
+`
+
+func TestParseRules(t *testing.T) {
+	want, err := ParseRules([]byte(rulesJSON), "json")
+	if err != nil {
+		t.Fatalf("ParseRules(json) = %v", err)
+	}
+	if len(want) != 2 {
+		t.Fatalf("ParseRules(json) returned %d rules, want 2", len(want))
+	}
+
+	for _, format := range []string{"yaml", "YAML"} {
+		rules, err := ParseRules([]byte(rulesYAML), format)
+		if err != nil {
+			t.Fatalf("ParseRules(%s) = %v", format, err)
+		}
+		if !reflect.DeepEqual(rules, want) {
+			t.Errorf("ParseRules(%s) = %+v, want %+v", format, rules, want)
+		}
+	}
+
+	if _, err := ParseRules([]byte(rulesJSON), "toml"); err == nil {
+		t.Error("ParseRules(toml) succeeded, want an error")
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zdpgo_imap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"rules.json": rulesJSON,
+		"rules.yaml": rulesYAML,
+		"rules.yml":  rulesYAML,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rules, err := LoadRules(path)
+		if err != nil {
+			t.Errorf("LoadRules(%s) = %v", name, err)
+		} else if len(rules) != 2 || rules[0].Name != "newsletter" || rules[1].Name != "invoice" {
+			t.Errorf("LoadRules(%s) = %+v", name, rules)
+		}
+	}
+}
+
+func TestRuleMatchHeader(t *testing.T) {
+	rule := &Rule{
+		Name: "spam",
+		Match: RuleCondition{Header: map[string]string{
+			"X-Spam":     "",
+			"X-Priority": "^1",
+		}},
+		Actions: []*RuleAction{{Type: RuleActionSeen}},
+	}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"X-Spam: yes\r\nX-Priority: 1\r\n\r\n", true},
+		{"X-Spam:\r\nX-Priority: 1 (Highest)\r\n\r\n", true},
+		{"X-Priority: 1\r\n\r\n", false},
+		{"X-Spam: yes\r\nX-Priority: 3\r\n\r\n", false},
+		{"X-Spam: yes\r\n\r\n", false},
+	}
+
+	now := time.Now()
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}, Peek: true}
+	for _, test := range tests {
+		msg := &imap.Message{
+			Envelope: &imap.Envelope{},
+			Body:     map[*imap.BodySectionName]imap.Literal{section: bytes.NewBufferString(test.header)},
+		}
+		if got := rule.match(msg, now); got != test.want {
+			t.Errorf("match(%q) = %v, want %v", test.header, got, test.want)
+		}
+	}
+
+	// 服务器的SEARCH也只要求包含X-Spam
+	criteria := rule.criteria(now)
+	if values, ok := criteria.Header["X-Spam"]; !ok || len(values) != 1 || values[0] != "" {
+		t.Errorf("criteria().Header = %v, want X-Spam with an empty value", criteria.Header)
+	}
+}
+
+func TestRuleEngineRemoveAttachments(t *testing.T) {
+	i := newTestImap(t, memory.New())
+	i.Config.AttachmentMode = AttachmentModeDisk
+	i.Config.TmpDir = filepath.Join(t.TempDir(), "tmp")
+	appendTestMessages(t, i, "INBOX",
+		"Subject: invoice\nContent-Type: multipart/mixed; boundary=b\n\n"+
+			"--b\nContent-Type: text/plain\n\nsee attachment\n"+
+			"--b\nContent-Type: application/octet-stream\nContent-Disposition: attachment; filename=invoice.pdf\n\n%PDF\n"+
+			"--b--\n",
+	)
+
+	engine, err := i.NewRuleEngine([]*Rule{{
+		Name:    "invoice",
+		Match:   RuleCondition{Subject: "invoice"},
+		Actions: []*RuleAction{{Type: RuleActionCallback, Callback: "check"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	engine.Handle("check", func(ctx context.Context, rule *Rule, result *Result) error {
+		for _, file := range result.Files {
+			if _, err := os.Stat(file.Path); err != nil {
+				return err
+			}
+			files = append(files, file.Path)
+		}
+		return nil
+	})
+
+	results, err := engine.Run(context.Background(), "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Uids) != 1 || len(files) != 1 {
+		t.Fatalf("Run() = %+v, callback saw files %v", results, files)
+	}
+	// 执行动作之后删除附件的临时文件
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("attachment %s still exists after Run()", files[0])
+	}
+}
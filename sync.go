@@ -0,0 +1,278 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:07
+@Author : 张大鹏
+@File : sync.go
+@Software: Goland2021.3.1
+@Description: 基于UID的增量同步
+*/
+
+// SyncState 一个账号的一个邮箱的同步状态
+type SyncState struct {
+	UidValidity uint32 `json:"uid_validity"` // 同步时邮箱的UIDVALIDITY
+	HighestUid  uint32 `json:"highest_uid"`  // 已经同步的最大UID
+	Uids        string `json:"uids"`         // 已经同步的UID集合，使用sequence-set格式压缩保存
+	// 同步时邮箱的HIGHESTMODSEQ，服务器支持CONDSTORE时才有
+	HighestModSeq uint64 `json:"highest_mod_seq,omitempty"`
+}
+
+// SyncStore 保存同步状态的存储，可以替换为数据库等实现
+type SyncStore interface {
+	// Load 读取同步状态，没有同步过时返回nil, nil
+	Load(account, mailbox string) (*SyncState, error)
+	// Save 保存同步状态
+	Save(account, mailbox string, state *SyncState) error
+}
+
+// JSONFileStore 将同步状态保存在一个JSON文件中，默认的SyncStore实现
+type JSONFileStore struct {
+	Path string
+
+	locker sync.Mutex
+}
+
+// NewJSONFileStore 创建保存在path的JSON文件存储
+func NewJSONFileStore(path string) *JSONFileStore {
+	return &JSONFileStore{Path: path}
+}
+
+// read 读取所有的同步状态，键为账号，值为邮箱到同步状态的映射
+func (s *JSONFileStore) read() (map[string]map[string]*SyncState, error) {
+	states := make(map[string]map[string]*SyncState)
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return states, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (s *JSONFileStore) Load(account, mailbox string) (*SyncState, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	states, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return states[account][mailbox], nil
+}
+
+func (s *JSONFileStore) Save(account, mailbox string, state *SyncState) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	states, err := s.read()
+	if err != nil {
+		return err
+	}
+	if states[account] == nil {
+		states[account] = make(map[string]*SyncState)
+	}
+	states[account][mailbox] = state
+
+	return writeJSONFile(s.Path, states)
+}
+
+// writeJSONFile 将v保存为JSON文件
+// 先写入临时文件再重命名，避免中断时损坏已有的内容
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SyncResult 一次同步的结果
+type SyncResult struct {
+	Mailbox     string    `json:"mailbox"`
+	UidValidity uint32    `json:"uid_validity"`
+	Resynced    bool      `json:"resynced"` // UIDVALIDITY发生了变化，进行了全量同步
+	New         []*Result `json:"new"`      // 新的邮件，按照UID从小到大排序
+	Expunged    []uint32  `json:"expunged"` // 上次同步之后被删除的邮件的UID
+	// 上次同步之后标志发生变化的已同步邮件，按照UID从小到大排序
+	// 只有服务器支持CONDSTORE时才能获取，否则总是为空
+	Changed []*FlagChange `json:"changed,omitempty"`
+}
+
+// FlagChange 标志发生变化的邮件
+type FlagChange struct {
+	Uid    uint32   `json:"uid"`
+	Flags  []string `json:"flags"`   // 变化后的所有标志
+	ModSeq uint64   `json:"mod_seq"` // 变化后的MODSEQ
+}
+
+// Sync 增量同步邮箱：只抓取上次同步之后新增的UID，并找出被删除的邮件
+// 服务器支持CONDSTORE时，还会使用CHANGEDSINCE只获取上次同步之后标志发生变化的邮件
+// 第一次同步或者邮箱的UIDVALIDITY发生变化时，抓取邮箱中所有的邮件。同步状态保存在i.SyncStore中
+func (i *Imap) Sync(ctx context.Context, mailbox string) (*SyncResult, error) {
+	account := i.accountKey()
+	state, err := i.SyncStore.Load(account, mailbox)
+	if err != nil {
+		i.Log.Error("读取同步状态失败", "error", err, "mailbox", mailbox)
+		return nil, err
+	}
+
+	var (
+		result   *SyncResult
+		newState *SyncState
+	)
+	err = i.withClientRetry(ctx, func(c *client.Client) (err error) {
+		result, newState, err = i.sync(ctx, c, mailbox, state)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = i.SyncStore.Save(account, mailbox, newState); err != nil {
+		i.Log.Error("保存同步状态失败", "error", err, "mailbox", mailbox)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (i *Imap) sync(ctx context.Context, c *client.Client, mailbox string, state *SyncState) (*SyncResult, *SyncState, error) {
+	// 以只读方式打开邮箱，服务器支持时同时获取HIGHESTMODSEQ
+	mbox, err := i.examineCondStore(ctx, c, mailbox)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &SyncResult{Mailbox: mailbox, UidValidity: mbox.UidValidity}
+
+	// UIDVALIDITY变化后以前的UID都失效了，需要全量同步
+	known := new(imap.SeqSet)
+	var highestUid uint32
+	if state != nil && state.UidValidity == mbox.UidValidity {
+		if state.Uids != "" {
+			if err = known.Add(state.Uids); err != nil {
+				return nil, nil, err
+			}
+		}
+		highestUid = state.HighestUid
+	} else if state != nil {
+		i.Log.Warning("邮箱的UIDVALIDITY发生变化，全量同步", "mailbox", mailbox,
+			"old", state.UidValidity, "new", mbox.UidValidity)
+		result.Resynced = true
+	}
+
+	// 获取邮箱中当前所有的UID
+	uids, err := c.UidSearchContext(ctx, imap.NewSearchCriteria())
+	if err != nil {
+		i.Log.Error("搜索邮件失败", "error", err)
+		return nil, nil, commandError(c, "UID SEARCH", err)
+	}
+	sortUidsAsc(uids)
+
+	current := new(imap.SeqSet)
+	current.AddNum(uids...)
+	newState := &SyncState{
+		UidValidity:   mbox.UidValidity,
+		HighestUid:    highestUid,
+		Uids:          current.String(),
+		HighestModSeq: mbox.HighestModSeq,
+	}
+
+	// 上次同步之后新增的邮件
+	var newUids []uint32
+	for _, uid := range uids {
+		if uid > highestUid {
+			newUids = append(newUids, uid)
+		}
+		if uid > newState.HighestUid {
+			newState.HighestUid = uid
+		}
+	}
+
+	// 上次同步之后被删除的邮件
+	for _, seq := range known.Set {
+		for uid := seq.Start; ; uid++ {
+			if !current.Contains(uid) {
+				result.Expunged = append(result.Expunged, uid)
+			}
+			if uid == seq.Stop {
+				break
+			}
+		}
+	}
+
+	// 上次同步之后标志发生变化的邮件，邮箱的HIGHESTMODSEQ没有变化时不需要获取
+	if state != nil && !result.Resynced && state.HighestModSeq > 0 && highestUid > 0 &&
+		mbox.HighestModSeq > state.HighestModSeq {
+		if result.Changed, err = i.fetchFlagChanges(ctx, c, highestUid, state.HighestModSeq); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 抓取新增的邮件
+	infos, err := i.fetchByUids(ctx, c, newUids, i.infoItems())
+	if err != nil {
+		i.Log.Error("抓取邮件信息失败", "error", err)
+		return nil, nil, err
+	}
+	if result.New, err = i.fetchResults(ctx, c, newUids, infos, nil); err != nil {
+		i.Log.Error("获取邮件MIME内容失败", "error", err)
+		return nil, nil, err
+	}
+	for _, r := range result.New {
+		r.Mailbox = mailbox
+	}
+
+	return result, newState, nil
+}
+
+// fetchFlagChanges 使用CHANGEDSINCE获取UID不超过highestUid、MODSEQ大于modSeq的邮件的标志
+func (i *Imap) fetchFlagChanges(ctx context.Context, c *client.Client, highestUid uint32, modSeq uint64) ([]*FlagChange, error) {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddRange(1, highestUid)
+
+	ch := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags}
+		done <- c.UidFetchChangedSince(ctx, seqSet, items, modSeq, false, ch)
+	}()
+
+	var changes []*FlagChange
+	for msg := range ch {
+		changes = append(changes, &FlagChange{Uid: msg.Uid, Flags: msg.Flags, ModSeq: msg.ModSeq})
+	}
+	if err := <-done; err != nil {
+		i.Log.Error("获取标志变化失败", "error", err, "modSeq", modSeq)
+		return nil, commandError(c, "UID FETCH CHANGEDSINCE", err)
+	}
+
+	sort.Slice(changes, func(a, b int) bool {
+		return changes[a].Uid < changes[b].Uid
+	})
+	return changes, nil
+}
@@ -0,0 +1,60 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/server"
+)
+
+// newTestImap 启动一个使用be和扩展exts的本地IMAP服务器，返回连接到它的Imap，用户名和密码与memory后端相同
+func newTestImap(t *testing.T, be backend.Backend, exts ...server.Extension) *Imap {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	s.Enable(exts...)
+	go s.Serve(l)
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	i := NewWithConfig(&Config{
+		Host:        host,
+		Port:        p,
+		Username:    "username",
+		Password:    "password",
+		Security:    SecurityPlain,
+		Mailbox:     "INBOX",
+		LogFilePath: filepath.Join(t.TempDir(), "zdpgo_imap.log"),
+	})
+	t.Cleanup(func() {
+		i.Close()
+		s.Close()
+	})
+	return i
+}
+
+// appendTestMessages 把邮件添加到mailbox中，邮件的换行使用\n即可
+func appendTestMessages(t *testing.T, i *Imap, mailbox string, messages ...string) {
+	err := i.withClient(context.Background(), func(c *client.Client) error {
+		for _, msg := range messages {
+			msg = strings.Replace(msg, "\n", "\r\n", -1)
+			if err := c.Append(mailbox, nil, time.Now(), strings.NewReader(msg)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,463 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:08
+@Author : 张大鹏
+@File : thread.go
+@Software: Goland2021.3.1
+@Description: 邮件会话，使用JWZ(RFC 5256 REFERENCES)算法把邮件组织成会话树
+*/
+
+// Thread 邮件会话树的节点
+type Thread struct {
+	MessageID string    `json:"message_id"` // 邮件的Message-ID
+	Result    *Result   `json:"result"`     // 为nil表示邮件不在结果中，只是被其他邮件引用
+	Children  []*Thread `json:"children"`   // 回复这封邮件的邮件，按发送时间排序
+}
+
+// Results 按深度优先的顺序返回会话中的所有邮件
+func (t *Thread) Results() []*Result {
+	var results []*Result
+	if t.Result != nil {
+		results = append(results, t.Result)
+	}
+	for _, child := range t.Children {
+		results = append(results, child.Results()...)
+	}
+	return results
+}
+
+// Date 会话节点的发送时间，节点没有邮件时使用最早的回复的时间
+func (t *Thread) Date() time.Time {
+	if t.Result != nil {
+		return resultDate(t.Result)
+	}
+	var date time.Time
+	for _, child := range t.Children {
+		if d := child.Date(); !d.IsZero() && (date.IsZero() || d.Before(date)) {
+			date = d
+		}
+	}
+	return date
+}
+
+// resultDate 邮件的发送时间，没有Date头时使用到达服务器的时间
+func resultDate(result *Result) time.Time {
+	if !result.SentDate.IsZero() {
+		return result.SentDate
+	}
+	return result.DateTime
+}
+
+var (
+	// subjectPrefixRegexp 回复和转发的前缀，例如"Re: "、"Fwd[2]:"、"回复："
+	subjectPrefixRegexp = regexp.MustCompile(`^(?i)(re|fwd?|回复|答复|转发)\s*(\[\d+\])?\s*[:：]`)
+	// subjectBlobRegexp 邮件列表等添加的"[xxx]"前缀
+	subjectBlobRegexp = regexp.MustCompile(`^\[[^\[\]]*\]`)
+	// subjectFwdRegexp "[fwd: xxx]"形式的转发标题
+	subjectFwdRegexp = regexp.MustCompile(`^(?i)\[fwd:(.*)\]$`)
+	// subjectTrailerRegexp 标题末尾的"(fwd)"
+	subjectTrailerRegexp = regexp.MustCompile(`(?i)\s*\(fwd\)$`)
+)
+
+// BaseSubject 去掉标题中回复和转发的前缀，返回用于比较的标题，参考RFC 5256 section 2.1
+// reply 表示标题是否包含回复或者转发的标记
+func BaseSubject(subject string) (base string, reply bool) {
+	base = strings.Join(strings.Fields(subject), " ")
+	for {
+		prev := base
+
+		// 去掉末尾的"(fwd)"
+		if s := subjectTrailerRegexp.ReplaceAllString(base, ""); s != base {
+			base, reply = s, true
+		}
+
+		// 去掉开头的"Re:"、"[blob]"等
+		for {
+			if loc := subjectPrefixRegexp.FindStringIndex(base); loc != nil {
+				base, reply = strings.TrimSpace(base[loc[1]:]), true
+				continue
+			}
+			loc := subjectBlobRegexp.FindStringIndex(base)
+			if loc != nil && strings.TrimSpace(base[loc[1]:]) != "" {
+				base = strings.TrimSpace(base[loc[1]:])
+				continue
+			}
+			break
+		}
+
+		// 去掉"[fwd: xxx]"的包装
+		if m := subjectFwdRegexp.FindStringSubmatch(base); m != nil {
+			base, reply = strings.TrimSpace(m[1]), true
+		}
+
+		if base == prev {
+			break
+		}
+	}
+	return strings.ToLower(base), reply
+}
+
+// container JWZ算法中的节点
+type container struct {
+	id       string
+	result   *Result
+	parent   *container
+	children []*container
+}
+
+// hasDescendant 判断target是否是c或者c的子孙，用于避免出现环
+func (c *container) hasDescendant(target *container) bool {
+	if c == target {
+		return true
+	}
+	for _, child := range c.children {
+		if child.hasDescendant(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *container) addChild(child *container) {
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+func (c *container) removeChild(child *container) {
+	for i, ch := range c.children {
+		if ch == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// subject 节点的标题，节点没有邮件时使用第一个回复的标题
+func (c *container) subject() string {
+	if c.result != nil {
+		return c.result.Title
+	}
+	if len(c.children) > 0 {
+		return c.children[0].subject()
+	}
+	return ""
+}
+
+// BuildThreads 使用JWZ算法(RFC 5256 REFERENCES)把邮件组织成会话
+// 根据Message-ID、In-Reply-To和References建立回复关系，再把标题相同(去掉Re:、Fwd:、回复:、转发:等前缀)的会话合并
+// 返回的会话按第一封邮件的发送时间排序
+func BuildThreads(results []*Result) []*Thread {
+	table := make(map[string]*container)
+	get := func(id string) *container {
+		c, ok := table[id]
+		if !ok {
+			c = &container{id: id}
+			table[id] = c
+		}
+		return c
+	}
+
+	// 1. 根据引用关系建立父子关系
+	for n, result := range results {
+		var c *container
+		if result.MessageID != "" {
+			c = get(result.MessageID)
+		}
+		if c == nil || c.result != nil {
+			// 没有Message-ID或者Message-ID重复，使用唯一的id
+			c = get(fmt.Sprintf("<zdpgo-imap-%d>", n))
+		}
+		c.result = result
+
+		refs := result.References
+		if len(refs) == 0 && len(result.InReplyTo) > 0 {
+			refs = result.InReplyTo[:1]
+		}
+
+		var prev *container
+		for _, id := range refs {
+			ref := get(id)
+			if prev != nil && ref.parent == nil && !ref.hasDescendant(prev) {
+				prev.addChild(ref)
+			}
+			prev = ref
+		}
+
+		if c.parent != nil {
+			c.parent.removeChild(c)
+		}
+		if prev != nil && !c.hasDescendant(prev) {
+			prev.addChild(c)
+		}
+	}
+
+	// 2. 没有父节点的是根节点
+	var roots []*container
+	for _, c := range table {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+	sort.Slice(roots, func(a, b int) bool {
+		return roots[a].id < roots[b].id
+	})
+
+	// 3. 删除没有邮件的节点
+	roots = pruneContainers(roots, true)
+
+	// 4. 合并标题相同的会话
+	roots = groupBySubject(roots)
+
+	// 5. 转换成会话并按时间排序
+	threads := make([]*Thread, 0, len(roots))
+	for _, root := range roots {
+		threads = append(threads, newThread(root))
+	}
+	sortThreads(threads)
+	return threads
+}
+
+// pruneContainers 删除没有邮件的节点：没有子节点时直接删除，否则用子节点代替
+// 根节点有多个子节点时保留，作为这些会话的共同的根
+func pruneContainers(list []*container, root bool) []*container {
+	var result []*container
+	for _, c := range list {
+		c.children = pruneContainers(c.children, false)
+		for _, child := range c.children {
+			child.parent = c
+		}
+
+		if c.result != nil {
+			result = append(result, c)
+			continue
+		}
+		if len(c.children) == 0 {
+			continue
+		}
+		if !root || len(c.children) == 1 {
+			for _, child := range c.children {
+				child.parent = c.parent
+			}
+			result = append(result, c.children...)
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// groupBySubject 把标题相同的根节点合并到一起
+func groupBySubject(roots []*container) []*container {
+	subjects := make(map[string]*container)
+	for _, c := range roots {
+		subject, reply := BaseSubject(c.subject())
+		if subject == "" {
+			continue
+		}
+		old, ok := subjects[subject]
+		if !ok {
+			subjects[subject] = c
+			continue
+		}
+		// 优先使用没有邮件的节点，其次是没有回复前缀的节点
+		_, oldReply := BaseSubject(old.subject())
+		if (c.result == nil && old.result != nil) || (old.result != nil && c.result != nil && oldReply && !reply) {
+			subjects[subject] = c
+		}
+	}
+
+	var result []*container
+	for _, c := range roots {
+		if c.parent != nil {
+			// 已经合并到其他会话
+			continue
+		}
+		subject, reply := BaseSubject(c.subject())
+		old, ok := subjects[subject]
+		if subject == "" || !ok || old == c {
+			result = append(result, c)
+			continue
+		}
+
+		_, oldReply := BaseSubject(old.subject())
+		switch {
+		case old.result == nil && c.result == nil:
+			// 都没有邮件，合并子节点
+			for _, child := range append([]*container{}, c.children...) {
+				old.addChild(child)
+			}
+		case old.result == nil, !oldReply && reply:
+			old.addChild(c)
+		default:
+			// 创建一个没有邮件的节点作为共同的根，代替原来的会话
+			dummy := &container{}
+			replaced := false
+			for n, r := range result {
+				if r == old {
+					result[n] = dummy
+					replaced = true
+				}
+			}
+			if !replaced {
+				result = append(result, dummy)
+			}
+			dummy.addChild(old)
+			dummy.addChild(c)
+			subjects[subject] = dummy
+		}
+	}
+	return result
+}
+
+func newThread(c *container) *Thread {
+	thread := &Thread{Result: c.result}
+	if c.result != nil {
+		thread.MessageID = c.result.MessageID
+	}
+	for _, child := range c.children {
+		thread.Children = append(thread.Children, newThread(child))
+	}
+	return thread
+}
+
+// sortThreads 按发送时间排序会话及其回复
+func sortThreads(threads []*Thread) {
+	for _, thread := range threads {
+		sortThreads(thread.Children)
+	}
+	sort.SliceStable(threads, func(a, b int) bool {
+		return threads[a].Date().Before(threads[b].Date())
+	})
+}
+
+// ThreadResults 把mailbox中的邮件组织成会话
+// 服务器支持THREAD=REFERENCES时使用服务器的结果，并和本地的JWZ算法的结果进行比较，不一致时记录警告日志；
+// 否则使用BuildThreads在本地计算。results中不属于mailbox的邮件会被忽略
+func (i *Imap) ThreadResults(ctx context.Context, mailbox string, results []*Result) ([]*Thread, error) {
+	var inMailbox []*Result
+	for _, result := range results {
+		if result.Mailbox == "" || result.Mailbox == mailbox {
+			inMailbox = append(inMailbox, result)
+		}
+	}
+	local := BuildThreads(inMailbox)
+	if len(inMailbox) == 0 {
+		return local, nil
+	}
+
+	var threads []*Thread
+	err := i.withClientRetry(ctx, func(c *client.Client) error {
+		ok, err := c.Support("THREAD=" + string(imap.ReferencesThreading))
+		if err != nil {
+			return commandError(c, "CAPABILITY", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		threads, err = i.serverThreads(ctx, c, mailbox, inMailbox)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if threads == nil {
+		return local, nil
+	}
+
+	if diff := compareThreads(local, threads); diff > 0 {
+		i.Log.Warning("本地计算的会话和服务器的THREAD结果不一致，使用服务器的结果", "mailbox", mailbox, "diff", diff)
+	}
+	return threads, nil
+}
+
+// serverThreads 使用UID THREAD REFERENCES获取results所在的会话
+func (i *Imap) serverThreads(ctx context.Context, c *client.Client, mailbox string, results []*Result) ([]*Thread, error) {
+	if _, err := i.selectMailbox(ctx, c, mailbox); err != nil {
+		return nil, err
+	}
+
+	byUid := make(map[uint32]*Result, len(results))
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	for _, result := range results {
+		byUid[result.Uid] = result
+		criteria.Uid.AddNum(result.Uid)
+	}
+
+	found, err := c.UidThreadContext(ctx, imap.ReferencesThreading, criteria)
+	if err != nil {
+		i.Log.Error("获取会话失败", "error", err, "mailbox", mailbox)
+		return nil, commandError(c, "UID THREAD", err)
+	}
+
+	var convert func(t *imap.Thread) *Thread
+	convert = func(t *imap.Thread) *Thread {
+		thread := &Thread{Result: byUid[t.Id]}
+		if thread.Result != nil {
+			thread.MessageID = thread.Result.MessageID
+		}
+		for _, child := range t.Children {
+			thread.Children = append(thread.Children, convert(child))
+		}
+		return thread
+	}
+
+	threads := make([]*Thread, 0, len(found))
+	for _, t := range found {
+		threads = append(threads, convert(t))
+	}
+	return threads, nil
+}
+
+// compareThreads 比较两种会话划分，返回所在会话不同的邮件数量
+// 每个会话使用其中UID最小的邮件作为代表，代表不同说明邮件被分到了不同的会话
+func compareThreads(a, b []*Thread) int {
+	representatives := func(threads []*Thread) map[*Result]uint32 {
+		m := make(map[*Result]uint32)
+		for _, thread := range threads {
+			results := thread.Results()
+			var min uint32
+			for n, result := range results {
+				if n == 0 || result.Uid < min {
+					min = result.Uid
+				}
+			}
+			for _, result := range results {
+				m[result] = min
+			}
+		}
+		return m
+	}
+	ra, rb := representatives(a), representatives(b)
+
+	diff := 0
+	for result, rep := range ra {
+		if other, ok := rb[result]; !ok || other != rep {
+			diff++
+		}
+	}
+	for result := range rb {
+		if _, ok := ra[result]; !ok {
+			diff++
+		}
+	}
+	return diff
+}
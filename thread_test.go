@@ -0,0 +1,284 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap/backend/memory"
+)
+
+func TestBaseSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		base    string
+		reply   bool
+	}{
+		{"", "", false},
+		{"Hello", "hello", false},
+		{"  Hello \t  World ", "hello world", false},
+		{"Re: Hello", "hello", true},
+		{"RE: re: Fwd: Hello", "hello", true},
+		{"Fw: Hello", "hello", true},
+		{"Re[2]: Hello", "hello", true},
+		{"回复：你好", "你好", true},
+		{"转发: 答复: 你好", "你好", true},
+		{"[list] Re: Hello", "hello", true},
+		{"[list] Hello", "hello", false},
+		{"[only]", "[only]", false},
+		{"[fwd: Hello]", "hello", true},
+		{"Hello (fwd)", "hello", true},
+		{"Re: [fwd: Re: Hello] (fwd)", "hello", true},
+		{"Reply to all", "reply to all", false},
+	}
+
+	for _, test := range tests {
+		base, reply := BaseSubject(test.subject)
+		if base != test.base || reply != test.reply {
+			t.Errorf("BaseSubject(%q) = %q, %v, want %q, %v", test.subject, base, reply, test.base, test.reply)
+		}
+	}
+}
+
+// threadMessage 测试用的邮件，day决定发送时间的先后
+type threadMessage struct {
+	id         string
+	title      string
+	day        int
+	inReplyTo  []string
+	references []string
+}
+
+// formatThreads 把会话格式化为"a{b{c},d} e"的形式，没有邮件的节点为"-"
+func formatThreads(threads []*Thread) string {
+	var format func(t *Thread) string
+	format = func(t *Thread) string {
+		label := "-"
+		if t.Result != nil {
+			label = t.Result.Title
+		}
+		if len(t.Children) == 0 {
+			return label
+		}
+		children := make([]string, len(t.Children))
+		for n, child := range t.Children {
+			children[n] = format(child)
+		}
+		return label + "{" + strings.Join(children, ",") + "}"
+	}
+
+	s := make([]string, len(threads))
+	for n, thread := range threads {
+		s[n] = format(thread)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestBuildThreads(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []threadMessage
+		want     string
+	}{
+		{
+			name: "references",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1},
+				{id: "b", title: "b", day: 2, references: []string{"a"}},
+				{id: "c", title: "c", day: 3, references: []string{"a", "b"}},
+				{id: "d", title: "d", day: 4, references: []string{"a"}},
+			},
+			want: "a{b{c},d}",
+		},
+		{
+			name: "in-reply-to",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1},
+				{id: "b", title: "b", day: 2, inReplyTo: []string{"a"}},
+			},
+			want: "a{b}",
+		},
+		{
+			name: "references before in-reply-to",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1},
+				{id: "b", title: "b", day: 2},
+				{id: "c", title: "c", day: 3, inReplyTo: []string{"a"}, references: []string{"b"}},
+			},
+			want: "a b{c}",
+		},
+		{
+			name: "unordered",
+			messages: []threadMessage{
+				{id: "c", title: "c", day: 3, references: []string{"a", "b"}},
+				{id: "b", title: "b", day: 2, references: []string{"a"}},
+				{id: "a", title: "a", day: 1},
+			},
+			want: "a{b{c}}",
+		},
+		{
+			name: "missing parent",
+			messages: []threadMessage{
+				{id: "b", title: "b", day: 2, references: []string{"x"}},
+			},
+			want: "b",
+		},
+		{
+			name: "missing parent with several replies",
+			messages: []threadMessage{
+				{id: "b", title: "b", day: 2, references: []string{"x"}},
+				{id: "c", title: "c", day: 3, references: []string{"x"}},
+			},
+			want: "-{b,c}",
+		},
+		{
+			name: "missing intermediate message",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1},
+				{id: "c", title: "c", day: 3, references: []string{"a", "b"}},
+			},
+			want: "a{c}",
+		},
+		{
+			name: "self reference",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1, references: []string{"a"}},
+			},
+			want: "a",
+		},
+		{
+			name: "loop",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1, references: []string{"b"}},
+				{id: "b", title: "b", day: 2, references: []string{"a"}},
+			},
+			want: "b{a}",
+		},
+		{
+			name: "loop in references",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1},
+				{id: "b", title: "b", day: 2, references: []string{"a", "b", "a"}},
+			},
+			want: "a{b}",
+		},
+		{
+			name: "duplicate message-id",
+			messages: []threadMessage{
+				{id: "a", title: "a", day: 1},
+				{id: "a", title: "a2", day: 2},
+			},
+			want: "a a2",
+		},
+		{
+			name: "same subject",
+			messages: []threadMessage{
+				{title: "Hello", day: 1},
+				{title: "Re: Hello", day: 2},
+				{title: "Other", day: 3},
+			},
+			want: "Hello{Re: Hello} Other",
+		},
+		{
+			name: "same subject without original",
+			messages: []threadMessage{
+				{title: "Re: Hello", day: 1},
+				{title: "回复：hello", day: 2},
+			},
+			want: "-{Re: Hello,回复：hello}",
+		},
+	}
+
+	base := time.Date(2022, 5, 24, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		results := make([]*Result, len(test.messages))
+		for n, msg := range test.messages {
+			results[n] = &Result{
+				MessageID:  msg.id,
+				Title:      msg.title,
+				SentDate:   base.AddDate(0, 0, msg.day),
+				InReplyTo:  msg.inReplyTo,
+				References: msg.references,
+			}
+		}
+
+		if got := formatThreads(BuildThreads(results)); got != test.want {
+			t.Errorf("%s: BuildThreads() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCompareThreads(t *testing.T) {
+	r := make([]*Result, 5)
+	for n := range r {
+		r[n] = &Result{Uid: uint32(n + 1)}
+	}
+	thread := func(result *Result, children ...*Thread) *Thread {
+		return &Thread{Result: result, Children: children}
+	}
+
+	tests := []struct {
+		name string
+		a, b []*Thread
+		diff int
+	}{
+		{
+			name: "same",
+			a:    []*Thread{thread(r[0], thread(r[1])), thread(r[2])},
+			b:    []*Thread{thread(r[2]), thread(r[0], thread(r[1]))},
+		},
+		{
+			name: "different structure in the same thread",
+			a:    []*Thread{thread(r[0], thread(r[1], thread(r[2])))},
+			b:    []*Thread{thread(nil, thread(r[0]), thread(r[1]), thread(r[2]))},
+		},
+		{
+			name: "split thread",
+			a:    []*Thread{thread(r[0], thread(r[1]), thread(r[2]))},
+			b:    []*Thread{thread(r[0], thread(r[1])), thread(r[2])},
+			diff: 1,
+		},
+		{
+			name: "missing message",
+			a:    []*Thread{thread(r[0]), thread(r[3])},
+			b:    []*Thread{thread(r[0]), thread(r[4])},
+			diff: 2,
+		},
+	}
+
+	for _, test := range tests {
+		if diff := compareThreads(test.a, test.b); diff != test.diff {
+			t.Errorf("%s: compareThreads() = %d, want %d", test.name, diff, test.diff)
+		}
+	}
+}
+
+func TestThreadResults(t *testing.T) {
+	i := newTestImap(t, memory.New())
+	appendTestMessages(t, i, "INBOX",
+		"Message-ID: <1@example.org>\nDate: Tue, 24 May 2022 20:08:00 +0000\nSubject: hello\n\n1\n",
+		"Message-ID: <2@example.org>\nDate: Wed, 25 May 2022 20:08:00 +0000\nSubject: Re: hello\n"+
+			"References: <1@example.org>\n\n2\n",
+		"Message-ID: <3@example.org>\nDate: Thu, 26 May 2022 20:08:00 +0000\nSubject: Re: hello\n"+
+			"In-Reply-To: <2@example.org>\n\n3\n",
+		"Message-ID: <4@example.org>\nDate: Fri, 27 May 2022 20:08:00 +0000\nSubject: other\n\n4\n",
+	)
+
+	ctx := context.Background()
+	results, err := i.SearchByRecentIn(ctx, "INBOX", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 其他邮箱中的邮件被忽略
+	results = append(results, &Result{Mailbox: "Archive", Uid: 1, Title: "archived"})
+
+	threads, err := i.ThreadResults(ctx, "INBOX", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "A little message, just for you hello{Re: hello{Re: hello}} other"
+	if got := formatThreads(threads); got != want {
+		t.Errorf("ThreadResults() = %q, want %q", got, want)
+	}
+}
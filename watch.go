@@ -0,0 +1,275 @@
+package zdpgo_imap
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_imap/imap"
+	"github.com/zhangdapeng520/zdpgo_imap/imap/client"
+)
+
+/*
+@Time : 2022/5/24 20:07
+@Author : 张大鹏
+@File : watch.go
+@Software: Goland2021.3.1
+@Description: 基于IDLE的新邮件推送
+*/
+
+// watcher 使用一个专用的连接保持IDLE，监听邮箱的新邮件
+type watcher struct {
+	imap    *Imap
+	mailbox string
+	client  *client.Client
+	notify  chan struct{} // 收到EXISTS时通知抓取新邮件
+	lastUid uint32        // 已经推送的最大UID
+	results chan *Result  // 推送新邮件的内容
+	uids    chan []uint32 // 不为nil时只推送新邮件的UID，不抓取邮件内容
+}
+
+// Watch 监听邮箱的新邮件，返回推送新邮件的信道。ctx结束时停止监听并关闭信道
+// 服务器不支持IDLE时退化为定时NOOP轮询。连接断开后会自动重新连接，并补上断开期间收到的邮件
+// 附件模式为AttachmentModeDisk时，调用者处理完邮件后需要使用RemoveAttachments删除临时文件
+func (i *Imap) Watch(ctx context.Context, mailbox string) (<-chan *Result, error) {
+	w := &watcher{results: make(chan *Result, 10)}
+	if err := i.startWatcher(ctx, mailbox, w); err != nil {
+		return nil, err
+	}
+	return w.results, nil
+}
+
+// watchUids 和Watch相同，但是只推送新邮件的UID，由调用者决定是否抓取邮件内容
+func (i *Imap) watchUids(ctx context.Context, mailbox string) (<-chan []uint32, error) {
+	w := &watcher{uids: make(chan []uint32, 10)}
+	if err := i.startWatcher(ctx, mailbox, w); err != nil {
+		return nil, err
+	}
+	return w.uids, nil
+}
+
+// startWatcher 建立连接并开始监听
+func (i *Imap) startWatcher(ctx context.Context, mailbox string, w *watcher) error {
+	if mailbox == "" {
+		mailbox = imap.InboxName
+	}
+	w.imap = i
+	w.mailbox = mailbox
+	w.notify = make(chan struct{}, 1)
+	if err := w.connect(ctx); err != nil {
+		return err
+	}
+
+	go w.run(ctx)
+	return nil
+}
+
+// connect 建立专用的连接并打开邮箱，第一次连接时记录当前最大的UID
+func (w *watcher) connect(ctx context.Context) error {
+	c, err := w.imap.dial(ctx)
+	if err != nil {
+		if c != nil {
+			c.Terminate()
+		}
+		return err
+	}
+
+	// 阻塞Updates会阻塞整个客户端，所以使用单独的goroutine读取
+	updates := make(chan client.Update, 10)
+	c.Updates = updates
+	go w.drain(c, updates)
+
+	mbox, err := w.imap.selectMailbox(ctx, c, w.mailbox)
+	if err != nil {
+		c.Terminate()
+		return err
+	}
+	w.client = c
+
+	if w.lastUid == 0 {
+		if mbox.UidNext > 0 {
+			w.lastUid = mbox.UidNext - 1
+		} else if mbox.Messages > 0 {
+			// 服务器没有返回UIDNEXT时，查询最后一封邮件的UID
+			criteria := imap.NewSearchCriteria()
+			criteria.SeqNum = new(imap.SeqSet)
+			criteria.SeqNum.AddNum(mbox.Messages)
+			uids, err := c.UidSearchContext(ctx, criteria)
+			if err != nil {
+				c.Terminate()
+				return commandError(c, "UID SEARCH", err)
+			}
+			for _, uid := range uids {
+				if uid > w.lastUid {
+					w.lastUid = uid
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// drain 读取服务器的主动通知，直到连接断开
+func (w *watcher) drain(c *client.Client, updates <-chan client.Update) {
+	for {
+		select {
+		case update := <-updates:
+			switch update := update.(type) {
+			case *client.MailboxUpdate:
+				// EXISTS: 有新的邮件
+				select {
+				case w.notify <- struct{}{}:
+				default:
+				}
+			case *client.ExpungeUpdate:
+				w.imap.Log.Debug("邮件被删除", "mailbox", w.mailbox, "seqNum", update.SeqNum)
+			}
+		case <-c.LoggedOut():
+			return
+		}
+	}
+}
+
+func (w *watcher) run(ctx context.Context) {
+	defer func() {
+		if w.uids != nil {
+			close(w.uids)
+		} else {
+			close(w.results)
+		}
+	}()
+	defer func() {
+		closeClient(w.client)
+	}()
+
+	for {
+		err := w.idle(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = w.fetchNew(ctx)
+		}
+		if err == nil {
+			continue
+		}
+
+		// 连接出错，重新连接后补上断开期间收到的邮件
+		w.imap.Log.Warning("监听邮箱出错，重新连接", "error", err, "mailbox", w.mailbox)
+		if !w.reconnect(ctx) {
+			return
+		}
+	}
+}
+
+// idle 保持IDLE，直到收到新邮件的通知、ctx结束或者出错
+func (w *watcher) idle(ctx context.Context) error {
+	idleCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.client.IdleContext(idleCtx, nil)
+	}()
+
+	select {
+	case <-w.notify:
+		cancel()
+		if err := <-done; err != context.Canceled {
+			return err
+		}
+		return nil
+	case err := <-done:
+		if err == nil {
+			err = errors.New("imap: idle stopped unexpectedly")
+		}
+		return err
+	}
+}
+
+// reconnect 按照指数退避重新连接，ctx结束时返回false
+func (w *watcher) reconnect(ctx context.Context) bool {
+	w.client.Terminate()
+
+	delay := time.Second
+	for {
+		err := w.connect(ctx)
+		if err == nil {
+			if err = w.fetchNew(ctx); err == nil {
+				return true
+			}
+			// 下次重试的connect会覆盖w.client，先关闭这个已经登录的连接
+			w.client.Terminate()
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		w.imap.Log.Warning("重新连接失败", "error", err, "delay", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+		if delay *= 2; delay > time.Minute {
+			delay = time.Minute
+		}
+	}
+}
+
+// fetchNew 根据UID抓取lastUid之后到达的邮件并推送
+func (w *watcher) fetchNew(ctx context.Context) error {
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(w.lastUid+1, 0)
+
+	uids, err := w.client.UidSearchContext(ctx, criteria)
+	if err != nil {
+		return commandError(w.client, "UID SEARCH", err)
+	}
+
+	// n:* 在邮箱中最大的UID小于n时也会返回最大的UID，需要过滤掉
+	var newUids []uint32
+	for _, uid := range uids {
+		if uid > w.lastUid {
+			newUids = append(newUids, uid)
+		}
+	}
+	if len(newUids) == 0 {
+		return nil
+	}
+	sortUidsAsc(newUids)
+
+	if w.uids != nil {
+		select {
+		case w.uids <- newUids:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		w.lastUid = newUids[len(newUids)-1]
+		return nil
+	}
+
+	infos, err := w.imap.fetchByUids(ctx, w.client, newUids, w.imap.infoItems())
+	if err != nil {
+		return err
+	}
+	results, err := w.imap.fetchResults(ctx, w.client, newUids, infos, nil)
+	if err != nil {
+		return err
+	}
+
+	for n, result := range results {
+		result.Mailbox = w.mailbox
+		select {
+		case w.results <- result:
+		case <-ctx.Done():
+			w.imap.RemoveAttachments(results[n:]...)
+			return ctx.Err()
+		}
+		if result.Uid > w.lastUid {
+			w.lastUid = result.Uid
+		}
+	}
+	return nil
+}